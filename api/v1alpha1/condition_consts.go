@@ -36,6 +36,46 @@ const (
 	// KubewardenAddonReinstallingReason indicates that the KubewardenAddon controller is reinstalling a KubewardenAddon.
 	KubewardenAddonReinstallingReason = "KubewardenAddonReinstalling"
 
+	// KubewardenChartNotFoundReason indicates that the chart repository has no Kubewarden charts matching the
+	// KubewardenAddon version.
+	KubewardenChartNotFoundReason = "KubewardenChartNotFound"
+
+	// KubewardenValuesNotResolvedReason indicates that the Helm values referenced by the KubewardenAddon could not be
+	// read or parsed.
+	KubewardenValuesNotResolvedReason = "KubewardenValuesNotResolved"
+
+	// KubewardenVerificationConfigNotResolvedReason indicates that the Sigstore verification configuration referenced
+	// by the KubewardenAddon could not be read or is invalid. Kubewarden is not installed or updated without it.
+	KubewardenVerificationConfigNotResolvedReason = "KubewardenVerificationConfigNotResolved"
+
+	// KubewardenRegistriesNotResolvedReason indicates that the registry credentials or sources configuration
+	// referenced by the KubewardenAddon could not be read or are invalid.
+	KubewardenRegistriesNotResolvedReason = "KubewardenRegistriesNotResolved"
+
+	// KubewardenArtifactsNotResolvedReason indicates that the Kubewarden CRDs or charts could not be read from the
+	// artifact sources of the KubewardenAddon, such as a missing CRDs ConfigMap.
+	KubewardenArtifactsNotResolvedReason = "KubewardenArtifactsNotResolved"
+
+	// KubewardenInstallModeNotAvailableReason indicates that the management cluster does not serve the API the
+	// install mode of the KubewardenAddon relies on, such as HelmChartProxies without the Cluster API Addon Provider
+	// for Helm.
+	KubewardenInstallModeNotAvailableReason = "KubewardenInstallModeNotAvailable"
+
+	// KubewardenComponentsNotReadyReason indicates that Kubewarden components are not running on a cluster, such as
+	// the kubewarden-controller Deployment, its webhooks or the default PolicyServer.
+	KubewardenComponentsNotReadyReason = "KubewardenComponentsNotReady"
+
+	// NoMatchingClustersReason indicates that no workload Cluster matches the KubewardenAddon ClusterSelector.
+	NoMatchingClustersReason = "NoMatchingClusters"
+
+	// RolloutHaltedReason indicates that the rollout of Kubewarden stopped because it failed on clusters being
+	// rolled out.
+	RolloutHaltedReason = "RolloutHalted"
+
+	// RolloutInProgressReason indicates that clusters are waiting for the rollout strategy to install or upgrade
+	// Kubewarden on them.
+	RolloutInProgressReason = "RolloutInProgress"
+
 	// ClusterSelectionFailedReason indicates that the KubewardenAddon controller failed to select the workload Clusters.
 	ClusterSelectionFailedReason = "ClusterSelectionFailed"
 
@@ -44,6 +84,20 @@ const (
 	KubewardenAddonsReadyCondition clusterv1.ConditionType = "KubewardenAddonReady"
 )
 
+// Common Conditions and Reasons.
+const (
+	// PausedCondition is true when the reconciliation of the object, or of some of the Clusters it selects, is
+	// paused. It has negative polarity and is not part of the Ready summary.
+	PausedCondition clusterv1.ConditionType = "Paused"
+
+	// PausedReason indicates that the reconciliation of the object is paused by its spec.paused field.
+	PausedReason = "Paused"
+
+	// ClustersPausedReason indicates that selected Clusters are paused, with spec.paused or the
+	// cluster.x-k8s.io/paused annotation, and are left untouched until they are resumed.
+	ClustersPausedReason = "ClustersPaused"
+)
+
 // KubewardenPolicy Conditions and Reasons.
 const (
 	// KubewardenPolicyReadyCondition indicates that the KubewardenPolicy is ready and deployed to all matching clusters.
@@ -17,11 +17,26 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"strings"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
+const (
+	// KubewardenAddonFinalizer allows the KubewardenAddon controller to uninstall Kubewarden from the
+	// workload clusters before the KubewardenAddon is removed.
+	KubewardenAddonFinalizer = "kubewardenaddon.addon.cluster.x-k8s.io"
+
+	// DefaultImageRepository is the registry and repository prefix of the upstream Kubewarden images.
+	DefaultImageRepository = "ghcr.io/kubewarden"
+
+	kubewardenControllerImage = "kubewarden-controller"
+)
+
 // KubewardenAddonSpec defines the desired state of KubewardenAddon.
 type KubewardenAddonSpec struct {
 	// ClusterSelector selects Clusters in the same namespace with a label that matches the specified label selector. The Kubewarden
@@ -33,11 +48,312 @@ type KubewardenAddonSpec struct {
 	// +optional
 	Version string `json:"version,omitempty"`
 
-	// ImageRepository specifies the repository for pulling Kubewarden images.
+	// ImageRepository specifies the registry and repository prefix for pulling Kubewarden images, such as
+	// "ghcr.io/kubewarden". The kubewarden-controller, policy-server and audit-scanner images are pulled from
+	// "<imageRepository>/<image>". It must not contain a tag or digest, image tags are defined by the version.
+	// +optional
 	ImageRepository string `json:"imageRepository,omitempty"`
 
 	// PolicyServerConfig holds configuration for the policy server.
 	PolicyServerConfig PolicyServerConfig `json:"policyServerConfig"`
+
+	// AuditScanner holds configuration for the audit scanner.
+	// +optional
+	AuditScanner AuditScannerConfig `json:"auditScanner,omitempty"`
+
+	// VerificationConfig references the Sigstore verification configuration policy modules must satisfy. It is
+	// copied to each selected cluster and set on the default PolicyServer, which then only runs signed modules.
+	// +optional
+	VerificationConfig *VerificationConfigReference `json:"verificationConfig,omitempty"`
+
+	// Registries configures how the default PolicyServer pulls policy modules from private or insecure registries.
+	// +optional
+	Registries *RegistriesConfig `json:"registries,omitempty"`
+
+	// Artifacts sets where the Kubewarden charts and CRDs are fetched from, such as mirrors reachable from
+	// disconnected management clusters. Defaults to the sources set with the flags of the manager.
+	// +optional
+	Artifacts *ArtifactsConfig `json:"artifacts,omitempty"`
+
+	// RemoveCRDs specifies whether the Kubewarden CRDs are removed from the workload clusters when the
+	// KubewardenAddon is deleted. Removing the CRDs also removes any Kubewarden resource left on the clusters.
+	// +optional
+	RemoveCRDs bool `json:"removeCRDs,omitempty"`
+
+	// ControllerValues is a free-form object of Helm values for the kubewarden-controller chart. They are merged
+	// over the values computed by the provider and the values referenced by ValuesFrom.
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	ControllerValues runtime.RawExtension `json:"controllerValues,omitempty"`
+
+	// DefaultsValues is a free-form object of Helm values for the kubewarden-defaults chart. They are merged
+	// over the values computed by the provider and the values referenced by ValuesFrom.
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	DefaultsValues runtime.RawExtension `json:"defaultsValues,omitempty"`
+
+	// ValuesFrom references ConfigMaps and Secrets in the namespace of the KubewardenAddon holding Helm values for
+	// the Kubewarden charts. They are merged in order over the values computed by the provider, changes to the
+	// referenced objects are rolled out to the selected clusters.
+	// +optional
+	ValuesFrom []ValuesReference `json:"valuesFrom,omitempty"`
+
+	// RolloutStrategy controls how Kubewarden installs and upgrades are rolled out to the selected clusters. If it
+	// is not specified, all the selected clusters are installed or upgraded at once. It is only supported with the
+	// Direct and Helm install modes.
+	// +optional
+	RolloutStrategy *RolloutStrategy `json:"rolloutStrategy,omitempty"`
+
+	// Scheduling defines where the Kubewarden components run on the workload clusters.
+	// +optional
+	Scheduling SchedulingConfig `json:"scheduling,omitempty"`
+
+	// DeselectionPolicy defines what happens to Kubewarden on the clusters the KubewardenAddon installed it to
+	// once they stop matching the ClusterSelector. Delete uninstalls Kubewarden from them, Orphan leaves it in
+	// place.
+	// +kubebuilder:default=Delete
+	// +optional
+	DeselectionPolicy DeselectionPolicy `json:"deselectionPolicy,omitempty"`
+
+	// InstallMode defines how Kubewarden is installed on the selected clusters. Direct applies the rendered
+	// manifests to each cluster, Helm installs them as Helm releases of each cluster, ClusterResourceSet hands them
+	// over to a ClusterResourceSet and HelmChartProxy installs the Kubewarden charts with the Cluster API Addon
+	// Provider for Helm. It can't be changed once set.
+	// +kubebuilder:default=Direct
+	// +optional
+	InstallMode InstallMode `json:"installMode,omitempty"`
+
+	// Paused stops the reconciliation of the KubewardenAddon, deletion included, so Kubewarden is left untouched
+	// on the workload clusters.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+}
+
+// DeselectionPolicy defines what happens to Kubewarden on a cluster that stops matching the ClusterSelector.
+// +kubebuilder:validation:Enum=Delete;Orphan
+type DeselectionPolicy string
+
+const (
+	// DeselectionPolicyDelete uninstalls Kubewarden from the clusters that are no longer selected.
+	DeselectionPolicyDelete DeselectionPolicy = "Delete"
+
+	// DeselectionPolicyOrphan leaves Kubewarden installed on the clusters that are no longer selected, they are
+	// no longer managed by the KubewardenAddon.
+	DeselectionPolicyOrphan DeselectionPolicy = "Orphan"
+)
+
+// InstallMode defines how Kubewarden is installed on the selected clusters.
+// +kubebuilder:validation:Enum=Direct;Helm;ClusterResourceSet;HelmChartProxy
+type InstallMode string
+
+const (
+	// InstallModeDirect renders the Kubewarden charts and applies the manifests with a client of each cluster.
+	InstallModeDirect InstallMode = "Direct"
+
+	// InstallModeHelm installs and upgrades the Kubewarden charts as Helm releases of each cluster, with the
+	// rendered manifests, so the release history is stored in the cluster.
+	InstallModeHelm InstallMode = "Helm"
+
+	// InstallModeClusterResourceSet renders the Kubewarden charts into ConfigMaps applied to the clusters by a
+	// ClusterResourceSet.
+	InstallModeClusterResourceSet InstallMode = "ClusterResourceSet"
+
+	// InstallModeHelmChartProxy creates HelmChartProxies installing the Kubewarden charts on the clusters with the
+	// Cluster API Addon Provider for Helm.
+	InstallModeHelmChartProxy InstallMode = "HelmChartProxy"
+)
+
+// SchedulingConfig defines where the Kubewarden components run on the workload clusters.
+type SchedulingConfig struct {
+	// TolerateControlPlane adds a toleration of the node-role.kubernetes.io/control-plane taint to every Kubewarden
+	// component, so they can run on single-node clusters such as CAPD or kind clusters.
+	// +optional
+	TolerateControlPlane bool `json:"tolerateControlPlane,omitempty"`
+
+	// Controller defines the scheduling of the kubewarden-controller Deployment.
+	// +optional
+	Controller Scheduling `json:"controller,omitempty"`
+
+	// PolicyServer defines the scheduling of the default PolicyServer. The PolicyServer does not support topology
+	// spread constraints, its node selector is turned into a required node affinity.
+	// +optional
+	PolicyServer Scheduling `json:"policyServer,omitempty"`
+
+	// AuditScanner defines the scheduling of the audit-scanner CronJob.
+	// +optional
+	AuditScanner Scheduling `json:"auditScanner,omitempty"`
+}
+
+// Scheduling defines the scheduling constraints of the pods of a Kubewarden component.
+type Scheduling struct {
+	// NodeSelector must match the labels of the nodes the pods are scheduled on.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations of the pods.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity defines the node and pod affinity rules of the pods.
+	// +optional
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// TopologySpreadConstraints define how the pods are spread across topology domains.
+	// +optional
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+}
+
+// RolloutStrategy controls how Kubewarden installs and upgrades are rolled out to the selected clusters.
+type RolloutStrategy struct {
+	// BatchSize is the number or percentage of clusters installed or upgraded together. The next batch starts once
+	// every cluster of the current batch is ready and soaked. Percentages are rounded up. Mutually exclusive with
+	// MaxUnavailable.
+	// +optional
+	// +kubebuilder:validation:XIntOrString
+	BatchSize *intstr.IntOrString `json:"batchSize,omitempty"`
+
+	// MaxUnavailable is the maximum number or percentage of clusters installed or upgraded at the same time. Unlike
+	// BatchSize, another cluster starts as soon as one is ready and soaked. Percentages are rounded down, to at
+	// least one cluster. Mutually exclusive with BatchSize.
+	// +optional
+	// +kubebuilder:validation:XIntOrString
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+
+	// OrderByLabel is the key of a Cluster label ordering the rollout, such as "wave". Clusters are rolled out in
+	// ascending order of the label values, numbers first, and clusters without the label go last.
+	// +optional
+	OrderByLabel string `json:"orderByLabel,omitempty"`
+
+	// SoakTime is how long a cluster must stay ready after being installed or upgraded before the rollout moves on
+	// to the next clusters.
+	// +optional
+	SoakTime *metav1.Duration `json:"soakTime,omitempty"`
+}
+
+// VerificationConfigReference references a ConfigMap key holding a Kubewarden Sigstore verification configuration,
+// in the format generated by "kwctl scaffold verification-config". It lists the signatures policy modules must carry:
+// public keys, keyless signatures of an issuer and subject, or GitHub Actions identities.
+type VerificationConfigReference struct {
+	// Name of the ConfigMap holding the verification configuration, in the namespace of the KubewardenAddon.
+	Name string `json:"name"`
+
+	// Key of the verification configuration in the ConfigMap data.
+	// +optional
+	// +kubebuilder:default=verification-config
+	Key string `json:"key,omitempty"`
+}
+
+// RegistriesConfig configures how the default PolicyServer pulls policy modules from private or insecure
+// registries. The referenced Secrets are read from the namespace of the KubewardenAddon, changes to them are rolled
+// out to the selected clusters.
+type RegistriesConfig struct {
+	// ImagePullSecret is the name of a Secret of type kubernetes.io/dockerconfigjson holding the credentials of the
+	// registries. It is copied to the kubewarden namespace of each selected cluster and set as the image pull
+	// secret of the default PolicyServer, whose pods are restarted when the credentials change.
+	// +optional
+	ImagePullSecret string `json:"imagePullSecret,omitempty"`
+
+	// SourcesFrom references a Secret key holding the sources configuration of the policy server, in the
+	// sources.yaml format: insecure_sources lists the registries reached without TLS or without verifying their
+	// certificate, and source_authorities maps registries to the PEM certificates of their certificate authorities.
+	// It is set on the default PolicyServer.
+	// +optional
+	SourcesFrom *SourcesReference `json:"sourcesFrom,omitempty"`
+}
+
+// ArtifactsConfig sets where the Kubewarden charts and CRDs are fetched from.
+type ArtifactsConfig struct {
+	// ChartRepository is the repository the kubewarden-controller and kubewarden-defaults charts are pulled from:
+	// the URL of a Helm repository mirroring https://charts.kubewarden.io, or of an OCI registry such as
+	// oci://registry.example.com/kubewarden/charts. Defaults to the --kubewarden-chart-repository flag of the
+	// manager.
+	// +kubebuilder:validation:Pattern=`^(https?|oci)://`
+	// +optional
+	ChartRepository string `json:"chartRepository,omitempty"`
+
+	// CRDs sets where the Kubewarden CRDs are fetched from. Defaults to the --kubewarden-crds-source flag of the
+	// manager.
+	// +optional
+	CRDs *CRDsSource `json:"crds,omitempty"`
+}
+
+// CRDsSourceType is the kind of source the Kubewarden CRDs are fetched from.
+// +kubebuilder:validation:Enum=Release;Chart;ConfigMap
+type CRDsSourceType string
+
+const (
+	// CRDsSourceRelease downloads the CRDS.tar.gz tarball of the kubewarden-controller release.
+	CRDsSourceRelease CRDsSourceType = "Release"
+
+	// CRDsSourceChart renders the kubewarden-crds chart of the chart repository.
+	CRDsSourceChart CRDsSourceType = "Chart"
+
+	// CRDsSourceConfigMap reads the CRDs from a ConfigMap in the namespace of the KubewardenAddon.
+	CRDsSourceConfigMap CRDsSourceType = "ConfigMap"
+)
+
+// CRDsSource sets where the Kubewarden CRDs are fetched from.
+type CRDsSource struct {
+	// Type is the kind of source of the CRDs.
+	// +kubebuilder:default=Release
+	Type CRDsSourceType `json:"type"`
+
+	// URL is the base URL the release tarballs are downloaded from with the Release type, the CRDs of a version
+	// are downloaded from <url>/<version>/CRDS.tar.gz. Defaults to the --kubewarden-crds-url flag of the manager.
+	// +kubebuilder:validation:Pattern=`^https?://`
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// Digest is the SHA-256 digest the release tarball must match with the Release type, such as
+	// sha256:<hex>. The digest is pinned to the tarball of spec.version, it must be updated along with it.
+	// +kubebuilder:validation:Pattern=`^(sha256:)?[a-f0-9]{64}$`
+	// +optional
+	Digest string `json:"digest,omitempty"`
+
+	// ConfigMapName is the name of the ConfigMap holding the CRDs with the ConfigMap type, in the namespace of the
+	// KubewardenAddon. Every key of the ConfigMap holds YAML manifests. The ConfigMap is not versioned, it must be
+	// updated along with spec.version.
+	// +optional
+	ConfigMapName string `json:"configMapName,omitempty"`
+}
+
+// SourcesReference references a Secret key holding a policy server sources configuration.
+type SourcesReference struct {
+	// Name of the Secret holding the sources configuration, in the namespace of the KubewardenAddon.
+	Name string `json:"name"`
+
+	// Key of the sources configuration in the Secret data.
+	// +optional
+	// +kubebuilder:default=sources.yaml
+	Key string `json:"key,omitempty"`
+}
+
+// ValuesReference references a ConfigMap or Secret key holding Helm values in YAML format.
+type ValuesReference struct {
+	// Kind of the object holding the values.
+	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	Kind string `json:"kind"`
+
+	// Name of the object holding the values, in the namespace of the KubewardenAddon.
+	Name string `json:"name"`
+
+	// Key of the values in the object data.
+	// +optional
+	// +kubebuilder:default=values.yaml
+	Key string `json:"key,omitempty"`
+
+	// Chart the values apply to.
+	// +kubebuilder:validation:Enum=kubewarden-controller;kubewarden-defaults
+	Chart string `json:"chart"`
+
+	// Optional specifies whether a missing object or key is ignored instead of failing the reconciliation.
+	// +optional
+	Optional bool `json:"optional,omitempty"`
 }
 
 // PolicyServerConfig represents the configuration options for the policy server.
@@ -46,16 +362,96 @@ type PolicyServerConfig struct {
 	Resources ResourceRequirements `json:"resources,omitempty"`
 
 	// Replicas specifies the number of replicas for high availability.
+	// +kubebuilder:validation:Minimum=0
 	Replicas int32 `json:"replicas,omitempty"`
 }
 
+// AuditScannerConfig represents the configuration options for the audit scanner, which periodically evaluates the
+// resources of the workload clusters against the policies in place and reports the results.
+type AuditScannerConfig struct {
+	// Enabled specifies whether the audit scanner runs on the workload clusters. Defaults to true.
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Schedule is the cron schedule of the audit scanner, such as "*/60 * * * *". Defaults to the schedule of the
+	// kubewarden-controller chart.
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// Resources defines the CPU and memory resources for the audit scanner.
+	// +optional
+	Resources ResourceRequirements `json:"resources,omitempty"`
+
+	// OutputMode defines where the audit results are reported. PolicyReports stores them in PolicyReport
+	// resources, Stdout prints them in the audit scanner logs and Both does both. Defaults to PolicyReports.
+	// +optional
+	OutputMode AuditScannerOutputMode `json:"outputMode,omitempty"`
+
+	// SkipNamespaces lists the namespaces the audit scanner does not evaluate, in addition to the ones skipped by
+	// the kubewarden-controller chart.
+	// +optional
+	SkipNamespaces []string `json:"skipNamespaces,omitempty"`
+}
+
+// AuditScannerOutputMode defines where the audit scanner reports the audit results.
+// +kubebuilder:validation:Enum=PolicyReports;Stdout;Both
+type AuditScannerOutputMode string
+
+const (
+	// AuditScannerOutputPolicyReports stores the audit results in PolicyReport resources.
+	AuditScannerOutputPolicyReports AuditScannerOutputMode = "PolicyReports"
+
+	// AuditScannerOutputStdout prints the audit results in the audit scanner logs.
+	AuditScannerOutputStdout AuditScannerOutputMode = "Stdout"
+
+	// AuditScannerOutputBoth stores the audit results in PolicyReport resources and prints them in the logs.
+	AuditScannerOutputBoth AuditScannerOutputMode = "Both"
+)
+
+// IsEnabled returns whether the audit scanner runs on the workload clusters.
+func (c *AuditScannerConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
 // ResourceRequirements defines CPU and memory resource limits and requests.
 type ResourceRequirements struct {
-	// CPU request for the policy server.
+	// CPU request of the component.
 	CPU string `json:"cpu,omitempty"`
 
-	// Memory request for the policy server.
+	// Memory request of the component.
 	Memory string `json:"memory,omitempty"`
+
+	// Limits defines the maximum amount of CPU and memory the component can use.
+	// +optional
+	Limits ResourceLimits `json:"limits,omitempty"`
+}
+
+// ResourceLimits defines CPU and memory resource limits.
+type ResourceLimits struct {
+	// CPU limit of the component.
+	CPU string `json:"cpu,omitempty"`
+
+	// Memory limit of the component.
+	Memory string `json:"memory,omitempty"`
+}
+
+// ImageRepositoryPrefix returns the registry and repository prefix of the Kubewarden images. Addons created before
+// ImageRepository became a prefix hold the full kubewarden-controller image reference, which is reduced to its prefix.
+func (s *KubewardenAddonSpec) ImageRepositoryPrefix() string {
+	prefix := strings.TrimSuffix(s.ImageRepository, "/")
+
+	slash := strings.LastIndex(prefix, "/")
+	if slash < 0 {
+		return prefix
+	}
+
+	name, _, _ := strings.Cut(prefix[slash+1:], "@")
+	name, _, _ = strings.Cut(name, ":")
+	if name == kubewardenControllerImage {
+		return prefix[:slash]
+	}
+
+	return prefix
 }
 
 // KubewardenAddonStatus defines the observed state of KubewardenAddon.
@@ -70,10 +466,164 @@ type KubewardenAddonStatus struct {
 	// MatchingClusters is the list of references to Clusters selected by the ClusterSelector.
 	// +optional
 	MatchingClusters []corev1.ObjectReference `json:"matchingClusters"`
+
+	// Clusters tracks the state of Kubewarden on each selected Cluster, and on the Clusters it is being
+	// uninstalled from after they stopped matching the ClusterSelector.
+	// +optional
+	Clusters []ClusterInstallationStatus `json:"clusters,omitempty"`
+
+	// SelectedClusters is the number of Clusters selected by the ClusterSelector.
+	// +optional
+	SelectedClusters int32 `json:"selectedClusters"`
+
+	// ReadyClusters is the number of selected Clusters where Kubewarden is ready.
+	// +optional
+	ReadyClusters int32 `json:"readyClusters"`
+
+	// FailedClusters is the number of selected Clusters where installing or upgrading Kubewarden failed.
+	// +optional
+	FailedClusters int32 `json:"failedClusters"`
+
+	// Rollout reports the progress of the rollout when a RolloutStrategy is set.
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+}
+
+// RolloutStatus reports the progress of rolling out a Kubewarden version to the selected clusters.
+type RolloutStatus struct {
+	// Version is the Kubewarden version being rolled out.
+	Version string `json:"version"`
+
+	// Hash is the hash of the Kubewarden manifests being rolled out. New chart values or addon settings start a
+	// new rollout, like a new Version.
+	// +optional
+	Hash string `json:"hash,omitempty"`
+
+	// Batch is the number of batches started since the rollout of Version began.
+	// +optional
+	Batch int32 `json:"batch,omitempty"`
+
+	// Clusters lists the names of the clusters being installed or upgraded, or soaking.
+	// +optional
+	Clusters []string `json:"clusters,omitempty"`
+
+	// UpdatedClusters is the number of selected clusters where Version is ready.
+	// +optional
+	UpdatedClusters int32 `json:"updatedClusters"`
+
+	// Halted indicates the rollout stopped because Kubewarden failed on clusters being rolled out. It resumes
+	// once they recover, or when a new version is rolled out.
+	// +optional
+	Halted bool `json:"halted,omitempty"`
+
+	// Message describes the state of the rollout.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// ClusterInstallationPhase is the phase of the Kubewarden installation on a cluster.
+// +kubebuilder:validation:Enum=Pending;Installing;Upgrading;Ready;Degraded;Failed;Uninstalling
+type ClusterInstallationPhase string
+
+const (
+	// ClusterInstallationPending means the cluster is not ready yet for Kubewarden to be installed.
+	ClusterInstallationPending ClusterInstallationPhase = "Pending"
+
+	// ClusterInstallationInstalling means Kubewarden is being installed on the cluster.
+	ClusterInstallationInstalling ClusterInstallationPhase = "Installing"
+
+	// ClusterInstallationUpgrading means Kubewarden is being upgraded on the cluster.
+	ClusterInstallationUpgrading ClusterInstallationPhase = "Upgrading"
+
+	// ClusterInstallationReady means Kubewarden is installed on the cluster with the desired version, and its
+	// components are healthy.
+	ClusterInstallationReady ClusterInstallationPhase = "Ready"
+
+	// ClusterInstallationDegraded means Kubewarden is installed on the cluster with the desired version, but some
+	// of its components are not healthy anymore.
+	ClusterInstallationDegraded ClusterInstallationPhase = "Degraded"
+
+	// ClusterInstallationFailed means installing or upgrading Kubewarden on the cluster failed.
+	ClusterInstallationFailed ClusterInstallationPhase = "Failed"
+
+	// ClusterInstallationUninstalling means Kubewarden is being removed from a cluster that is no longer selected.
+	ClusterInstallationUninstalling ClusterInstallationPhase = "Uninstalling"
+)
+
+// ClusterInstallationStatus represents the state of Kubewarden on a specific cluster.
+type ClusterInstallationStatus struct {
+	// ClusterName is the name of the cluster where Kubewarden is installed.
+	ClusterName string `json:"clusterName"`
+
+	// ClusterNamespace is the namespace of the cluster resource.
+	ClusterNamespace string `json:"clusterNamespace"`
+
+	// InstalledVersion is the Kubewarden version installed on the cluster.
+	// +optional
+	InstalledVersion string `json:"installedVersion,omitempty"`
+
+	// AppliedHash is the hash of the Kubewarden manifests applied to the cluster. It changes with the version, the
+	// chart values and the settings of the addon.
+	// +optional
+	AppliedHash string `json:"appliedHash,omitempty"`
+
+	// Phase is the phase of the Kubewarden installation on the cluster.
+	// +optional
+	Phase ClusterInstallationPhase `json:"phase,omitempty"`
+
+	// LastError is the error of the last failed installation or upgrade attempt on the cluster.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+
+	// LastTransitionTime is the last time the phase transitioned.
+	// +optional
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// DriftedObjects is the number of Kubewarden objects that differed from their desired state during the last
+	// drift check and were corrected.
+	// +optional
+	DriftedObjects int32 `json:"driftedObjects,omitempty"`
+
+	// LastDriftTime is the last time drifted objects were detected and corrected on the cluster.
+	// +optional
+	LastDriftTime *metav1.Time `json:"lastDriftTime,omitempty"`
+
+	// HelmReleases are the Helm releases of the Kubewarden charts on the cluster, with the Helm install mode.
+	// +optional
+	HelmReleases []HelmReleaseStatus `json:"helmReleases,omitempty"`
+
+	// Conditions defines the state of Kubewarden on the cluster. The Ready condition reports whether the
+	// kubewarden-controller, its webhooks and the default PolicyServer are running, as of the last health check.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+}
+
+// HelmReleaseStatus is the state of a Helm release of a Kubewarden chart on a cluster.
+type HelmReleaseStatus struct {
+	// Name is the name of the Helm release.
+	Name string `json:"name"`
+
+	// Chart is the chart of the release, with its version, such as kubewarden-controller-3.1.0.
+	// +optional
+	Chart string `json:"chart,omitempty"`
+
+	// Revision is the revision of the release, increased by every install, upgrade or rollback.
+	// +optional
+	Revision int32 `json:"revision,omitempty"`
+
+	// Status is the Helm status of the revision, such as deployed or failed.
+	// +optional
+	Status string `json:"status,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.spec.version`
+// +kubebuilder:printcolumn:name="Ready",type=boolean,JSONPath=`.status.ready`
+// +kubebuilder:printcolumn:name="Clusters",type=integer,JSONPath=`.status.selectedClusters`
+// +kubebuilder:printcolumn:name="Ready Clusters",type=integer,JSONPath=`.status.readyClusters`
+// +kubebuilder:printcolumn:name="Failed Clusters",type=integer,JSONPath=`.status.failedClusters`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // KubewardenAddon is the Schema for the kubewardenaddons API.
 type KubewardenAddon struct {
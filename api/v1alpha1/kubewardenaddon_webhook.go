@@ -17,7 +17,14 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
@@ -41,8 +48,10 @@ var _ webhook.Defaulter = &KubewardenAddon{}
 func (p *KubewardenAddon) Default() {
 	kubewardenaddonlog.Info("default", "name", p.GetName())
 
+	// ImageRepository used to hold the full kubewarden-controller image reference, migrate it to its prefix
+	p.Spec.ImageRepository = p.Spec.ImageRepositoryPrefix()
 	if p.Spec.ImageRepository == "" {
-		p.Spec.ImageRepository = "ghcr.io/kubewarden/kubewarden-controller:v1.18.0"
+		p.Spec.ImageRepository = DefaultImageRepository
 	}
 
 	if p.Spec.Version == "" {
@@ -58,22 +67,238 @@ var _ webhook.Validator = &KubewardenAddon{}
 func (r *KubewardenAddon) ValidateCreate() (admission.Warnings, error) {
 	kubewardenaddonlog.Info("validate create", "name", r.GetName())
 
-	// TODO(user): fill in your validation logic upon object creation.
-	return nil, nil
+	return r.validateKubewardenAddon()
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
 func (r *KubewardenAddon) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
 	kubewardenaddonlog.Info("validate update", "name", r.GetName())
 
-	// TODO(user): fill in your validation logic upon object update.
-	return nil, nil
+	// Kubewarden installed in one mode can't be taken over by another one
+	if oldAddon, ok := old.(*KubewardenAddon); ok && oldAddon.installMode() != r.installMode() {
+		return nil, fmt.Errorf("installMode is immutable")
+	}
+
+	return r.validateKubewardenAddon()
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
 func (r *KubewardenAddon) ValidateDelete() (admission.Warnings, error) {
 	kubewardenaddonlog.Info("validate delete", "name", r.GetName())
 
-	// TODO(user): fill in your validation logic upon object deletion.
+	// No validation needed for delete
 	return nil, nil
 }
+
+// validateKubewardenAddon performs validation for KubewardenAddon.
+func (r *KubewardenAddon) validateKubewardenAddon() (admission.Warnings, error) {
+	var warnings admission.Warnings
+
+	// Validate image repository
+	if hasImageTagOrDigest(r.Spec.ImageRepository) {
+		return warnings, fmt.Errorf("imageRepository '%s' must be a registry and repository prefix without tag or digest", r.Spec.ImageRepository)
+	}
+
+	// Validate policy server replicas
+	if r.Spec.PolicyServerConfig.Replicas < 0 {
+		return warnings, fmt.Errorf("policyServerConfig.replicas must not be negative")
+	}
+
+	// Validate policy server resources
+	resources := r.Spec.PolicyServerConfig.Resources
+	if err := validateResourceQuantities("policyServerConfig.resources", resources.CPU, resources.Limits.CPU); err != nil {
+		return warnings, err
+	}
+	if err := validateResourceQuantities("policyServerConfig.resources", resources.Memory, resources.Limits.Memory); err != nil {
+		return warnings, err
+	}
+
+	// Validate audit scanner
+	auditScanner := r.Spec.AuditScanner
+	if auditScanner.Schedule != "" && !isCronSchedule(auditScanner.Schedule) {
+		return warnings, fmt.Errorf("auditScanner.schedule '%s' must be a cron schedule with five fields or a predefined schedule such as @hourly", auditScanner.Schedule)
+	}
+	if err := validateResourceQuantities("auditScanner.resources", auditScanner.Resources.CPU, auditScanner.Resources.Limits.CPU); err != nil {
+		return warnings, err
+	}
+	if err := validateResourceQuantities("auditScanner.resources", auditScanner.Resources.Memory, auditScanner.Resources.Limits.Memory); err != nil {
+		return warnings, err
+	}
+	for _, namespace := range auditScanner.SkipNamespaces {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return warnings, fmt.Errorf("auditScanner.skipNamespaces: invalid namespace '%s': %s", namespace, strings.Join(errs, ", "))
+		}
+	}
+
+	// Validate registries
+	if registries := r.Spec.Registries; registries != nil {
+		if registries.ImagePullSecret == "" && registries.SourcesFrom == nil {
+			return warnings, fmt.Errorf("registries must set imagePullSecret or sourcesFrom")
+		}
+		if registries.ImagePullSecret != "" {
+			if errs := validation.IsDNS1123Subdomain(registries.ImagePullSecret); len(errs) > 0 {
+				return warnings, fmt.Errorf("registries.imagePullSecret: invalid Secret name '%s': %s", registries.ImagePullSecret, strings.Join(errs, ", "))
+			}
+		}
+	}
+
+	// Validate artifact sources
+	if artifacts := r.Spec.Artifacts; artifacts != nil && artifacts.CRDs != nil {
+		crds := artifacts.CRDs
+		if crds.Type == CRDsSourceConfigMap {
+			if crds.ConfigMapName == "" {
+				return warnings, fmt.Errorf("artifacts.crds.configMapName is required with the ConfigMap type")
+			}
+			if errs := validation.IsDNS1123Subdomain(crds.ConfigMapName); len(errs) > 0 {
+				return warnings, fmt.Errorf("artifacts.crds.configMapName: invalid ConfigMap name '%s': %s", crds.ConfigMapName, strings.Join(errs, ", "))
+			}
+		} else if crds.ConfigMapName != "" {
+			return warnings, fmt.Errorf("artifacts.crds.configMapName is only used with the ConfigMap type")
+		}
+		if crds.URL != "" && crds.Type != CRDsSourceRelease {
+			return warnings, fmt.Errorf("artifacts.crds.url is only used with the Release type")
+		}
+		if crds.Digest != "" && crds.Type != CRDsSourceRelease {
+			return warnings, fmt.Errorf("artifacts.crds.digest is only used with the Release type")
+		}
+	}
+
+	// Validate scheduling
+	if len(r.Spec.Scheduling.PolicyServer.TopologySpreadConstraints) > 0 {
+		return warnings, fmt.Errorf("scheduling.policyServer.topologySpreadConstraints is not supported by the PolicyServer")
+	}
+
+	// Validate rollout strategy
+	if strategy := r.Spec.RolloutStrategy; strategy != nil {
+		if strategy.BatchSize != nil && strategy.MaxUnavailable != nil {
+			return warnings, fmt.Errorf("rolloutStrategy.batchSize and rolloutStrategy.maxUnavailable are mutually exclusive")
+		}
+		if err := validateRolloutSize("rolloutStrategy.batchSize", strategy.BatchSize); err != nil {
+			return warnings, err
+		}
+		if err := validateRolloutSize("rolloutStrategy.maxUnavailable", strategy.MaxUnavailable); err != nil {
+			return warnings, err
+		}
+		if strategy.SoakTime != nil && strategy.SoakTime.Duration < 0 {
+			return warnings, fmt.Errorf("rolloutStrategy.soakTime must not be negative")
+		}
+	}
+
+	// Validate install mode
+	if mode := r.installMode(); mode == InstallModeClusterResourceSet || mode == InstallModeHelmChartProxy {
+		// the clusters are selected by a label holding the name of the addon
+		if errs := validation.IsValidLabelValue(r.Name); len(errs) > 0 {
+			return warnings, fmt.Errorf("installMode %s requires a name that is a valid label value: %s", mode, strings.Join(errs, ", "))
+		}
+		// the shared ClusterResourceSet and HelmChartProxies reach every selected cluster at once
+		if r.Spec.RolloutStrategy != nil {
+			return warnings, fmt.Errorf("rolloutStrategy is not supported with the %s install mode", mode)
+		}
+	}
+	if r.installMode() == InstallModeHelmChartProxy {
+		// the charts are rendered by the Cluster API Addon Provider for Helm, settings applied to the rendered
+		// manifests can't be honoured
+		switch {
+		case !reflect.DeepEqual(r.Spec.Scheduling, SchedulingConfig{}):
+			return warnings, fmt.Errorf("scheduling is not supported with the HelmChartProxy install mode, set the chart values instead")
+		case len(r.Spec.AuditScanner.SkipNamespaces) > 0:
+			return warnings, fmt.Errorf("auditScanner.skipNamespaces is not supported with the HelmChartProxy install mode, set the chart values instead")
+		case r.Spec.VerificationConfig != nil:
+			return warnings, fmt.Errorf("verificationConfig is not supported with the HelmChartProxy install mode")
+		case r.Spec.Registries != nil:
+			return warnings, fmt.Errorf("registries is not supported with the HelmChartProxy install mode")
+		case r.Spec.Artifacts != nil && r.Spec.Artifacts.CRDs != nil && r.Spec.Artifacts.CRDs.Type != CRDsSourceChart:
+			return warnings, fmt.Errorf("artifacts.crds must use the Chart type with the HelmChartProxy install mode")
+		case r.Spec.DeselectionPolicy == DeselectionPolicyOrphan:
+			// the Cluster API Addon Provider for Helm uninstalls the charts from the clusters it no longer selects
+			return warnings, fmt.Errorf("deselectionPolicy Orphan is not supported with the HelmChartProxy install mode")
+		}
+		if !r.Spec.RemoveCRDs {
+			warnings = append(warnings, "the Kubewarden CRDs are removed along with the kubewarden-crds chart with the HelmChartProxy install mode, removeCRDs is ignored")
+		}
+	}
+
+	return warnings, nil
+}
+
+// installMode returns the install mode of the addon, Direct if unset.
+func (r *KubewardenAddon) installMode() InstallMode {
+	if r.Spec.InstallMode == "" {
+		return InstallModeDirect
+	}
+
+	return r.Spec.InstallMode
+}
+
+// validateRolloutSize checks that a number of clusters is at least one, or a percentage between 1% and 100%.
+func validateRolloutSize(path string, size *intstr.IntOrString) error {
+	if size == nil {
+		return nil
+	}
+
+	if size.Type == intstr.Int {
+		if size.IntValue() < 1 {
+			return fmt.Errorf("%s must be at least 1", path)
+		}
+
+		return nil
+	}
+
+	percent, err := intstr.GetScaledValueFromIntOrPercent(size, 100, false)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if percent < 1 || percent > 100 {
+		return fmt.Errorf("%s must be a percentage between 1%% and 100%%", path)
+	}
+
+	return nil
+}
+
+// validateResourceQuantities checks that the request and the limit of a resource are valid quantities, and that
+// the request does not exceed the limit.
+func validateResourceQuantities(path, request, limit string) error {
+	var requestQuantity, limitQuantity resource.Quantity
+	var err error
+
+	if request != "" {
+		if requestQuantity, err = resource.ParseQuantity(request); err != nil {
+			return fmt.Errorf("%s: invalid request '%s': %w", path, request, err)
+		}
+	}
+	if limit != "" {
+		if limitQuantity, err = resource.ParseQuantity(limit); err != nil {
+			return fmt.Errorf("%s.limits: invalid limit '%s': %w", path, limit, err)
+		}
+	}
+
+	if request != "" && limit != "" && requestQuantity.Cmp(limitQuantity) > 0 {
+		return fmt.Errorf("%s: request '%s' must not exceed limit '%s'", path, request, limit)
+	}
+
+	return nil
+}
+
+// isCronSchedule returns whether the schedule has the five fields of a cron schedule, or is a predefined schedule.
+func isCronSchedule(schedule string) bool {
+	if strings.HasPrefix(schedule, "@") {
+		return len(strings.Fields(schedule)) == 1
+	}
+
+	return len(strings.Fields(schedule)) == 5
+}
+
+// hasImageTagOrDigest returns whether an image reference has a tag or a digest. A colon in the first path component
+// is the port of the registry.
+func hasImageTagOrDigest(reference string) bool {
+	if strings.Contains(reference, "@") {
+		return true
+	}
+
+	slash := strings.LastIndex(reference, "/")
+	if slash < 0 {
+		return false
+	}
+
+	return strings.Contains(reference[slash+1:], ":")
+}
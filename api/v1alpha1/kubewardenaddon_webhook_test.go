@@ -0,0 +1,345 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var _ = Describe("KubewardenAddon Webhook", func() {
+	var addon *KubewardenAddon
+
+	BeforeEach(func() {
+		addon = &KubewardenAddon{
+			Spec: KubewardenAddonSpec{
+				PolicyServerConfig: PolicyServerConfig{
+					Replicas: 2,
+					Resources: ResourceRequirements{
+						CPU:    "100m",
+						Memory: "128Mi",
+						Limits: ResourceLimits{
+							CPU:    "500m",
+							Memory: "512Mi",
+						},
+					},
+				},
+			},
+		}
+	})
+
+	Context("When defaulting the image repository", func() {
+		It("should default to the upstream Kubewarden images", func() {
+			addon.Default()
+			Expect(addon.Spec.ImageRepository).To(Equal(DefaultImageRepository))
+		})
+
+		It("should migrate full kubewarden-controller image references to their prefix", func() {
+			addon.Spec.ImageRepository = "registry.example.com/kubewarden/kubewarden-controller:v1.18.0"
+			addon.Default()
+			Expect(addon.Spec.ImageRepository).To(Equal("registry.example.com/kubewarden"))
+		})
+
+		It("should keep registries with a port", func() {
+			addon.Spec.ImageRepository = "localhost:5000"
+			addon.Default()
+			Expect(addon.Spec.ImageRepository).To(Equal("localhost:5000"))
+			_, err := addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("When validating the image repository", func() {
+		It("should reject image repositories with a tag or digest", func() {
+			addon.Spec.ImageRepository = "registry.example.com/kubewarden:v1.18.0"
+			_, err := addon.ValidateCreate()
+			Expect(err).To(HaveOccurred())
+
+			addon.Spec.ImageRepository = "registry.example.com/kubewarden@sha256:0123"
+			_, err = addon.ValidateCreate()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("When validating the policy server config", func() {
+		It("should accept valid resource quantities", func() {
+			_, err := addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should reject unparseable resource quantities", func() {
+			addon.Spec.PolicyServerConfig.Resources.Memory = "lots"
+			_, err := addon.ValidateCreate()
+			Expect(err).To(HaveOccurred())
+
+			addon.Spec.PolicyServerConfig.Resources.Memory = "128Mi"
+			addon.Spec.PolicyServerConfig.Resources.Limits.CPU = "1 core"
+			_, err = addon.ValidateUpdate(addon)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should reject requests exceeding limits", func() {
+			addon.Spec.PolicyServerConfig.Resources.CPU = "1"
+			_, err := addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("must not exceed limit")))
+		})
+
+		It("should reject negative replicas", func() {
+			addon.Spec.PolicyServerConfig.Replicas = -1
+			_, err := addon.ValidateCreate()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("When validating the rollout strategy", func() {
+		It("should accept a batch size or a max unavailable", func() {
+			batchSize := intstr.FromString("25%")
+			addon.Spec.RolloutStrategy = &RolloutStrategy{BatchSize: &batchSize, OrderByLabel: "wave"}
+			_, err := addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+
+			maxUnavailable := intstr.FromInt32(2)
+			addon.Spec.RolloutStrategy = &RolloutStrategy{MaxUnavailable: &maxUnavailable}
+			_, err = addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should reject invalid sizes", func() {
+			batchSize := intstr.FromString("0%")
+			addon.Spec.RolloutStrategy = &RolloutStrategy{BatchSize: &batchSize}
+			_, err := addon.ValidateCreate()
+			Expect(err).To(HaveOccurred())
+
+			batchSize = intstr.FromString("half")
+			_, err = addon.ValidateCreate()
+			Expect(err).To(HaveOccurred())
+
+			maxUnavailable := intstr.FromInt32(0)
+			addon.Spec.RolloutStrategy = &RolloutStrategy{MaxUnavailable: &maxUnavailable}
+			_, err = addon.ValidateCreate()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should reject both a batch size and a max unavailable", func() {
+			size := intstr.FromInt32(1)
+			addon.Spec.RolloutStrategy = &RolloutStrategy{BatchSize: &size, MaxUnavailable: &size}
+			_, err := addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("mutually exclusive")))
+		})
+	})
+
+	Context("When validating the audit scanner config", func() {
+		It("should accept cron and predefined schedules", func() {
+			addon.Spec.AuditScanner.Schedule = "*/30 * * * *"
+			_, err := addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+
+			addon.Spec.AuditScanner.Schedule = "@daily"
+			_, err = addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should reject invalid schedules", func() {
+			addon.Spec.AuditScanner.Schedule = "every hour"
+			_, err := addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("auditScanner.schedule")))
+		})
+
+		It("should reject invalid resources and namespaces", func() {
+			addon.Spec.AuditScanner.Resources.Memory = "1Gi"
+			addon.Spec.AuditScanner.Resources.Limits.Memory = "512Mi"
+			_, err := addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("must not exceed limit")))
+
+			addon.Spec.AuditScanner.Resources = ResourceRequirements{}
+			addon.Spec.AuditScanner.SkipNamespaces = []string{"kube-public", "Not_A_Namespace"}
+			_, err = addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("Not_A_Namespace")))
+		})
+	})
+
+	Context("When validating the registries", func() {
+		It("should accept image pull secrets and sources", func() {
+			addon.Spec.Registries = &RegistriesConfig{ImagePullSecret: "registry-credentials"}
+			_, err := addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+
+			addon.Spec.Registries = &RegistriesConfig{SourcesFrom: &SourcesReference{Name: "registry-sources"}}
+			_, err = addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should reject empty registries and invalid Secret names", func() {
+			addon.Spec.Registries = &RegistriesConfig{}
+			_, err := addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("imagePullSecret or sourcesFrom")))
+
+			addon.Spec.Registries.ImagePullSecret = "Registry_Credentials"
+			_, err = addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("registries.imagePullSecret")))
+		})
+	})
+
+	Context("When validating the artifact sources", func() {
+		It("should accept mirrored charts and CRDs", func() {
+			addon.Spec.Artifacts = &ArtifactsConfig{
+				ChartRepository: "oci://registry.example.com/kubewarden/charts",
+				CRDs: &CRDsSource{
+					Type:   CRDsSourceRelease,
+					URL:    "https://mirror.example.com/kubewarden",
+					Digest: "sha256:" + strings.Repeat("a", 64),
+				},
+			}
+			_, err := addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+
+			addon.Spec.Artifacts.CRDs = &CRDsSource{Type: CRDsSourceConfigMap, ConfigMapName: "kubewarden-crds"}
+			_, err = addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should reject settings of other CRDs sources", func() {
+			addon.Spec.Artifacts = &ArtifactsConfig{CRDs: &CRDsSource{Type: CRDsSourceConfigMap}}
+			_, err := addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("artifacts.crds.configMapName is required")))
+
+			addon.Spec.Artifacts.CRDs = &CRDsSource{Type: CRDsSourceChart, ConfigMapName: "kubewarden-crds"}
+			_, err = addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("only used with the ConfigMap type")))
+
+			addon.Spec.Artifacts.CRDs = &CRDsSource{Type: CRDsSourceChart, URL: "https://mirror.example.com/kubewarden"}
+			_, err = addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("only used with the Release type")))
+
+			addon.Spec.Artifacts.CRDs = &CRDsSource{Type: CRDsSourceChart, Digest: "sha256:" + strings.Repeat("a", 64)}
+			_, err = addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("artifacts.crds.digest is only used with the Release type")))
+		})
+	})
+
+	Context("When validating the install mode", func() {
+		It("should keep the install mode of the addon", func() {
+			addon.Name = "kubewarden"
+			addon.Spec.InstallMode = InstallModeClusterResourceSet
+			_, err := addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+
+			updated := addon.DeepCopy()
+			_, err = updated.ValidateUpdate(addon)
+			Expect(err).NotTo(HaveOccurred())
+
+			updated.Spec.InstallMode = InstallModeDirect
+			_, err = updated.ValidateUpdate(addon)
+			Expect(err).To(MatchError(ContainSubstring("installMode is immutable")))
+
+			// unset and Direct are the same mode
+			addon.Spec.InstallMode = ""
+			_, err = updated.ValidateUpdate(addon)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should require a name usable as a label value", func() {
+			addon.Name = strings.Repeat("kubewarden", 7)
+			_, err := addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+
+			addon.Spec.InstallMode = InstallModeHelm
+			_, err = addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+
+			addon.Spec.InstallMode = InstallModeHelmChartProxy
+			_, err = addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("requires a name that is a valid label value")))
+		})
+
+		It("should only accept a rollout strategy with the Direct and Helm install modes", func() {
+			batchSize := intstr.FromInt32(1)
+			addon.Name = "kubewarden"
+			addon.Spec.RolloutStrategy = &RolloutStrategy{BatchSize: &batchSize}
+			addon.Spec.InstallMode = InstallModeHelm
+			_, err := addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+
+			addon.Spec.InstallMode = InstallModeClusterResourceSet
+			_, err = addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("rolloutStrategy is not supported")))
+
+			addon.Spec.InstallMode = InstallModeHelmChartProxy
+			_, err = addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("rolloutStrategy is not supported")))
+		})
+
+		It("should reject the settings applied to rendered manifests with HelmChartProxy", func() {
+			addon.Spec.InstallMode = InstallModeHelmChartProxy
+			addon.Spec.Artifacts = &ArtifactsConfig{CRDs: &CRDsSource{Type: CRDsSourceChart}}
+			_, err := addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+
+			addon.Spec.Scheduling.TolerateControlPlane = true
+			_, err = addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("scheduling is not supported")))
+
+			addon.Spec.Scheduling = SchedulingConfig{}
+			addon.Spec.Registries = &RegistriesConfig{ImagePullSecret: "registry-credentials"}
+			_, err = addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("registries is not supported")))
+
+			addon.Spec.Registries = nil
+			addon.Spec.Artifacts.CRDs.Type = CRDsSourceRelease
+			_, err = addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("artifacts.crds must use the Chart type")))
+		})
+
+		It("should reject orphaning clusters with HelmChartProxy", func() {
+			addon.Spec.InstallMode = InstallModeHelmChartProxy
+			warnings, err := addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElement(ContainSubstring("removeCRDs is ignored")))
+
+			addon.Spec.RemoveCRDs = true
+			warnings, err = addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(BeEmpty())
+
+			addon.Spec.DeselectionPolicy = DeselectionPolicyOrphan
+			_, err = addon.ValidateCreate()
+			Expect(err).To(MatchError(ContainSubstring("deselectionPolicy Orphan is not supported")))
+		})
+	})
+
+	Context("When validating the scheduling", func() {
+		It("should reject topology spread constraints on the policy server", func() {
+			constraints := []corev1.TopologySpreadConstraint{{
+				MaxSkew:           1,
+				TopologyKey:       "topology.kubernetes.io/zone",
+				WhenUnsatisfiable: corev1.DoNotSchedule,
+			}}
+
+			addon.Spec.Scheduling.Controller.TopologySpreadConstraints = constraints
+			_, err := addon.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+
+			addon.Spec.Scheduling.PolicyServer.TopologySpreadConstraints = constraints
+			_, err = addon.ValidateCreate()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
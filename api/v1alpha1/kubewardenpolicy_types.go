@@ -23,6 +23,10 @@ import (
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
+// KubewardenPolicyFinalizer allows the KubewardenPolicy controller to remove the policy from the workload clusters
+// before the KubewardenPolicy is removed.
+const KubewardenPolicyFinalizer = "kubewardenpolicy.addon.cluster.x-k8s.io"
+
 // KubewardenPolicySpec defines the desired state of KubewardenPolicy.
 type KubewardenPolicySpec struct {
 	// ClusterSelector selects Clusters in the same namespace with a label that matches the specified label selector.
@@ -82,6 +86,11 @@ type KubewardenPolicySpec struct {
 	// This is an optional advanced feature.
 	// +optional
 	MatchConditions []MatchCondition `json:"matchConditions,omitempty"`
+
+	// Paused stops the reconciliation of the KubewardenPolicy, so the policy is left untouched on the workload
+	// clusters.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
 }
 
 // PolicyRule defines the scope of a policy.
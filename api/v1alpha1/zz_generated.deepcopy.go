@@ -22,10 +22,108 @@ package v1alpha1
 
 import (
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArtifactsConfig) DeepCopyInto(out *ArtifactsConfig) {
+	*out = *in
+	if in.CRDs != nil {
+		in, out := &in.CRDs, &out.CRDs
+		*out = new(CRDsSource)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArtifactsConfig.
+func (in *ArtifactsConfig) DeepCopy() *ArtifactsConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ArtifactsConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuditScannerConfig) DeepCopyInto(out *AuditScannerConfig) {
+	*out = *in
+	if in.Enabled != nil {
+		in, out := &in.Enabled, &out.Enabled
+		*out = new(bool)
+		**out = **in
+	}
+	out.Resources = in.Resources
+	if in.SkipNamespaces != nil {
+		in, out := &in.SkipNamespaces, &out.SkipNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuditScannerConfig.
+func (in *AuditScannerConfig) DeepCopy() *AuditScannerConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AuditScannerConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CRDsSource) DeepCopyInto(out *CRDsSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CRDsSource.
+func (in *CRDsSource) DeepCopy() *CRDsSource {
+	if in == nil {
+		return nil
+	}
+	out := new(CRDsSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterInstallationStatus) DeepCopyInto(out *ClusterInstallationStatus) {
+	*out = *in
+	if in.LastTransitionTime != nil {
+		in, out := &in.LastTransitionTime, &out.LastTransitionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastDriftTime != nil {
+		in, out := &in.LastDriftTime, &out.LastDriftTime
+		*out = (*in).DeepCopy()
+	}
+	if in.HelmReleases != nil {
+		in, out := &in.HelmReleases, &out.HelmReleases
+		*out = make([]HelmReleaseStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(v1beta1.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterInstallationStatus.
+func (in *ClusterInstallationStatus) DeepCopy() *ClusterInstallationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterInstallationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DeployedPolicyStatus) DeepCopyInto(out *DeployedPolicyStatus) {
 	*out = *in
@@ -45,6 +143,21 @@ func (in *DeployedPolicyStatus) DeepCopy() *DeployedPolicyStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HelmReleaseStatus) DeepCopyInto(out *HelmReleaseStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HelmReleaseStatus.
+func (in *HelmReleaseStatus) DeepCopy() *HelmReleaseStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(HelmReleaseStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KubewardenAddon) DeepCopyInto(out *KubewardenAddon) {
 	*out = *in
@@ -109,6 +222,35 @@ func (in *KubewardenAddonSpec) DeepCopyInto(out *KubewardenAddonSpec) {
 	*out = *in
 	in.ClusterSelector.DeepCopyInto(&out.ClusterSelector)
 	out.PolicyServerConfig = in.PolicyServerConfig
+	in.AuditScanner.DeepCopyInto(&out.AuditScanner)
+	if in.VerificationConfig != nil {
+		in, out := &in.VerificationConfig, &out.VerificationConfig
+		*out = new(VerificationConfigReference)
+		**out = **in
+	}
+	if in.Registries != nil {
+		in, out := &in.Registries, &out.Registries
+		*out = new(RegistriesConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Artifacts != nil {
+		in, out := &in.Artifacts, &out.Artifacts
+		*out = new(ArtifactsConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	in.ControllerValues.DeepCopyInto(&out.ControllerValues)
+	in.DefaultsValues.DeepCopyInto(&out.DefaultsValues)
+	if in.ValuesFrom != nil {
+		in, out := &in.ValuesFrom, &out.ValuesFrom
+		*out = make([]ValuesReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.RolloutStrategy != nil {
+		in, out := &in.RolloutStrategy, &out.RolloutStrategy
+		*out = new(RolloutStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Scheduling.DeepCopyInto(&out.Scheduling)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubewardenAddonSpec.
@@ -136,6 +278,18 @@ func (in *KubewardenAddonStatus) DeepCopyInto(out *KubewardenAddonStatus) {
 		*out = make([]v1.ObjectReference, len(*in))
 		copy(*out, *in)
 	}
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]ClusterInstallationStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(RolloutStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubewardenAddonStatus.
@@ -336,9 +490,45 @@ func (in *PolicyServerConfig) DeepCopy() *PolicyServerConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RegistriesConfig) DeepCopyInto(out *RegistriesConfig) {
+	*out = *in
+	if in.SourcesFrom != nil {
+		in, out := &in.SourcesFrom, &out.SourcesFrom
+		*out = new(SourcesReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistriesConfig.
+func (in *RegistriesConfig) DeepCopy() *RegistriesConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RegistriesConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceLimits) DeepCopyInto(out *ResourceLimits) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceLimits.
+func (in *ResourceLimits) DeepCopy() *ResourceLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceLimits)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ResourceRequirements) DeepCopyInto(out *ResourceRequirements) {
 	*out = *in
+	out.Limits = in.Limits
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceRequirements.
@@ -350,3 +540,157 @@ func (in *ResourceRequirements) DeepCopy() *ResourceRequirements {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutStatus) DeepCopyInto(out *RolloutStatus) {
+	*out = *in
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutStatus.
+func (in *RolloutStatus) DeepCopy() *RolloutStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutStrategy) DeepCopyInto(out *RolloutStrategy) {
+	*out = *in
+	if in.BatchSize != nil {
+		in, out := &in.BatchSize, &out.BatchSize
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.SoakTime != nil {
+		in, out := &in.SoakTime, &out.SoakTime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutStrategy.
+func (in *RolloutStrategy) DeepCopy() *RolloutStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Scheduling) DeepCopyInto(out *Scheduling) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(v1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TopologySpreadConstraints != nil {
+		in, out := &in.TopologySpreadConstraints, &out.TopologySpreadConstraints
+		*out = make([]v1.TopologySpreadConstraint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Scheduling.
+func (in *Scheduling) DeepCopy() *Scheduling {
+	if in == nil {
+		return nil
+	}
+	out := new(Scheduling)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SchedulingConfig) DeepCopyInto(out *SchedulingConfig) {
+	*out = *in
+	in.Controller.DeepCopyInto(&out.Controller)
+	in.PolicyServer.DeepCopyInto(&out.PolicyServer)
+	in.AuditScanner.DeepCopyInto(&out.AuditScanner)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchedulingConfig.
+func (in *SchedulingConfig) DeepCopy() *SchedulingConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SchedulingConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SourcesReference) DeepCopyInto(out *SourcesReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SourcesReference.
+func (in *SourcesReference) DeepCopy() *SourcesReference {
+	if in == nil {
+		return nil
+	}
+	out := new(SourcesReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ValuesReference) DeepCopyInto(out *ValuesReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValuesReference.
+func (in *ValuesReference) DeepCopy() *ValuesReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ValuesReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VerificationConfigReference) DeepCopyInto(out *VerificationConfigReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VerificationConfigReference.
+func (in *VerificationConfigReference) DeepCopy() *VerificationConfigReference {
+	if in == nil {
+		return nil
+	}
+	out := new(VerificationConfigReference)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -25,11 +25,14 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
@@ -40,6 +43,7 @@ import (
 	"github.com/caapkw/cluster-api-provider-addon-kubewarden/internal/controller"
 	policiesv1 "github.com/kubewarden/kubewarden-controller/api/policies/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1beta1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -54,6 +58,7 @@ func init() {
 	utilruntime.Must(addonv1alpha1.AddToScheme(scheme))
 	utilruntime.Must(policiesv1.AddToScheme(scheme))
 	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
+	utilruntime.Must(addonsv1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -63,6 +68,12 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var maxConcurrentClusterReconciles int
+	artifactSources := controller.DefaultArtifactSources()
+	var artifactCacheDir string
+	var artifactCacheMaxSize string
+	var fetcherOptions controller.FetcherOptions
+	var artifactMaxSize string
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -74,6 +85,34 @@ func main() {
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.IntVar(&maxConcurrentClusterReconciles, "max-concurrent-cluster-reconciles", controller.DefaultMaxConcurrentClusterReconciles,
+		"The maximum number of workload clusters of a KubewardenAddon that Kubewarden is installed on in parallel.")
+	flag.StringVar(&artifactSources.ChartRepository, "kubewarden-chart-repository", artifactSources.ChartRepository,
+		"The Helm repository or OCI registry (oci://) the Kubewarden charts are pulled from, unless set by the KubewardenAddon.")
+	flag.StringVar((*string)(&artifactSources.CRDsSource), "kubewarden-crds-source", string(artifactSources.CRDsSource),
+		"Where the Kubewarden CRDs are fetched from, unless set by the KubewardenAddon: "+
+			"Release downloads the release tarball, Chart renders the kubewarden-crds chart and Directory reads them "+
+			"from --kubewarden-crds-dir.")
+	flag.StringVar(&artifactSources.CRDsURL, "kubewarden-crds-url", artifactSources.CRDsURL,
+		"The base URL the Kubewarden release tarballs holding the CRDs are downloaded from with the Release source.")
+	flag.StringVar(&artifactSources.CRDsDir, "kubewarden-crds-dir", artifactSources.CRDsDir,
+		"The directory holding the Kubewarden CRDs with the Directory source, in a subdirectory per app version such as v1.18.0.")
+	flag.StringVar(&artifactCacheDir, "artifact-cache-dir", controller.DefaultArtifactCacheDir,
+		"The directory the downloaded Kubewarden charts and CRDs are cached in.")
+	flag.StringVar(&artifactCacheMaxSize, "artifact-cache-max-size",
+		resource.NewQuantity(controller.DefaultArtifactCacheMaxSize, resource.BinarySI).String(),
+		"The maximum size of the artifact cache, the least recently used artifacts are evicted beyond it.")
+	flag.DurationVar(&fetcherOptions.Timeout, "artifact-fetch-timeout", controller.DefaultFetchTimeout,
+		"The timeout of a single download of a Kubewarden chart, CRD tarball or chart repository index.")
+	flag.StringVar(&fetcherOptions.ProxyURL, "artifact-proxy-url", "",
+		"The URL of the HTTP(S) proxy the Kubewarden artifacts are downloaded through. "+
+			"Defaults to the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.")
+	flag.StringVar(&fetcherOptions.CABundle, "artifact-ca-bundle", "",
+		"The path of a PEM file holding CA certificates trusted when downloading the Kubewarden artifacts, "+
+			"on top of the system ones.")
+	flag.StringVar(&artifactMaxSize, "artifact-max-size",
+		resource.NewQuantity(controller.DefaultMaxArtifactSize, resource.BinarySI).String(),
+		"The maximum size of a downloaded Kubewarden artifact, and of the files extracted from it.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -82,6 +121,27 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if err := artifactSources.Validate(); err != nil {
+		setupLog.Error(err, "invalid Kubewarden artifact sources")
+		os.Exit(1)
+	}
+	cacheMaxSize, err := resource.ParseQuantity(artifactCacheMaxSize)
+	if err != nil || cacheMaxSize.Sign() <= 0 {
+		setupLog.Error(err, "invalid artifact cache max size", "size", artifactCacheMaxSize)
+		os.Exit(1)
+	}
+	maxSize, err := resource.ParseQuantity(artifactMaxSize)
+	if err != nil || maxSize.Sign() <= 0 {
+		setupLog.Error(err, "invalid artifact max size", "size", artifactMaxSize)
+		os.Exit(1)
+	}
+	fetcherOptions.MaxSize = maxSize.Value()
+	artifactFetcher, err := controller.NewArtifactFetcher(fetcherOptions)
+	if err != nil {
+		setupLog.Error(err, "unable to create the artifact fetcher")
+		os.Exit(1)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -118,6 +178,13 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "1cda3667.cluster.x-k8s.io",
+		Client: client.Options{
+			Cache: &client.CacheOptions{
+				// NOTE: ConfigMaps and Secrets, such as the kubeconfigs of the clusters, are read from the API server
+				// instead of caching every ConfigMap and Secret of the management cluster
+				DisableFor: []client.Object{&corev1.ConfigMap{}, &corev1.Secret{}},
+			},
+		},
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -128,8 +195,13 @@ func main() {
 	ctx := ctrl.SetupSignalHandler()
 
 	if err = (&controller.KubewardenAddonReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                         mgr.GetClient(),
+		APIReader:                      mgr.GetAPIReader(),
+		Scheme:                         mgr.GetScheme(),
+		MaxConcurrentClusterReconciles: maxConcurrentClusterReconciles,
+		ArtifactSources:                artifactSources,
+		ArtifactCache:                  controller.NewArtifactCache(artifactCacheDir, cacheMaxSize.Value()),
+		ArtifactFetcher:                artifactFetcher,
 	}).SetupWithManager(ctx, mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KubewardenAddon")
 		os.Exit(1)
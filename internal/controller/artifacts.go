@@ -0,0 +1,247 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+// CRDsSourceDirectory reads the Kubewarden CRDs from a directory of the manager, such as a mounted volume. It is
+// only available to the manager flags, addons can't read the filesystem of the manager.
+const CRDsSourceDirectory addonv1alpha1.CRDsSourceType = "Directory"
+
+// errArtifactsNotResolved is returned when the Kubewarden CRDs can't be read from the artifact sources of an
+// addon, such as a missing ConfigMap.
+var errArtifactsNotResolved = errors.New("artifacts not resolved")
+
+// ArtifactSources sets where the Kubewarden charts and CRDs are fetched from by default. Addons override them with
+// spec.artifacts.
+type ArtifactSources struct {
+	// ChartRepository is the URL of the Helm repository or OCI registry of the Kubewarden charts.
+	ChartRepository string
+
+	// CRDsSource is the kind of source of the CRDs: Release, Chart or Directory.
+	CRDsSource addonv1alpha1.CRDsSourceType
+
+	// CRDsURL is the base URL the release tarballs holding the CRDs are downloaded from.
+	CRDsURL string
+
+	// CRDsDir is the directory holding the CRDs with the Directory source, in a subdirectory per Kubewarden app
+	// version such as v1.18.0.
+	CRDsDir string
+}
+
+// DefaultArtifactSources returns the public sources of the Kubewarden artifacts.
+func DefaultArtifactSources() ArtifactSources {
+	return ArtifactSources{
+		ChartRepository: kubewardenHelmChartURL,
+		CRDsSource:      addonv1alpha1.CRDsSourceRelease,
+		CRDsURL:         kubewardenControllerRepository + "/" + githubReleasesPath,
+	}
+}
+
+// Validate checks the artifact sources set with the manager flags.
+func (s ArtifactSources) Validate() error {
+	switch s.CRDsSource {
+	case "", addonv1alpha1.CRDsSourceRelease, addonv1alpha1.CRDsSourceChart:
+	case CRDsSourceDirectory:
+		if s.CRDsDir == "" {
+			return fmt.Errorf("the %s CRDs source requires a CRDs directory", CRDsSourceDirectory)
+		}
+	default:
+		return fmt.Errorf("unsupported CRDs source %s, expected %s, %s or %s", s.CRDsSource,
+			addonv1alpha1.CRDsSourceRelease, addonv1alpha1.CRDsSourceChart, CRDsSourceDirectory)
+	}
+
+	return nil
+}
+
+// kubewardenArtifacts is where the Kubewarden artifacts of an addon are fetched from.
+type kubewardenArtifacts struct {
+	ArtifactSources
+
+	// CRDsConfigMap is the ConfigMap holding the CRDs with the ConfigMap source.
+	CRDsConfigMap types.NamespacedName
+
+	// CRDsDigest is the digest the release tarball must match with the Release source, if pinned.
+	CRDsDigest string
+}
+
+// kubewardenArtifacts returns where the Kubewarden artifacts of the addon are fetched from: the sources set in the
+// addon spec, falling back to the sources of the manager, then to the public ones.
+func (r *KubewardenAddonReconciler) kubewardenArtifacts(addon *addonv1alpha1.KubewardenAddon) *kubewardenArtifacts {
+	defaults := DefaultArtifactSources()
+	artifacts := &kubewardenArtifacts{ArtifactSources: r.ArtifactSources}
+	if artifacts.ChartRepository == "" {
+		artifacts.ChartRepository = defaults.ChartRepository
+	}
+	if artifacts.CRDsSource == "" {
+		artifacts.CRDsSource = defaults.CRDsSource
+	}
+	if artifacts.CRDsURL == "" {
+		artifacts.CRDsURL = defaults.CRDsURL
+	}
+
+	if config := addon.Spec.Artifacts; config != nil {
+		if config.ChartRepository != "" {
+			artifacts.ChartRepository = config.ChartRepository
+		}
+		if crds := config.CRDs; crds != nil {
+			artifacts.CRDsSource = crds.Type
+			if crds.URL != "" {
+				artifacts.CRDsURL = crds.URL
+			}
+			artifacts.CRDsDigest = crds.Digest
+			artifacts.CRDsConfigMap = types.NamespacedName{Name: crds.ConfigMapName, Namespace: addon.Namespace}
+		}
+	}
+
+	// the HelmChartProxy install mode installs the CRDs with the kubewarden-crds chart, whatever the manager sets
+	if addon.Spec.InstallMode == addonv1alpha1.InstallModeHelmChartProxy {
+		artifacts.CRDsSource = addonv1alpha1.CRDsSourceChart
+	}
+
+	return artifacts
+}
+
+// resolveRelease resolves the Kubewarden release of the given app version from the chart repository of the addon.
+func (r *KubewardenAddonReconciler) resolveRelease(ctx context.Context, addon *addonv1alpha1.KubewardenAddon, appVersion string) (*kubewardenRelease, error) {
+	artifacts := r.kubewardenArtifacts(addon)
+	release, err := resolveKubewardenRelease(ctx, kubewardenChartIndexes.get(artifacts.ChartRepository, r.artifactFetcher()), appVersion)
+	if err != nil {
+		return nil, err
+	}
+	release.Artifacts = artifacts
+
+	return release, nil
+}
+
+// loadKubewardenCRDs fetches and decodes the Kubewarden CRDs of the given release from its artifact sources.
+func (r *KubewardenAddonReconciler) loadKubewardenCRDs(ctx context.Context, release *kubewardenRelease) ([]client.Object, error) {
+	artifacts := release.Artifacts
+
+	switch artifacts.CRDsSource {
+	case addonv1alpha1.CRDsSourceChart:
+		if release.CRDsChartVersion == "" {
+			return nil, fmt.Errorf("%w: no %s chart for app version %s in %s", errArtifactsNotResolved,
+				kubewardenCRDsChartName, release.AppVersion, artifacts.ChartRepository)
+		}
+
+		return r.renderChartObjects(ctx, artifacts.ChartRepository, kubewardenCRDsChartName, release.CRDsChartVersion, nil)
+	case addonv1alpha1.CRDsSourceConfigMap:
+		return r.readConfigMapCRDs(ctx, artifacts.CRDsConfigMap)
+	case CRDsSourceDirectory:
+		return r.readDirectoryCRDs(filepath.Join(artifacts.CRDsDir, release.AppVersion))
+	default:
+		return r.downloadKubewardenCRDs(ctx, artifacts.CRDsURL, release.AppVersion, artifacts.CRDsDigest)
+	}
+}
+
+// readConfigMapCRDs decodes the CRDs held by the keys of the given ConfigMap, in the order of the keys.
+func (r *KubewardenAddonReconciler) readConfigMapCRDs(ctx context.Context, key types.NamespacedName) ([]client.Object, error) {
+	configMap := &corev1.ConfigMap{}
+	if err := r.apiReader().Get(ctx, key, configMap); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: CRDs ConfigMap %s not found", errArtifactsNotResolved, key.Name)
+		}
+
+		return nil, fmt.Errorf("getting CRDs ConfigMap %s: %w", key.Name, err)
+	}
+
+	manifests := map[string]string{}
+	for name, data := range configMap.Data {
+		manifests[name] = data
+	}
+	for name, data := range configMap.BinaryData {
+		manifests[name] = string(data)
+	}
+	names := make([]string, 0, len(manifests))
+	for name := range manifests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	crds := []client.Object{}
+	for _, name := range names {
+		objs, err := decodeObjects(strings.NewReader(manifests[name]))
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %s of ConfigMap %s: %w", errArtifactsNotResolved, name, key.Name, err)
+		}
+		crds = append(crds, objs...)
+	}
+
+	if err := checkCRDs(crds); err != nil {
+		return nil, fmt.Errorf("%w: ConfigMap %s: %w", errArtifactsNotResolved, key.Name, err)
+	}
+
+	return crds, nil
+}
+
+// readDirectoryCRDs decodes the CRDs held by the YAML files of the given directory.
+func (r *KubewardenAddonReconciler) readDirectoryCRDs(dir string) ([]client.Object, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("%w: CRDs directory: %w", errArtifactsNotResolved, err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("list CRDs files: %w", err)
+	}
+
+	crds := []client.Object{}
+	for _, file := range files {
+		objs, err := r.decodeManifest(file)
+		if err != nil {
+			return nil, fmt.Errorf("decode CRD from file %s: %w", file, err)
+		}
+		crds = append(crds, objs...)
+	}
+
+	if err := checkCRDs(crds); err != nil {
+		return nil, fmt.Errorf("%w: directory %s: %w", errArtifactsNotResolved, dir, err)
+	}
+
+	return crds, nil
+}
+
+// checkCRDs makes sure CRDs provided by the user only hold CRDs, they are applied to the clusters as is.
+func checkCRDs(objs []client.Object) error {
+	if len(objs) == 0 {
+		return fmt.Errorf("no CRDs found")
+	}
+
+	for _, obj := range objs {
+		if kind := obj.GetObjectKind().GroupVersionKind().Kind; kind != "CustomResourceDefinition" {
+			return fmt.Errorf("%s %s is not a CustomResourceDefinition", kind, obj.GetName())
+		}
+	}
+
+	return nil
+}
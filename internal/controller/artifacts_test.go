@@ -0,0 +1,152 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+const testPolicyServersCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: policyservers.policies.kubewarden.io
+spec:
+  group: policies.kubewarden.io
+  names:
+    kind: PolicyServer
+    plural: policyservers
+  scope: Cluster
+`
+
+var _ = Describe("Kubewarden artifacts", func() {
+	It("should fall back to the sources of the manager", func() {
+		addon := &addonv1alpha1.KubewardenAddon{ObjectMeta: metav1.ObjectMeta{Name: "addon", Namespace: "default"}}
+
+		artifacts := (&KubewardenAddonReconciler{}).kubewardenArtifacts(addon)
+		Expect(artifacts.ArtifactSources).To(Equal(DefaultArtifactSources()))
+
+		reconciler := &KubewardenAddonReconciler{ArtifactSources: ArtifactSources{
+			ChartRepository: "https://charts.example.com/kubewarden",
+			CRDsSource:      CRDsSourceDirectory,
+			CRDsDir:         "/kubewarden/crds",
+		}}
+		artifacts = reconciler.kubewardenArtifacts(addon)
+		Expect(artifacts.ChartRepository).To(Equal("https://charts.example.com/kubewarden"))
+		Expect(artifacts.CRDsSource).To(Equal(CRDsSourceDirectory))
+		Expect(artifacts.CRDsURL).To(Equal(DefaultArtifactSources().CRDsURL))
+
+		addon.Spec.Artifacts = &addonv1alpha1.ArtifactsConfig{
+			ChartRepository: "oci://registry.example.com/kubewarden",
+			CRDs:            &addonv1alpha1.CRDsSource{Type: addonv1alpha1.CRDsSourceConfigMap, ConfigMapName: "kubewarden-crds"},
+		}
+		artifacts = reconciler.kubewardenArtifacts(addon)
+		Expect(artifacts.ChartRepository).To(Equal("oci://registry.example.com/kubewarden"))
+		Expect(artifacts.CRDsSource).To(Equal(addonv1alpha1.CRDsSourceConfigMap))
+		Expect(artifacts.CRDsConfigMap).To(Equal(types.NamespacedName{Name: "kubewarden-crds", Namespace: "default"}))
+
+		// the CRDs are installed with the kubewarden-crds chart by the HelmChartProxy install mode
+		addon.Spec.Artifacts = nil
+		addon.Spec.InstallMode = addonv1alpha1.InstallModeHelmChartProxy
+		artifacts = reconciler.kubewardenArtifacts(addon)
+		Expect(artifacts.CRDsSource).To(Equal(addonv1alpha1.CRDsSourceChart))
+	})
+
+	It("should validate the sources of the manager", func() {
+		Expect(DefaultArtifactSources().Validate()).To(Succeed())
+		Expect(ArtifactSources{CRDsSource: CRDsSourceDirectory}.Validate()).To(MatchError(ContainSubstring("requires a CRDs directory")))
+		Expect(ArtifactSources{CRDsSource: addonv1alpha1.CRDsSourceConfigMap}.Validate()).To(MatchError(ContainSubstring("unsupported CRDs source")))
+	})
+
+	It("should read the CRDs from a directory", func() {
+		dir := GinkgoT().TempDir()
+		Expect(os.Mkdir(filepath.Join(dir, "v1.18.0"), 0o755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "v1.18.0", "policyservers.yaml"), []byte(testPolicyServersCRD), 0o600)).To(Succeed())
+
+		reconciler := &KubewardenAddonReconciler{}
+		crds, err := reconciler.loadKubewardenCRDs(ctx, &kubewardenRelease{
+			AppVersion: "v1.18.0",
+			Artifacts:  &kubewardenArtifacts{ArtifactSources: ArtifactSources{CRDsSource: CRDsSourceDirectory, CRDsDir: dir}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(crds).To(ConsistOf(HaveField("GetName()", "policyservers.policies.kubewarden.io")))
+
+		_, err = reconciler.loadKubewardenCRDs(ctx, &kubewardenRelease{
+			AppVersion: "v1.17.0",
+			Artifacts:  &kubewardenArtifacts{ArtifactSources: ArtifactSources{CRDsSource: CRDsSourceDirectory, CRDsDir: dir}},
+		})
+		Expect(err).To(MatchError(errArtifactsNotResolved))
+	})
+
+	It("should require the chart shipping the CRDs", func() {
+		_, err := (&KubewardenAddonReconciler{}).loadKubewardenCRDs(ctx, &kubewardenRelease{
+			AppVersion: "v1.18.0",
+			Artifacts:  &kubewardenArtifacts{ArtifactSources: ArtifactSources{CRDsSource: addonv1alpha1.CRDsSourceChart}},
+		})
+		Expect(err).To(MatchError(errArtifactsNotResolved))
+	})
+
+	Context("When the CRDs are read from a ConfigMap", func() {
+		var reconciler *KubewardenAddonReconciler
+		var release *kubewardenRelease
+
+		BeforeEach(func() {
+			reconciler = &KubewardenAddonReconciler{Client: k8sClient}
+			release = &kubewardenRelease{
+				AppVersion: "v1.18.0",
+				Artifacts: &kubewardenArtifacts{
+					ArtifactSources: ArtifactSources{CRDsSource: addonv1alpha1.CRDsSourceConfigMap},
+					CRDsConfigMap:   types.NamespacedName{Name: "kubewarden-crds", Namespace: "default"},
+				},
+			}
+		})
+
+		It("should read the CRDs of every key", func() {
+			configMap := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "kubewarden-crds", Namespace: "default"},
+				Data:       map[string]string{"policyservers.yaml": testPolicyServersCRD},
+			}
+			Expect(k8sClient.Create(ctx, configMap)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, configMap)).To(Succeed())
+			})
+
+			crds, err := reconciler.loadKubewardenCRDs(ctx, release)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(crds).To(ConsistOf(HaveField("GetName()", "policyservers.policies.kubewarden.io")))
+
+			configMap.Data["namespace.yaml"] = "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: kubewarden\n"
+			Expect(k8sClient.Update(ctx, configMap)).To(Succeed())
+			_, err = reconciler.loadKubewardenCRDs(ctx, release)
+			Expect(err).To(MatchError(ContainSubstring("Namespace kubewarden is not a CustomResourceDefinition")))
+			Expect(err).To(MatchError(errArtifactsNotResolved))
+		})
+
+		It("should fail on a missing ConfigMap", func() {
+			_, err := reconciler.loadKubewardenCRDs(ctx, release)
+			Expect(err).To(MatchError(errArtifactsNotResolved))
+		})
+	})
+})
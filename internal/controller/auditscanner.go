@@ -0,0 +1,181 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+// kubewardenAuditScannerName is the name of the audit-scanner CronJob and of its container
+const kubewardenAuditScannerName = "audit-scanner"
+
+// auditScannerValues returns the kubewarden-controller chart values of the audit scanner configuration. The
+// resources are set separately, under the resources values of the chart.
+func auditScannerValues(config addonv1alpha1.AuditScannerConfig) map[string]interface{} {
+	values := map[string]interface{}{}
+	if config.Enabled != nil {
+		values["enable"] = *config.Enabled
+	}
+	if config.Schedule != "" {
+		values["cronJob"] = map[string]interface{}{
+			"schedule": config.Schedule,
+		}
+	}
+
+	switch config.OutputMode {
+	case addonv1alpha1.AuditScannerOutputPolicyReports:
+		values["outputScan"] = false
+		values["disableStore"] = false
+	case addonv1alpha1.AuditScannerOutputStdout:
+		values["outputScan"] = true
+		values["disableStore"] = true
+	case addonv1alpha1.AuditScannerOutputBoth:
+		values["outputScan"] = true
+		values["disableStore"] = false
+	}
+
+	return values
+}
+
+// auditScannerResourcesValues returns the kubewarden-controller chart values of the audit scanner resources.
+func auditScannerResourcesValues(resources addonv1alpha1.ResourceRequirements) map[string]interface{} {
+	values := map[string]interface{}{}
+	if requests := resourceListValues(resources.CPU, resources.Memory); len(requests) > 0 {
+		values["requests"] = requests
+	}
+	if limits := resourceListValues(resources.Limits.CPU, resources.Limits.Memory); len(limits) > 0 {
+		values["limits"] = limits
+	}
+
+	return values
+}
+
+// applyAuditScannerSkipNamespaces adds the namespaces skipped by the audit scanner to the arguments of the rendered
+// audit-scanner CronJob. The flag can be repeated, so the namespaces skipped by the chart are kept.
+func applyAuditScannerSkipNamespaces(manifests *kubewardenManifests, namespaces []string) error {
+	if len(namespaces) == 0 {
+		return nil
+	}
+
+	for _, obj := range manifests.Controller {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok || u.GetKind() != "CronJob" {
+			continue
+		}
+
+		containersPath := append(append([]string{}, cronJobPodSpecPath...), "containers")
+		containers, found, err := unstructured.NestedSlice(u.Object, containersPath...)
+		if err != nil {
+			return fmt.Errorf("getting containers of CronJob %s: %w", u.GetName(), err)
+		}
+		if !found {
+			continue
+		}
+
+		for i := range containers {
+			container, ok := containers[i].(map[string]interface{})
+			if !ok || container["name"] != kubewardenAuditScannerName {
+				continue
+			}
+
+			args, _, err := unstructured.NestedStringSlice(container, "args")
+			if err != nil {
+				return fmt.Errorf("getting arguments of CronJob %s: %w", u.GetName(), err)
+			}
+			args = append(args, "--ignore-namespaces", strings.Join(namespaces, ","))
+			if err := unstructured.SetNestedStringSlice(container, args, "args"); err != nil {
+				return fmt.Errorf("setting arguments of CronJob %s: %w", u.GetName(), err)
+			}
+		}
+
+		if err := unstructured.SetNestedSlice(u.Object, containers, containersPath...); err != nil {
+			return fmt.Errorf("setting containers of CronJob %s: %w", u.GetName(), err)
+		}
+	}
+
+	return nil
+}
+
+// auditScannerRBACKinds are the kinds of the objects rendered along with the audit-scanner CronJob to run it.
+var auditScannerRBACKinds = []schema.GroupVersionKind{
+	corev1.SchemeGroupVersion.WithKind("ServiceAccount"),
+	rbacv1.SchemeGroupVersion.WithKind("Role"),
+	rbacv1.SchemeGroupVersion.WithKind("RoleBinding"),
+	rbacv1.SchemeGroupVersion.WithKind("ClusterRole"),
+	rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding"),
+}
+
+// removeDisabledAuditScanner deletes the audit-scanner CronJob, ServiceAccount and RBAC objects left on the cluster
+// once the audit scanner is no longer rendered, as disabling it does not remove them. Only the objects named after
+// the audit scanner and applied by the provider are deleted.
+func removeDisabledAuditScanner(ctx context.Context, remoteClient client.Client, manifests *kubewardenManifests) error {
+	for _, obj := range manifests.Controller {
+		if obj.GetObjectKind().GroupVersionKind().Kind == "CronJob" {
+			return nil
+		}
+	}
+
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      kubewardenAuditScannerName,
+			Namespace: kubewardenNamespace,
+		},
+	}
+	err := remoteClient.Delete(ctx, cronJob, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if err != nil && !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+		return fmt.Errorf("deleting audit scanner CronJob: %w", err)
+	}
+
+	for _, gvk := range auditScannerRBACKinds {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		opts := []client.ListOption{}
+		if !strings.HasPrefix(gvk.Kind, "Cluster") {
+			opts = append(opts, client.InNamespace(kubewardenNamespace))
+		}
+		if err := remoteClient.List(ctx, list, opts...); err != nil {
+			return fmt.Errorf("listing %s objects: %w", gvk.Kind, err)
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			if !strings.Contains(obj.GetName(), kubewardenAuditScannerName) || !isAppliedByKubewarden(obj) ||
+				isObjectRendered(manifests.Controller, gvk.Kind, obj.GetName()) {
+				continue
+			}
+			if _, err := deleteKubewardenObject(ctx, remoteClient, obj); err != nil {
+				return fmt.Errorf("deleting audit scanner %s %s: %w", gvk.Kind, obj.GetName(), err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+var _ = Describe("Kubewarden audit scanner", func() {
+	It("should keep the chart defaults when the audit scanner config is empty", func() {
+		values := kubewardenControllerValues(&addonv1alpha1.KubewardenAddon{})
+		Expect(values).NotTo(HaveKey("auditScanner"))
+		Expect(values).NotTo(HaveKey("resources"))
+	})
+
+	It("should map the audit scanner config to the chart values", func() {
+		enabled, disabled := true, false
+		addon := &addonv1alpha1.KubewardenAddon{
+			Spec: addonv1alpha1.KubewardenAddonSpec{
+				AuditScanner: addonv1alpha1.AuditScannerConfig{
+					Enabled:    &enabled,
+					Schedule:   "0 * * * *",
+					OutputMode: addonv1alpha1.AuditScannerOutputStdout,
+					Resources: addonv1alpha1.ResourceRequirements{
+						Memory: "64Mi",
+						Limits: addonv1alpha1.ResourceLimits{CPU: "500m"},
+					},
+				},
+			},
+		}
+
+		values := kubewardenControllerValues(addon)
+		Expect(values).To(HaveKeyWithValue("auditScanner", map[string]interface{}{
+			"enable":       true,
+			"cronJob":      map[string]interface{}{"schedule": "0 * * * *"},
+			"outputScan":   true,
+			"disableStore": true,
+		}))
+		Expect(values).To(HaveKeyWithValue("resources", map[string]interface{}{
+			"auditScanner": map[string]interface{}{
+				"requests": map[string]interface{}{"memory": "64Mi"},
+				"limits":   map[string]interface{}{"cpu": "500m"},
+			},
+		}))
+
+		addon.Spec.AuditScanner = addonv1alpha1.AuditScannerConfig{Enabled: &disabled}
+		Expect(kubewardenControllerValues(addon)).To(HaveKeyWithValue("auditScanner", map[string]interface{}{"enable": false}))
+	})
+
+	It("should add the skipped namespaces to the audit scanner arguments", func() {
+		cronJob := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"jobTemplate": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"template": map[string]interface{}{
+							"spec": map[string]interface{}{
+								"containers": []interface{}{
+									map[string]interface{}{
+										"name": kubewardenAuditScannerName,
+										"args": []interface{}{"--ignore-namespaces", "kube-system"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}}
+		cronJob.SetKind("CronJob")
+		manifests := &kubewardenManifests{Controller: []client.Object{cronJob}}
+
+		Expect(applyAuditScannerSkipNamespaces(manifests, []string{"monitoring", "logging"})).To(Succeed())
+
+		containers, _, _ := unstructured.NestedSlice(cronJob.Object, "spec", "jobTemplate", "spec", "template", "spec", "containers")
+		Expect(containers).To(ConsistOf(HaveKeyWithValue("args", []interface{}{
+			"--ignore-namespaces", "kube-system", "--ignore-namespaces", "monitoring,logging",
+		})))
+	})
+
+	It("should remove the audit scanner objects applied by the provider once it is disabled", func() {
+		newObject := func(apiVersion, kind, name, namespace string) *unstructured.Unstructured {
+			obj := &unstructured.Unstructured{}
+			obj.SetAPIVersion(apiVersion)
+			obj.SetKind(kind)
+			obj.SetName(name)
+			obj.SetNamespace(namespace)
+
+			return obj
+		}
+
+		Expect(createKubewardenNamespace(ctx, k8sClient)).To(Succeed())
+		applied := []*unstructured.Unstructured{
+			newObject("v1", "ServiceAccount", kubewardenAuditScannerName, kubewardenNamespace),
+			newObject("rbac.authorization.k8s.io/v1", "Role", kubewardenAuditScannerName+"-role", kubewardenNamespace),
+			newObject("rbac.authorization.k8s.io/v1", "ClusterRole", kubewardenAuditScannerName+"-cluster-role", ""),
+		}
+		for _, obj := range applied {
+			Expect(applyObject(ctx, k8sClient, obj.DeepCopy())).To(Succeed())
+		}
+		// created by somebody else, it is left alone
+		other := newObject("v1", "ServiceAccount", kubewardenAuditScannerName+"-other", kubewardenNamespace)
+		Expect(k8sClient.Create(ctx, other)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, other))).To(Succeed())
+		})
+
+		By("Keeping them while the audit scanner is rendered")
+		cronJob := newObject("batch/v1", "CronJob", kubewardenAuditScannerName, kubewardenNamespace)
+		Expect(removeDisabledAuditScanner(ctx, k8sClient, &kubewardenManifests{Controller: []client.Object{cronJob}})).To(Succeed())
+		for _, obj := range applied {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(obj), obj.DeepCopy())).To(Succeed())
+		}
+
+		By("Removing them once it is disabled")
+		Expect(removeDisabledAuditScanner(ctx, k8sClient, &kubewardenManifests{})).To(Succeed())
+		for _, obj := range applied {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(obj), obj.DeepCopy())
+			Expect(apierrors.IsNotFound(err)).To(BeTrue(), "%s %s should be deleted", obj.GetKind(), obj.GetName())
+		}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(other), other.DeepCopy())).To(Succeed())
+	})
+})
@@ -0,0 +1,307 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// DefaultArtifactCacheMaxSize is the default maximum size of the artifact cache, in bytes
+	DefaultArtifactCacheMaxSize = 512 << 20
+
+	artifactKindCRDs  = "crds"
+	artifactKindChart = "chart"
+)
+
+var (
+	artifactCacheHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "caapkw_artifact_cache_hits_total",
+		Help: "Number of Kubewarden artifacts served from the local cache, by kind of artifact.",
+	}, []string{"kind"})
+
+	artifactCacheMisses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "caapkw_artifact_cache_misses_total",
+		Help: "Number of Kubewarden artifacts downloaded because they were not in the local cache, by kind of artifact.",
+	}, []string{"kind"})
+
+	artifactCacheEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "caapkw_artifact_cache_evictions_total",
+		Help: "Number of Kubewarden artifacts evicted from the local cache to stay under its maximum size.",
+	})
+
+	artifactCacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "caapkw_artifact_cache_size_bytes",
+		Help: "Size of the Kubewarden artifacts held by the local cache.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(artifactCacheHits, artifactCacheMisses, artifactCacheEvictions, artifactCacheSize)
+}
+
+var (
+	// DefaultArtifactCacheDir is the default directory of the artifact cache
+	DefaultArtifactCacheDir = filepath.Join(os.TempDir(), "caapkw-artifacts")
+
+	// defaultArtifactCache is the artifact cache of the reconcilers that don't set one.
+	defaultArtifactCache = NewArtifactCache(DefaultArtifactCacheDir, DefaultArtifactCacheMaxSize)
+)
+
+// ArtifactCache is a content-addressed cache of the Kubewarden artifacts on the local disk. Artifacts are stored
+// by their SHA-256 digest, and referenced by the URL they were downloaded from, which includes their version. The
+// least recently used artifacts are evicted once the cache exceeds its maximum size, except the ones being read.
+type ArtifactCache struct {
+	dir     string
+	maxSize int64
+
+	mu sync.Mutex
+	// verified holds the digests of the artifacts checked since the cache was created, they are not hashed again
+	verified map[string]bool
+	// readers counts the readers of each artifact, artifacts are not evicted while they are read
+	readers map[string]int
+}
+
+// NewArtifactCache returns an artifact cache storing at most maxSize bytes in dir.
+func NewArtifactCache(dir string, maxSize int64) *ArtifactCache {
+	return &ArtifactCache{dir: dir, maxSize: maxSize, verified: map[string]bool{}, readers: map[string]int{}}
+}
+
+// fetch returns the path of the artifact downloaded from url, calling download to write it on a cache miss. When a
+// digest is given the artifact must match it. Artifacts cached by a previous run are verified again before being
+// served. The artifact is not evicted until the returned release function is called.
+func (c *ArtifactCache) fetch(kind, url, digest string, download func(io.Writer) error) (path string, release func(), err error) {
+	digest = strings.TrimPrefix(digest, "sha256:")
+
+	if path, release, ok := c.lookup(url, digest); ok {
+		artifactCacheHits.WithLabelValues(kind).Inc()
+		return path, release, nil
+	}
+	artifactCacheMisses.WithLabelValues(kind).Inc()
+
+	tmpDir := filepath.Join(c.dir, "tmp")
+	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
+		return "", nil, fmt.Errorf("creating artifact cache: %w", err)
+	}
+	tmpFile, err := os.CreateTemp(tmpDir, "artifact-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("creating artifact file: %w", err)
+	}
+	defer func() {
+		// the file is moved to the cache once stored
+		if err == nil {
+			return
+		}
+		if removeErr := os.Remove(tmpFile.Name()); removeErr != nil && !os.IsNotExist(removeErr) {
+			err = errors.Join(err, fmt.Errorf("removing artifact file: %w", removeErr))
+		}
+	}()
+
+	hash := sha256.New()
+	err = download(io.MultiWriter(tmpFile, hash))
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("downloading %s: %w", url, err)
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if digest != "" && actual != digest {
+		return "", nil, fmt.Errorf("%w: %s has digest sha256:%s, expected sha256:%s", errArtifactsNotResolved, url, actual, digest)
+	}
+
+	return c.store(url, actual, tmpFile.Name())
+}
+
+// lookup returns the path of the cached artifact downloaded from url, if it is cached and matches the digest, and
+// the function releasing it. Artifacts are only hashed the first time they are served, outside of the lock.
+func (c *ArtifactCache) lookup(url, digest string) (string, func(), bool) {
+	ref, err := os.ReadFile(c.refPath(url))
+	if err != nil {
+		return "", nil, false
+	}
+	cached := strings.TrimSpace(string(ref))
+	if digest != "" && cached != digest {
+		return "", nil, false
+	}
+
+	// the artifact can't be evicted from now on
+	c.mu.Lock()
+	verified := c.verified[cached]
+	c.readers[cached]++
+	c.mu.Unlock()
+	release := sync.OnceFunc(func() { c.release(cached) })
+
+	path := c.blobPath(cached)
+	if !verified {
+		actual, err := fileDigest(path)
+		if err != nil || actual != cached {
+			// evicted or corrupted, downloaded again
+			release()
+			_ = os.Remove(path)
+			return "", nil, false
+		}
+
+		c.mu.Lock()
+		c.verified[cached] = true
+		c.mu.Unlock()
+	}
+
+	// keep recently used artifacts from being evicted
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		c.mu.Lock()
+		delete(c.verified, cached)
+		c.mu.Unlock()
+		release()
+		return "", nil, false
+	}
+
+	return path, release, true
+}
+
+// release marks the artifact as no longer read by one of its readers.
+func (c *ArtifactCache) release(digest string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readers[digest]--
+	if c.readers[digest] <= 0 {
+		delete(c.readers, digest)
+	}
+}
+
+// store moves the downloaded artifact, whose digest was computed while downloading it, to the cache, references it
+// by its URL and evicts the least recently used artifacts if the cache grew too large. It returns the path of the
+// artifact and the function releasing it.
+func (c *ArtifactCache) store(url, digest, downloaded string) (string, func(), error) {
+	path := c.blobPath(digest)
+	for _, dir := range []string{filepath.Dir(path), filepath.Dir(c.refPath(url))} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", nil, fmt.Errorf("creating artifact cache: %w", err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Rename(downloaded, path); err != nil {
+		return "", nil, fmt.Errorf("storing artifact: %w", err)
+	}
+	if err := os.WriteFile(c.refPath(url), []byte(digest), 0o644); err != nil {
+		return "", nil, fmt.Errorf("storing artifact reference: %w", err)
+	}
+	c.verified[digest] = true
+	c.readers[digest]++
+	release := sync.OnceFunc(func() { c.release(digest) })
+
+	if err := c.evict(); err != nil {
+		c.readers[digest]--
+		return "", nil, fmt.Errorf("evicting artifacts: %w", err)
+	}
+
+	return path, release, nil
+}
+
+// evict removes the least recently used artifacts that are not being read until the cache fits in its maximum
+// size. References to evicted artifacts are left behind, they are treated as misses. The caller must hold c.mu.
+func (c *ArtifactCache) evict() error {
+	blobs, err := filepath.Glob(filepath.Join(c.dir, "blobs", "sha256", "*"))
+	if err != nil {
+		return err
+	}
+
+	type blob struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	cached := []blob{}
+	size := int64(0)
+	for _, path := range blobs {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		cached = append(cached, blob{path: path, size: info.Size(), modTime: info.ModTime()})
+		size += info.Size()
+	}
+
+	sort.Slice(cached, func(i, j int) bool {
+		return cached[i].modTime.Before(cached[j].modTime)
+	})
+	for _, blob := range cached {
+		if size <= c.maxSize {
+			break
+		}
+		digest := filepath.Base(blob.path)
+		if c.readers[digest] > 0 {
+			continue
+		}
+		if err := os.Remove(blob.path); err != nil {
+			return err
+		}
+		delete(c.verified, digest)
+		size -= blob.size
+		artifactCacheEvictions.Inc()
+	}
+	artifactCacheSize.Set(float64(size))
+
+	return nil
+}
+
+func (c *ArtifactCache) blobPath(digest string) string {
+	return filepath.Join(c.dir, "blobs", "sha256", digest)
+}
+
+// refPath returns the path of the reference to the artifact downloaded from url, named after the digest of the URL
+// so any URL makes a valid file name.
+func (c *ArtifactCache) refPath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+
+	return filepath.Join(c.dir, "refs", hex.EncodeToString(sum[:]))
+}
+
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	// nothing was written to the file, closing it can't lose data
+	defer func() { _ = file.Close() }()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
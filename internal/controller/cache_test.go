@@ -0,0 +1,162 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Artifact cache", func() {
+	var cache *ArtifactCache
+	var dir string
+	var downloads int
+
+	// download returns a download function writing the given content and counting the downloads.
+	download := func(content string) func(io.Writer) error {
+		return func(w io.Writer) error {
+			downloads++
+			_, err := io.WriteString(w, content)
+			return err
+		}
+	}
+
+	digest := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	// fetch fetches the artifact and releases it right away, so it can be evicted.
+	fetch := func(kind, url, digest string, download func(io.Writer) error) (string, error) {
+		path, release, err := cache.fetch(kind, url, digest, download)
+		if err != nil {
+			return "", err
+		}
+		release()
+		return path, nil
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		cache = NewArtifactCache(dir, 1024)
+		downloads = 0
+	})
+
+	It("should download artifacts once", func() {
+		path, err := fetch(artifactKindCRDs, "https://example.com/v1.18.0/CRDS.tar.gz", "", download("v1.18.0"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.ReadFile(path)).To(BeEquivalentTo("v1.18.0"))
+
+		cached, err := fetch(artifactKindCRDs, "https://example.com/v1.18.0/CRDS.tar.gz", digest("v1.18.0"), download("v1.18.0"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cached).To(Equal(path))
+		Expect(downloads).To(Equal(1))
+
+		_, err = fetch(artifactKindCRDs, "https://example.com/v1.17.0/CRDS.tar.gz", "", download("v1.17.0"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(downloads).To(Equal(2))
+	})
+
+	It("should reject artifacts not matching the digest", func() {
+		_, err := fetch(artifactKindCRDs, "https://example.com/v1.18.0/CRDS.tar.gz", digest("v1.17.0"), download("v1.18.0"))
+		Expect(err).To(MatchError(errArtifactsNotResolved))
+		Expect(err).To(MatchError(ContainSubstring("expected " + digest("v1.17.0"))))
+
+		// nothing is cached, a cached artifact not matching a pinned digest is downloaded again
+		path, err := fetch(artifactKindCRDs, "https://example.com/v1.18.0/CRDS.tar.gz", "", download("v1.18.0"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fetch(artifactKindCRDs, "https://example.com/v1.18.0/CRDS.tar.gz", strings.TrimPrefix(digest("v1.17.0"), "sha256:"), download("v1.18.0"))
+		Expect(err).To(MatchError(errArtifactsNotResolved))
+		Expect(downloads).To(Equal(3))
+		Expect(path).To(BeAnExistingFile())
+		Expect(filepath.Glob(filepath.Join(dir, "tmp", "*"))).To(BeEmpty())
+	})
+
+	It("should only verify artifacts once", func() {
+		path, err := fetch(artifactKindChart, "https://example.com/kubewarden-controller-3.1.0.tgz", "", download("3.1.0"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(path, []byte("corrupted"), 0o644)).To(Succeed())
+
+		// the artifact was verified when stored, it is not hashed again
+		_, err = fetch(artifactKindChart, "https://example.com/kubewarden-controller-3.1.0.tgz", "", download("3.1.0"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(downloads).To(Equal(1))
+	})
+
+	It("should download corrupted artifacts again after a restart", func() {
+		path, err := fetch(artifactKindChart, "https://example.com/kubewarden-controller-3.1.0.tgz", "", download("3.1.0"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.WriteFile(path, []byte("corrupted"), 0o644)).To(Succeed())
+
+		cache = NewArtifactCache(dir, 1024)
+		path, err = fetch(artifactKindChart, "https://example.com/kubewarden-controller-3.1.0.tgz", "", download("3.1.0"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.ReadFile(path)).To(BeEquivalentTo("3.1.0"))
+		Expect(downloads).To(Equal(2))
+	})
+
+	It("should evict the least recently used artifacts", func() {
+		large := func(version string) string {
+			return version + strings.Repeat("x", 400)
+		}
+
+		first, err := fetch(artifactKindChart, "https://example.com/kubewarden-controller-3.0.0.tgz", "", download(large("3.0.0")))
+		Expect(err).NotTo(HaveOccurred())
+		second, err := fetch(artifactKindChart, "https://example.com/kubewarden-controller-3.1.0.tgz", "", download(large("3.1.0")))
+		Expect(err).NotTo(HaveOccurred())
+		// the first artifact is now the most recently used
+		_, err = fetch(artifactKindChart, "https://example.com/kubewarden-controller-3.0.0.tgz", "", download(large("3.0.0")))
+		Expect(err).NotTo(HaveOccurred())
+
+		third, err := fetch(artifactKindChart, "https://example.com/kubewarden-controller-3.2.0.tgz", "", download(large("3.2.0")))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first).To(BeAnExistingFile())
+		Expect(second).NotTo(BeAnExistingFile())
+		Expect(third).To(BeAnExistingFile())
+		Expect(downloads).To(Equal(3))
+
+		_, err = fetch(artifactKindChart, "https://example.com/kubewarden-controller-3.1.0.tgz", "", download(large("3.1.0")))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(downloads).To(Equal(4))
+	})
+
+	It("should not evict the artifacts being read", func() {
+		large := func(version string) string {
+			return version + strings.Repeat("x", 400)
+		}
+
+		first, release, err := cache.fetch(artifactKindChart, "https://example.com/kubewarden-controller-3.0.0.tgz", "", download(large("3.0.0")))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fetch(artifactKindChart, "https://example.com/kubewarden-controller-3.1.0.tgz", "", download(large("3.1.0")))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fetch(artifactKindChart, "https://example.com/kubewarden-controller-3.2.0.tgz", "", download(large("3.2.0")))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first).To(BeAnExistingFile())
+
+		release()
+		_, err = fetch(artifactKindChart, "https://example.com/kubewarden-controller-3.3.0.tgz", "", download(large("3.3.0")))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first).NotTo(BeAnExistingFile())
+	})
+})
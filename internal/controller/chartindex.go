@@ -0,0 +1,378 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	kubewardenControllerChartName = "kubewarden-controller"
+	kubewardenDefaultsChartName   = "kubewarden-defaults"
+	kubewardenCRDsChartName       = "kubewarden-crds"
+
+	latestKubewardenVersion = "latest"
+
+	chartIndexTTL = 15 * time.Minute
+)
+
+// errChartNotFound is returned when the chart repository has no chart matching a Kubewarden app version.
+var errChartNotFound = errors.New("no compatible chart found")
+
+// kubewardenChartIndexes holds the indexes of the chart repositories the addons fetch Kubewarden from, shared by
+// all reconciles.
+var kubewardenChartIndexes = &chartRepositoryIndexes{ttl: chartIndexTTL, indexes: map[chartRepositoryKey]*chartRepositoryIndex{}}
+
+// kubewardenRelease holds the versions of the artifacts that make up a Kubewarden release.
+type kubewardenRelease struct {
+	// AppVersion is the Kubewarden app version, used to fetch the CRDs.
+	AppVersion string
+
+	// ControllerChartVersion is the version of the kubewarden-controller chart shipping AppVersion.
+	ControllerChartVersion string
+
+	// DefaultsChartVersion is the version of the kubewarden-defaults chart shipping AppVersion.
+	DefaultsChartVersion string
+
+	// CRDsChartVersion is the version of the kubewarden-crds chart shipping AppVersion, empty when the chart
+	// repository has none.
+	CRDsChartVersion string
+
+	// Artifacts is where the charts and the CRDs of the release are fetched from.
+	Artifacts *kubewardenArtifacts
+}
+
+// chartRepositoryIndexes holds one index per chart repository and artifact fetcher.
+type chartRepositoryIndexes struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	indexes map[chartRepositoryKey]*chartRepositoryIndex
+}
+
+type chartRepositoryKey struct {
+	repoURL string
+	fetcher *ArtifactFetcher
+}
+
+// get returns the index of the given chart repository, downloaded with the given fetcher.
+func (c *chartRepositoryIndexes) get(repoURL string, fetcher *ArtifactFetcher) *chartRepositoryIndex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := chartRepositoryKey{repoURL: repoURL, fetcher: fetcher}
+	index, ok := c.indexes[key]
+	if !ok {
+		index = newChartRepositoryIndex(repoURL, c.ttl, fetcher)
+		c.indexes[key] = index
+	}
+
+	return index
+}
+
+// chartRepositoryIndex downloads the index of a Helm chart repository and caches it for a while. The index of an
+// OCI registry is built from the tags of the Kubewarden charts.
+type chartRepositoryIndex struct {
+	repoURL string
+	ttl     time.Duration
+	fetcher *ArtifactFetcher
+
+	mu        sync.Mutex
+	index     *repo.IndexFile
+	fetchedAt time.Time
+
+	// chartMetadata is only used by OCI registries
+	chartMetadata map[string]*chart.Metadata
+}
+
+func newChartRepositoryIndex(repoURL string, ttl time.Duration, fetcher *ArtifactFetcher) *chartRepositoryIndex {
+	return &chartRepositoryIndex{
+		repoURL:       repoURL,
+		ttl:           ttl,
+		fetcher:       fetcher,
+		chartMetadata: map[string]*chart.Metadata{},
+	}
+}
+
+// get returns the repository index, downloading it again once the cached copy expired.
+func (c *chartRepositoryIndex) get(ctx context.Context) (*repo.IndexFile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.index != nil && time.Since(c.fetchedAt) < c.ttl {
+		return c.index, nil
+	}
+
+	index, err := c.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.index = index
+	c.fetchedAt = time.Now()
+
+	return index, nil
+}
+
+func (c *chartRepositoryIndex) fetch(ctx context.Context) (*repo.IndexFile, error) {
+	if registry.IsOCI(c.repoURL) {
+		return c.fetchOCI(ctx)
+	}
+
+	indexURL, err := url.JoinPath(c.repoURL, "index.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("building index URL: %w", err)
+	}
+
+	data, err := c.fetcher.get(ctx, indexURL)
+	if err != nil {
+		return nil, fmt.Errorf("downloading chart repository index: %w", err)
+	}
+
+	index := &repo.IndexFile{}
+	if err := yaml.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("parsing chart repository index: %w", err)
+	}
+	// newest versions first
+	index.SortEntries()
+
+	return index, nil
+}
+
+// fetchOCI builds the index of an OCI registry from the tags of the Kubewarden charts. OCI registries have no index
+// file, so the metadata of each chart version is pulled once and kept, published versions are not expected to
+// change.
+func (c *chartRepositoryIndex) fetchOCI(ctx context.Context) (*repo.IndexFile, error) {
+	registryClient, err := c.ociRegistryClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	index := repo.NewIndexFile()
+	for _, name := range []string{kubewardenControllerChartName, kubewardenDefaultsChartName, kubewardenCRDsChartName} {
+		ref := c.ociChartRef(name)
+		tags, err := registryClient.Tags(ref)
+		if err != nil {
+			// mirrors only need the kubewarden-crds chart to read the CRDs from it
+			if name == kubewardenCRDsChartName {
+				continue
+			}
+
+			return nil, fmt.Errorf("listing %s chart versions: %w", name, err)
+		}
+
+		for _, tag := range tags {
+			metadata, ok := c.chartMetadata[ref+":"+tag]
+			if !ok {
+				// the config holds the Chart.yaml metadata, the chart layer is not pulled
+				result, err := registryClient.Pull(ref+":"+tag,
+					registry.PullOptWithChart(false), registry.PullOptWithProv(true), registry.PullOptIgnoreMissingProv(true))
+				if err != nil {
+					return nil, fmt.Errorf("pulling %s chart %s: %w", name, tag, err)
+				}
+				metadata = &chart.Metadata{}
+				if err := yaml.Unmarshal(result.Config.Data, metadata); err != nil {
+					return nil, fmt.Errorf("decoding %s chart %s metadata: %w", name, tag, err)
+				}
+				c.chartMetadata[ref+":"+tag] = metadata
+			}
+			index.Entries[name] = append(index.Entries[name], &repo.ChartVersion{Metadata: metadata})
+		}
+	}
+	// newest versions first
+	index.SortEntries()
+
+	return index, nil
+}
+
+// ociRegistryClient returns a client of the OCI registry whose requests are canceled with the context, the Helm
+// registry client taking none.
+func (c *chartRepositoryIndex) ociRegistryClient(ctx context.Context) (*registry.Client, error) {
+	registryClient, err := newRegistryClient(cli.New(), c.fetcher.httpClientWithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("creating registry client: %w", err)
+	}
+
+	return registryClient, nil
+}
+
+// ociChartRef returns the reference of the given chart in the OCI registry, without the oci:// scheme.
+func (c *chartRepositoryIndex) ociChartRef(name string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(c.repoURL, registry.OCIScheme+"://"), "/") + "/" + name
+}
+
+// fetchChart returns the given version of a chart of the repository, fetched through the artifact cache. Charts of
+// Helm repositories must match the digest published in the index. Tags of OCI registries can be pushed again, so
+// OCI charts are cached by the digest of the manifest the tag resolves to, and pulled by that digest. Their layers
+// are verified by the registry client.
+func (c *chartRepositoryIndex) fetchChart(ctx context.Context, cache *ArtifactCache, name, version string) (*chart.Chart, error) {
+	var chartURL, digest string
+	var download func(io.Writer) error
+
+	if registry.IsOCI(c.repoURL) {
+		registryClient, err := c.ociRegistryClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		// only the manifest and the config are pulled to resolve the tag
+		manifest, err := registryClient.Pull(c.ociChartRef(name)+":"+version,
+			registry.PullOptWithChart(false), registry.PullOptWithProv(true), registry.PullOptIgnoreMissingProv(true))
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s chart %s: %w", name, version, err)
+		}
+
+		ref := c.ociChartRef(name) + "@" + manifest.Manifest.Digest
+		chartURL = registry.OCIScheme + "://" + ref
+		download = func(w io.Writer) error {
+			result, err := registryClient.Pull(ref)
+			if err != nil {
+				return fmt.Errorf("pulling %s chart %s: %w", name, version, err)
+			}
+			if int64(len(result.Chart.Data)) > c.fetcher.maxSize {
+				return fmt.Errorf("%w: %s is larger than %d bytes", errArtifactsNotResolved, chartURL, c.fetcher.maxSize)
+			}
+			_, err = w.Write(result.Chart.Data)
+
+			return err
+		}
+	} else {
+		index, err := c.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		chartVersion, err := index.Get(name, version)
+		if err != nil || len(chartVersion.URLs) == 0 {
+			return nil, fmt.Errorf("%w: %s chart %s is not in the repository", errChartNotFound, name, version)
+		}
+		chartURL, err = repo.ResolveReferenceURL(c.repoURL, chartVersion.URLs[0])
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s chart URL: %w", name, err)
+		}
+		digest = chartVersion.Digest
+		download = c.fetcher.download(ctx, chartURL)
+	}
+
+	chartPath, release, err := cache.fetch(artifactKindChart, chartURL, digest, download)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	loaded, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s chart %s: %w", name, version, err)
+	}
+
+	return loaded, nil
+}
+
+// resolveKubewardenRelease resolves the charts shipping the given Kubewarden app version. The "latest" app
+// version resolves to the app version of the newest stable kubewarden-controller chart.
+func resolveKubewardenRelease(ctx context.Context, index *chartRepositoryIndex, appVersion string) (*kubewardenRelease, error) {
+	repoIndex, err := index.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if appVersion == "" || appVersion == latestKubewardenVersion {
+		appVersion, err = latestAppVersion(repoIndex, kubewardenControllerChartName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	controllerChart, err := chartForAppVersion(repoIndex, kubewardenControllerChartName, appVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultsChart, err := chartForAppVersion(repoIndex, kubewardenDefaultsChartName, appVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	release := &kubewardenRelease{
+		// keep the app version as published, CRDs are fetched by release tag
+		AppVersion:             controllerChart.AppVersion,
+		ControllerChartVersion: controllerChart.Version,
+		DefaultsChartVersion:   defaultsChart.Version,
+	}
+
+	// the kubewarden-crds chart is only needed when the CRDs are read from it
+	if crdsChart, err := chartForAppVersion(repoIndex, kubewardenCRDsChartName, appVersion); err == nil {
+		release.CRDsChartVersion = crdsChart.Version
+	}
+
+	return release, nil
+}
+
+// chartForAppVersion returns the newest version of the chart shipping the given app version.
+func chartForAppVersion(index *repo.IndexFile, chartName, appVersion string) (*repo.ChartVersion, error) {
+	versions, ok := index.Entries[chartName]
+	if !ok {
+		return nil, fmt.Errorf("%w: chart %s is not in the repository", errChartNotFound, chartName)
+	}
+
+	for _, version := range versions {
+		if version.Metadata == nil {
+			continue
+		}
+		if normalizeVersion(version.AppVersion) == normalizeVersion(appVersion) {
+			return version, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: no %s chart for app version %s", errChartNotFound, chartName, appVersion)
+}
+
+// latestAppVersion returns the app version of the newest stable version of the chart.
+func latestAppVersion(index *repo.IndexFile, chartName string) (string, error) {
+	for _, version := range index.Entries[chartName] {
+		if version.Metadata == nil || version.AppVersion == "" {
+			continue
+		}
+		// skip pre-releases
+		if strings.Contains(version.Version, "-") {
+			continue
+		}
+
+		return version.AppVersion, nil
+	}
+
+	return "", fmt.Errorf("%w: no stable %s chart in the repository", errChartNotFound, chartName)
+}
+
+// normalizeVersion strips the optional "v" prefix so "v1.18.0" and "1.18.0" match.
+func normalizeVersion(version string) string {
+	return strings.TrimPrefix(version, "v")
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const testChartIndex = `apiVersion: v1
+entries:
+  kubewarden-controller:
+  - name: kubewarden-controller
+    version: 4.0.0-rc1
+    appVersion: v1.19.0-rc1
+  - name: kubewarden-controller
+    version: 3.1.0
+    appVersion: v1.18.0
+  - name: kubewarden-controller
+    version: 3.0.0
+    appVersion: v1.18.0
+  - name: kubewarden-controller
+    version: 2.4.0
+    appVersion: v1.17.0
+  kubewarden-defaults:
+  - name: kubewarden-defaults
+    version: 2.5.0
+    appVersion: v1.18.0
+  - name: kubewarden-defaults
+    version: 2.4.0
+    appVersion: v1.17.0
+  kubewarden-crds:
+  - name: kubewarden-crds
+    version: 1.12.0
+    appVersion: v1.18.0
+`
+
+var _ = Describe("Chart repository index", func() {
+	var (
+		server   *httptest.Server
+		requests atomic.Int32
+		index    *chartRepositoryIndex
+	)
+
+	BeforeEach(func() {
+		requests.Store(0)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/index.yaml" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			requests.Add(1)
+			_, _ = w.Write([]byte(testChartIndex))
+		}))
+		index = newChartRepositoryIndex(server.URL, time.Hour, defaultArtifactFetcher)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should resolve the newest charts shipping an app version", func() {
+		release, err := resolveKubewardenRelease(context.Background(), index, "v1.18.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(release.AppVersion).To(Equal("v1.18.0"))
+		Expect(release.ControllerChartVersion).To(Equal("3.1.0"))
+		Expect(release.DefaultsChartVersion).To(Equal("2.5.0"))
+		Expect(release.CRDsChartVersion).To(Equal("1.12.0"))
+	})
+
+	It("should match app versions with and without the v prefix", func() {
+		release, err := resolveKubewardenRelease(context.Background(), index, "1.17.0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(release.AppVersion).To(Equal("v1.17.0"))
+		Expect(release.ControllerChartVersion).To(Equal("2.4.0"))
+		Expect(release.DefaultsChartVersion).To(Equal("2.4.0"))
+		Expect(release.CRDsChartVersion).To(BeEmpty())
+	})
+
+	It("should resolve latest to the newest stable release", func() {
+		release, err := resolveKubewardenRelease(context.Background(), index, latestKubewardenVersion)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(release.AppVersion).To(Equal("v1.18.0"))
+		Expect(release.ControllerChartVersion).To(Equal("3.1.0"))
+	})
+
+	It("should fail when no chart ships the app version", func() {
+		_, err := resolveKubewardenRelease(context.Background(), index, "v1.10.0")
+		Expect(err).To(MatchError(errChartNotFound))
+	})
+
+	It("should fail when only the controller chart ships the app version", func() {
+		_, err := resolveKubewardenRelease(context.Background(), index, "v1.19.0-rc1")
+		Expect(err).To(MatchError(errChartNotFound))
+	})
+
+	It("should cache the repository index", func() {
+		for range 3 {
+			_, err := resolveKubewardenRelease(context.Background(), index, "v1.18.0")
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(requests.Load()).To(Equal(int32(1)))
+	})
+
+	It("should keep one index per chart repository", func() {
+		indexes := &chartRepositoryIndexes{ttl: time.Hour, indexes: map[chartRepositoryKey]*chartRepositoryIndex{}}
+		Expect(indexes.get(server.URL, defaultArtifactFetcher)).To(BeIdenticalTo(indexes.get(server.URL, defaultArtifactFetcher)))
+		Expect(indexes.get("oci://registry.example.com/kubewarden", defaultArtifactFetcher)).NotTo(BeIdenticalTo(indexes.get(server.URL, defaultArtifactFetcher)))
+
+		fetcher, err := NewArtifactFetcher(FetcherOptions{Timeout: time.Minute})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(indexes.get(server.URL, fetcher)).NotTo(BeIdenticalTo(indexes.get(server.URL, defaultArtifactFetcher)))
+	})
+})
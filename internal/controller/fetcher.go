@@ -0,0 +1,203 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// DefaultFetchTimeout is the default timeout of a single artifact download
+	DefaultFetchTimeout = 2 * time.Minute
+
+	// DefaultMaxArtifactSize is the default maximum size of a downloaded artifact, in bytes
+	DefaultMaxArtifactSize = 100 << 20
+)
+
+// defaultArtifactFetcher is the artifact fetcher of the reconcilers that don't set one. The default options hold
+// no proxy nor CA bundle, so creating it can't fail.
+var defaultArtifactFetcher, _ = NewArtifactFetcher(FetcherOptions{})
+
+// FetcherOptions configures how the Kubewarden artifacts are downloaded.
+type FetcherOptions struct {
+	// Timeout is the timeout of a single download. Defaults to DefaultFetchTimeout.
+	Timeout time.Duration
+
+	// ProxyURL is the URL of the HTTP(S) proxy downloads go through. Defaults to the proxy set by the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	ProxyURL string
+
+	// CABundle is the path of a PEM file holding CA certificates trusted on top of the system ones, for mirrors
+	// served with a private CA.
+	CABundle string
+
+	// MaxSize is the maximum size of a downloaded artifact, and of the files extracted from it, in bytes. Defaults
+	// to DefaultMaxArtifactSize.
+	MaxSize int64
+}
+
+// ArtifactFetcher downloads the Kubewarden artifacts: the chart repository indexes, the charts and the CRD
+// tarballs.
+type ArtifactFetcher struct {
+	httpClient *http.Client
+	maxSize    int64
+}
+
+// NewArtifactFetcher returns an artifact fetcher configured with the given options.
+func NewArtifactFetcher(opts FetcherOptions) (*ArtifactFetcher, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultFetchTimeout
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxArtifactSize
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if opts.ProxyURL != "" {
+		proxyURL, err := url.Parse(opts.ProxyURL)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", opts.ProxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if opts.CABundle != "" {
+		pem, err := os.ReadFile(opts.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no CA certificate found in %s", opts.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+	}
+
+	return &ArtifactFetcher{
+		httpClient: &http.Client{Transport: transport, Timeout: opts.Timeout},
+		maxSize:    opts.MaxSize,
+	}, nil
+}
+
+// httpClientWithContext returns a copy of the HTTP client of the fetcher whose requests are canceled with the
+// context, for the clients that don't take one such as the Helm registry client.
+func (f *ArtifactFetcher) httpClientWithContext(ctx context.Context) *http.Client {
+	httpClient := *f.httpClient
+	httpClient.Transport = &contextTransport{ctx: ctx, base: f.httpClient.Transport}
+
+	return &httpClient
+}
+
+// contextTransport cancels the requests it sends, and the reads of their responses, once its context is done.
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	requestCtx, cancel := context.WithCancelCause(request.Context())
+	stop := context.AfterFunc(t.ctx, func() { cancel(context.Cause(t.ctx)) })
+	release := func() {
+		stop()
+		cancel(nil)
+	}
+
+	response, err := t.base.RoundTrip(request.WithContext(requestCtx))
+	if err != nil {
+		release()
+		return nil, err
+	}
+	response.Body = &releasingBody{ReadCloser: response.Body, release: release}
+
+	return response, nil
+}
+
+// releasingBody calls release once the response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	defer b.release()
+
+	return b.ReadCloser.Close()
+}
+
+// get downloads the file at the given URL in memory.
+func (f *ArtifactFetcher) get(ctx context.Context, url string) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	if err := f.download(ctx, url)(buffer); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// download returns a function writing the file downloaded from the given URL, to fetch it through the artifact
+// cache. The download is canceled with the context, and fails once the file exceeds the maximum size.
+func (f *ArtifactFetcher) download(ctx context.Context, url string) func(io.Writer) error {
+	return func(w io.Writer) error {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return fmt.Errorf("creating request: %w", err)
+		}
+
+		response, err := f.httpClient.Do(request)
+		if err != nil {
+			return fmt.Errorf("downloading %s: %w", url, err)
+		}
+		defer func() {
+			if err := response.Body.Close(); err != nil {
+				log.FromContext(ctx).Error(err, "Failed to close the response body", "url", url)
+			}
+		}()
+
+		if response.StatusCode != http.StatusOK {
+			return fmt.Errorf("downloading %s: HTTP %d", url, response.StatusCode)
+		}
+		if response.ContentLength > f.maxSize {
+			return fmt.Errorf("%w: %s is larger than %d bytes", errArtifactsNotResolved, url, f.maxSize)
+		}
+
+		// read one more byte than allowed to tell a file of the maximum size from a larger one
+		written, err := io.Copy(w, io.LimitReader(response.Body, f.maxSize+1))
+		if err != nil {
+			return fmt.Errorf("downloading %s: %w", url, err)
+		}
+		if written > f.maxSize {
+			return fmt.Errorf("%w: %s is larger than %d bytes", errArtifactsNotResolved, url, f.maxSize)
+		}
+
+		return nil
+	}
+}
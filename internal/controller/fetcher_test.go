@@ -0,0 +1,191 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// writeTarGz writes a tar.gz file holding the given entries and returns its path.
+func writeTarGz(headers []*tar.Header, contents []string) string {
+	buffer := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for i, header := range headers {
+		Expect(tarWriter.WriteHeader(header)).To(Succeed())
+		Expect(tarWriter.Write([]byte(contents[i]))).To(Equal(len(contents[i])))
+	}
+	Expect(tarWriter.Close()).To(Succeed())
+	Expect(gzipWriter.Close()).To(Succeed())
+
+	path := filepath.Join(GinkgoT().TempDir(), "CRDS.tar.gz")
+	Expect(os.WriteFile(path, buffer.Bytes(), 0o600)).To(Succeed())
+
+	return path
+}
+
+var _ = Describe("Artifact fetcher", func() {
+	It("should download files up to the maximum size", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/CRDS.tar.gz" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(strings.Repeat("x", 1024)))
+		}))
+		DeferCleanup(server.Close)
+
+		fetcher, err := NewArtifactFetcher(FetcherOptions{MaxSize: 1024})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetcher.get(ctx, server.URL+"/CRDS.tar.gz")).To(HaveLen(1024))
+
+		_, err = fetcher.get(ctx, server.URL+"/missing.tar.gz")
+		Expect(err).To(MatchError(ContainSubstring("HTTP 404")))
+
+		fetcher, err = NewArtifactFetcher(FetcherOptions{MaxSize: 1023})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fetcher.get(ctx, server.URL+"/CRDS.tar.gz")
+		Expect(err).To(MatchError(errArtifactsNotResolved))
+	})
+
+	It("should stop downloading with the context or the timeout", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		DeferCleanup(server.Close)
+
+		fetcher, err := NewArtifactFetcher(FetcherOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		canceledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = fetcher.get(canceledCtx, server.URL)
+		Expect(err).To(MatchError(context.Canceled))
+
+		fetcher, err = NewArtifactFetcher(FetcherOptions{Timeout: 100 * time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fetcher.get(ctx, server.URL)
+		Expect(err).To(MatchError(ContainSubstring("Timeout")))
+	})
+
+	It("should cancel the requests of clients not taking a context", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		DeferCleanup(server.Close)
+
+		fetcher, err := NewArtifactFetcher(FetcherOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		requestCtx, cancel := context.WithCancel(ctx)
+		time.AfterFunc(100*time.Millisecond, cancel)
+		_, err = fetcher.httpClientWithContext(requestCtx).Get(server.URL)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+
+	It("should download through the proxy", func() {
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// proxied requests hold the absolute URL of the artifact
+			_, _ = w.Write([]byte("proxied " + r.URL.String()))
+		}))
+		DeferCleanup(proxy.Close)
+
+		fetcher, err := NewArtifactFetcher(FetcherOptions{ProxyURL: proxy.URL})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetcher.get(ctx, "http://artifacts.example.com/CRDS.tar.gz")).To(BeEquivalentTo("proxied http://artifacts.example.com/CRDS.tar.gz"))
+
+		_, err = NewArtifactFetcher(FetcherOptions{ProxyURL: "proxy"})
+		Expect(err).To(MatchError(ContainSubstring("invalid proxy URL")))
+	})
+
+	It("should trust the CA bundle", func() {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("crds"))
+		}))
+		DeferCleanup(server.Close)
+
+		fetcher, err := NewArtifactFetcher(FetcherOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fetcher.get(ctx, server.URL)
+		Expect(err).To(MatchError(ContainSubstring("certificate")))
+
+		caBundle := filepath.Join(GinkgoT().TempDir(), "ca.pem")
+		Expect(os.WriteFile(caBundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600)).To(Succeed())
+		fetcher, err = NewArtifactFetcher(FetcherOptions{CABundle: caBundle})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetcher.get(ctx, server.URL)).To(BeEquivalentTo("crds"))
+
+		Expect(os.WriteFile(caBundle, []byte("not a certificate"), 0o600)).To(Succeed())
+		_, err = NewArtifactFetcher(FetcherOptions{CABundle: caBundle})
+		Expect(err).To(MatchError(ContainSubstring("no CA certificate found")))
+	})
+})
+
+var _ = Describe("CRDs tarball extraction", func() {
+	It("should extract the regular files", func() {
+		path := writeTarGz([]*tar.Header{
+			{Name: "crds/", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "crds/policyservers.yaml", Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(testPolicyServersCRD))},
+		}, []string{"", testPolicyServersCRD})
+
+		dir, err := extractTarGz(path, DefaultMaxArtifactSize)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+		Expect(os.ReadFile(filepath.Join(dir, "crds", "policyservers.yaml"))).To(BeEquivalentTo(testPolicyServersCRD))
+	})
+
+	It("should reject unsafe entries", func() {
+		path := writeTarGz([]*tar.Header{
+			{Name: "../policyservers.yaml", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4},
+		}, []string{"crds"})
+		_, err := extractTarGz(path, DefaultMaxArtifactSize)
+		Expect(err).To(MatchError(ContainSubstring("unsafe path")))
+
+		path = writeTarGz([]*tar.Header{
+			{Name: "/etc/policyservers.yaml", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4},
+		}, []string{"crds"})
+		_, err = extractTarGz(path, DefaultMaxArtifactSize)
+		Expect(err).To(MatchError(ContainSubstring("unsafe path")))
+
+		path = writeTarGz([]*tar.Header{
+			{Name: "policyservers.yaml", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		}, []string{""})
+		_, err = extractTarGz(path, DefaultMaxArtifactSize)
+		Expect(err).To(MatchError(ContainSubstring("unsupported entry")))
+	})
+
+	It("should limit the size of the extracted files", func() {
+		path := writeTarGz([]*tar.Header{
+			{Name: "policyservers.yaml", Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(testPolicyServersCRD))},
+			{Name: "admissionpolicies.yaml", Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(testPolicyServersCRD))},
+		}, []string{testPolicyServersCRD, testPolicyServersCRD})
+
+		_, err := extractTarGz(path, int64(len(testPolicyServersCRD))+1)
+		Expect(err).To(MatchError(ContainSubstring("larger than")))
+	})
+})
@@ -0,0 +1,165 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	policiesv1 "github.com/kubewarden/kubewarden-controller/api/policies/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+// updateKubewardenHealth checks the health of the Kubewarden components of the cluster and records it in the Ready
+// condition of the cluster status. It returns whether all the components are healthy.
+func updateKubewardenHealth(ctx context.Context, remoteClient client.Client, status *addonv1alpha1.ClusterInstallationStatus, manifests *kubewardenManifests) (bool, error) {
+	unhealthy, err := checkKubewardenHealth(ctx, remoteClient, manifests)
+	if err != nil {
+		return false, fmt.Errorf("checking kubewarden health: %w", err)
+	}
+	setClusterReadyCondition(status, unhealthy)
+	if len(unhealthy) > 0 {
+		log.FromContext(ctx).Info("Kubewarden components are not healthy", "components", unhealthy)
+	}
+
+	return len(unhealthy) == 0, nil
+}
+
+// checkKubewardenHealth returns the Kubewarden components that are not healthy on the cluster: the
+// kubewarden-controller Deployment, the ValidatingWebhookConfigurations of the charts, and the default PolicyServer
+// along with its Deployment. No component is returned when Kubewarden is healthy.
+func checkKubewardenHealth(ctx context.Context, remoteClient client.Client, manifests *kubewardenManifests) ([]string, error) {
+	unhealthy := []string{}
+
+	controllerName := kubewardenHelmReleaseName + "-kubewarden-controller"
+	available, err := isDeploymentAvailable(ctx, remoteClient, controllerName)
+	if err != nil {
+		return nil, fmt.Errorf("checking Deployment %s: %w", controllerName, err)
+	}
+	if !available {
+		unhealthy = append(unhealthy, fmt.Sprintf("Deployment %s is not available", controllerName))
+	}
+
+	for _, obj := range append(append([]client.Object{}, manifests.Controller...), manifests.Defaults...) {
+		if obj.GetObjectKind().GroupVersionKind().Kind != "ValidatingWebhookConfiguration" {
+			continue
+		}
+
+		webhook := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+		if err := remoteClient.Get(ctx, client.ObjectKey{Name: obj.GetName()}, webhook); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("checking ValidatingWebhookConfiguration %s: %w", obj.GetName(), err)
+			}
+			unhealthy = append(unhealthy, fmt.Sprintf("ValidatingWebhookConfiguration %s is missing", obj.GetName()))
+		}
+	}
+
+	if !isObjectRendered(manifests.Defaults, "PolicyServer", kubewardenHelmDefaultPolicyServerName) {
+		return unhealthy, nil
+	}
+
+	message, err := policyServerHealth(ctx, remoteClient, kubewardenHelmDefaultPolicyServerName)
+	if err != nil {
+		return nil, err
+	}
+	if message != "" {
+		unhealthy = append(unhealthy, message)
+	}
+
+	return unhealthy, nil
+}
+
+// policyServerHealth returns why the PolicyServer is not healthy, or an empty string when it is. A healthy
+// PolicyServer has no failed condition and its Deployment is available.
+func policyServerHealth(ctx context.Context, remoteClient client.Client, name string) (string, error) {
+	policyServer := &policiesv1.PolicyServer{}
+	if err := remoteClient.Get(ctx, client.ObjectKey{Name: name}, policyServer); err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Sprintf("PolicyServer %s is missing", name), nil
+		}
+
+		return "", fmt.Errorf("checking PolicyServer %s: %w", name, err)
+	}
+
+	failed := []string{}
+	for _, condition := range policyServer.Status.Conditions {
+		if condition.Status == metav1.ConditionFalse {
+			failed = append(failed, fmt.Sprintf("%s: %s", condition.Type, condition.Message))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Sprintf("PolicyServer %s is not reconciled: %s", name, strings.Join(failed, ", ")), nil
+	}
+
+	deploymentName := "policy-server-" + name
+	available, err := isDeploymentAvailable(ctx, remoteClient, deploymentName)
+	if err != nil {
+		return "", fmt.Errorf("checking Deployment %s: %w", deploymentName, err)
+	}
+	if !available {
+		return fmt.Sprintf("PolicyServer %s is not available", name), nil
+	}
+
+	return "", nil
+}
+
+// setClusterReadyCondition records the health of the Kubewarden components of the cluster in its Ready condition.
+// The transition time only changes with the condition status.
+func setClusterReadyCondition(status *addonv1alpha1.ClusterInstallationStatus, unhealthy []string) {
+	condition := conditions.TrueCondition(clusterv1.ReadyCondition)
+	if len(unhealthy) > 0 {
+		condition = conditions.FalseCondition(clusterv1.ReadyCondition, addonv1alpha1.KubewardenComponentsNotReadyReason,
+			clusterv1.ConditionSeverityWarning, "%s", strings.Join(unhealthy, "; "))
+	}
+	condition.LastTransitionTime = metav1.Now()
+
+	for i := range status.Conditions {
+		existing := &status.Conditions[i]
+		if existing.Type != condition.Type {
+			continue
+		}
+
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		*existing = *condition
+
+		return
+	}
+	status.Conditions = append(status.Conditions, *condition)
+}
+
+// clusterReadyCondition returns the Ready condition of the cluster, or an empty condition when the health of the
+// cluster was never checked.
+func clusterReadyCondition(status *addonv1alpha1.ClusterInstallationStatus) *clusterv1.Condition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == clusterv1.ReadyCondition {
+			return &status.Conditions[i]
+		}
+	}
+
+	return &clusterv1.Condition{Type: clusterv1.ReadyCondition}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+// markKubewardenHealthy makes the Kubewarden components of the workload cluster healthy, as nothing runs them in the
+// test environment: the policy server Deployment, normally created by the kubewarden-controller, is created and all
+// the Deployments of the kubewarden namespace are marked available.
+func markKubewardenHealthy(g Gomega, workloadClient client.Client) {
+	labels := map[string]string{"app": "kubewarden-policy-server-" + kubewardenHelmDefaultPolicyServerName}
+	policyServer := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy-server-" + kubewardenHelmDefaultPolicyServerName, Namespace: kubewardenNamespace},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "policy-server", Image: "ghcr.io/kubewarden/policy-server"}},
+				},
+			},
+		},
+	}
+	if err := workloadClient.Create(ctx, policyServer); err != nil {
+		g.Expect(apierrors.IsAlreadyExists(err)).To(BeTrue())
+	}
+
+	deployments := &appsv1.DeploymentList{}
+	g.Expect(workloadClient.List(ctx, deployments, client.InNamespace(kubewardenNamespace))).To(Succeed())
+	for i := range deployments.Items {
+		deployment := &deployments.Items[i]
+		replicas := int32(1)
+		if deployment.Spec.Replicas != nil {
+			replicas = *deployment.Spec.Replicas
+		}
+
+		deployment.Status.ObservedGeneration = deployment.Generation
+		deployment.Status.Replicas = replicas
+		deployment.Status.UpdatedReplicas = replicas
+		deployment.Status.ReadyReplicas = replicas
+		deployment.Status.AvailableReplicas = replicas
+		g.Expect(workloadClient.Status().Update(ctx, deployment)).To(Succeed())
+	}
+}
+
+var _ = Describe("Kubewarden health", func() {
+	It("should record the health of the components in the Ready condition", func() {
+		status := &addonv1alpha1.ClusterInstallationStatus{}
+
+		setClusterReadyCondition(status, []string{"Deployment caapkw-kubewarden-controller is not available"})
+		condition := clusterReadyCondition(status)
+		Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(addonv1alpha1.KubewardenComponentsNotReadyReason))
+		Expect(condition.Message).To(ContainSubstring("caapkw-kubewarden-controller"))
+
+		// the transition time only changes with the status
+		transitionTime := metav1.NewTime(time.Now().Add(-time.Hour))
+		condition.LastTransitionTime = transitionTime
+		setClusterReadyCondition(status, []string{"PolicyServer default is not available"})
+		Expect(status.Conditions).To(HaveLen(1))
+		Expect(clusterReadyCondition(status).LastTransitionTime).To(Equal(transitionTime))
+		Expect(clusterReadyCondition(status).Message).To(ContainSubstring("PolicyServer default"))
+
+		setClusterReadyCondition(status, nil)
+		Expect(clusterReadyCondition(status).Status).To(Equal(corev1.ConditionTrue))
+		Expect(clusterReadyCondition(status).LastTransitionTime).NotTo(Equal(transitionTime))
+	})
+
+	It("should report the degraded clusters in the addon conditions", func() {
+		addon := &addonv1alpha1.KubewardenAddon{}
+		addon.Status.MatchingClusters = []corev1.ObjectReference{{Name: "cluster-a"}, {Name: "cluster-b"}}
+		addon.Status.Clusters = []addonv1alpha1.ClusterInstallationStatus{
+			{ClusterName: "cluster-a", Phase: addonv1alpha1.ClusterInstallationReady},
+			{ClusterName: "cluster-b", Phase: addonv1alpha1.ClusterInstallationDegraded},
+		}
+		setClusterReadyCondition(&addon.Status.Clusters[1], []string{"PolicyServer default is not available"})
+
+		setKubewardenAddonConditions(addon)
+		Expect(conditions.IsTrue(addon, addonv1alpha1.KubewardenAddonSpecsUpToDateCondition)).To(BeTrue())
+		Expect(conditions.GetReason(addon, addonv1alpha1.KubewardenAddonsReadyCondition)).To(Equal(addonv1alpha1.KubewardenComponentsNotReadyReason))
+		Expect(conditions.GetMessage(addon, addonv1alpha1.KubewardenAddonsReadyCondition)).To(ContainSubstring("cluster-b: PolicyServer default is not available"))
+		Expect(conditions.IsFalse(addon, clusterv1.ReadyCondition)).To(BeTrue())
+	})
+})
@@ -0,0 +1,472 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	helmrelease "helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+const (
+	// helmStorageDriver stores the Helm releases in Secrets of the kubewarden namespace, like the Helm CLI does
+	helmStorageDriver = "secret"
+
+	// helmOperationTimeout bounds the Helm operations on a cluster, chart hooks included
+	helmOperationTimeout = 5 * time.Minute
+
+	// helmMaxHistory is the number of revisions kept for each Helm release
+	helmMaxHistory = 10
+
+	// helmReleaseHashLabel records on the Helm releases the hash of the manifests they installed, truncated to
+	// helmReleaseHashLength characters to fit in a label value
+	helmReleaseHashLabel  = "caapkw.kubewarden.io/hash"
+	helmReleaseHashLength = 32
+)
+
+// kubewardenHelmReleaseNames lists the Helm releases of the Helm install mode, in the order they are installed.
+var kubewardenHelmReleaseNames = []string{kubewardenHelmReleaseName, kubewardenHelmReleaseName + "-defaults"}
+
+// helmInstaller installs the kubewarden-controller and the kubewarden-defaults charts as Helm releases of the
+// clusters, so their history is kept on the clusters and they can be inspected and rolled back with the Helm CLI.
+// The releases hold the manifests rendered and processed by the addon, the CRDs are applied like in the direct
+// install mode.
+type helmInstaller struct {
+	r *KubewardenAddonReconciler
+
+	// values are the chart values of the addon, set by prepare. The releases are rendered with them for the chart
+	// hooks and the release history.
+	values *kubewardenChartValues
+}
+
+func (i *helmInstaller) prepare(_ context.Context, _ *addonv1alpha1.KubewardenAddon, _ *kubewardenRelease, values *kubewardenChartValues, _ *kubewardenManifests) error {
+	i.values = values
+
+	return nil
+}
+
+// reconcileCluster installs or upgrades the Helm releases of the cluster when the manifests change, and records
+// their last revision in the cluster installation status. Installed clusters are checked for drift: releases whose
+// objects were changed, removed or rolled back by an operator are upgraded again, so Helm restores them.
+func (i *helmInstaller) reconcileCluster(ctx context.Context, addonName string, cluster *clusterv1.Cluster, status *addonv1alpha1.ClusterInstallationStatus, release *kubewardenRelease, manifests *kubewardenManifests, desiredHash string, phases *clusterPhasePublisher) (time.Duration, error) {
+	log := log.FromContext(ctx).WithValues("cluster", cluster.Name)
+
+	// cluster must be ready before we can deploy kubewarden
+	if !isControlPlaneReady(cluster) {
+		setClusterPhase(status, addonv1alpha1.ClusterInstallationPending, nil)
+		return defaultRequeueDuration, nil
+	}
+
+	desiredVersion := release.AppVersion
+	installedVersion := cluster.GetAnnotations()[KubewardenVersionAnnotation]
+	installedHash := cluster.GetAnnotations()[KubewardenHashAnnotation]
+	status.InstalledVersion = installedVersion
+	status.AppliedHash = installedHash
+
+	remoteClient, err := i.r.RemoteClientGetter(ctx, cluster.Name, i.r.Client, client.ObjectKeyFromObject(cluster))
+	if err != nil {
+		return 0, fmt.Errorf("getting remote cluster client: %w", err)
+	}
+	actionConfig, err := i.r.helmActionConfig(ctx, cluster)
+	if err != nil {
+		return 0, err
+	}
+
+	// the last revisions of the releases are recorded whatever the outcome, failed ones included
+	defer func() {
+		if err := setHelmReleaseStatuses(actionConfig, status); err != nil {
+			log.Error(err, "Failed to record the Helm releases")
+		}
+	}()
+
+	if installedVersion == desiredVersion && installedHash == desiredHash {
+		// Kubewarden is installed, make sure nobody changed it in the meantime
+		log.Info("Checking Kubewarden resources for drift")
+		drifted, err := i.correctDrift(ctx, remoteClient, actionConfig, release, manifests)
+		if err != nil {
+			return 0, fmt.Errorf("correcting kubewarden drift: %w", err)
+		}
+		if drifted > 0 {
+			log.Info("Corrected drifted Kubewarden resources", "count", drifted)
+		}
+		setClusterDriftStatus(status, drifted)
+
+		// Kubewarden only stays ready as long as its components keep running
+		healthy, err := updateKubewardenHealth(ctx, remoteClient, status, manifests)
+		if err != nil {
+			return 0, err
+		}
+		if !healthy {
+			setClusterPhase(status, addonv1alpha1.ClusterInstallationDegraded, nil)
+			return healthCheckInterval, nil
+		}
+
+		setClusterPhase(status, addonv1alpha1.ClusterInstallationReady, nil)
+		return driftCheckInterval, nil
+	}
+
+	if isKubewardenInstalled(cluster) {
+		setClusterPhase(status, addonv1alpha1.ClusterInstallationUpgrading, nil)
+	} else {
+		setClusterPhase(status, addonv1alpha1.ClusterInstallationInstalling, nil)
+	}
+	phases.publish(ctx, cluster, status)
+
+	// Helm never upgrades the CRDs of a chart, they are applied before the releases
+	log.Info("Applying Kubewarden CRDs")
+	if err := createKubewardenNamespace(ctx, remoteClient); err != nil {
+		return 0, fmt.Errorf("creating kubewarden namespace: %w", err)
+	}
+	if err := i.r.applyObjects(ctx, remoteClient, manifests.CRDs); err != nil {
+		return 0, fmt.Errorf("applying kubewarden CRDs: %w", err)
+	}
+
+	// the default PolicyServer is only accepted once the kubewarden-controller is running
+	err = i.upgradeChart(ctx, actionConfig, release, kubewardenHelmReleaseNames[0], kubewardenControllerChartName,
+		release.ControllerChartVersion, i.values.Controller, manifests.Controller, false)
+	if err != nil {
+		return 0, err
+	}
+	available, err := isDeploymentAvailable(ctx, remoteClient, kubewardenHelmReleaseName+"-kubewarden-controller")
+	if err != nil || !available {
+		log.Info("Waiting for Kubewarden controller to become available")
+		return upgradeRequeueDuration, err
+	}
+
+	err = i.upgradeChart(ctx, actionConfig, release, kubewardenHelmReleaseNames[1], kubewardenDefaultsChartName,
+		release.DefaultsChartVersion, i.values.Defaults, manifests.Defaults, false)
+	if err != nil {
+		return 0, err
+	}
+
+	healthy, err := updateKubewardenHealth(ctx, remoteClient, status, manifests)
+	if err != nil || !healthy {
+		return upgradeRequeueDuration, err
+	}
+
+	log.Info(fmt.Sprintf("Kubewarden %s released to cluster %s", desiredVersion, cluster.Name))
+	if err := i.r.annotateCluster(ctx, cluster, map[string]string{
+		KubewardenHashAnnotation:    desiredHash,
+		KubewardenVersionAnnotation: desiredVersion,
+		KubewardenAddonAnnotation:   addonName,
+	}); err != nil {
+		return 0, err
+	}
+	if err := i.r.removeClusterAnnotations(ctx, cluster, KubewardenInstalledAnnotation); err != nil {
+		return 0, err
+	}
+	status.InstalledVersion = desiredVersion
+	status.AppliedHash = desiredHash
+	setClusterDriftStatus(status, 0)
+	setClusterPhase(status, addonv1alpha1.ClusterInstallationReady, nil)
+
+	return driftCheckInterval, nil
+}
+
+// correctDrift re-applies the CRDs that drifted, and upgrades the Helm releases whose objects drifted so Helm
+// restores them in a new revision. It returns the number of drifted objects.
+func (i *helmInstaller) correctDrift(ctx context.Context, remoteClient client.Client, actionConfig *action.Configuration, release *kubewardenRelease, manifests *kubewardenManifests) (int, error) {
+	drifted, err := i.r.correctObjectsDrift(ctx, remoteClient, manifests.CRDs)
+	if err != nil {
+		return 0, fmt.Errorf("correct CRDs drift: %w", err)
+	}
+
+	releases := []struct {
+		name      string
+		chartName string
+		version   string
+		values    map[string]interface{}
+		objs      []client.Object
+	}{
+		{kubewardenHelmReleaseNames[0], kubewardenControllerChartName, release.ControllerChartVersion, i.values.Controller, manifests.Controller},
+		{kubewardenHelmReleaseNames[1], kubewardenDefaultsChartName, release.DefaultsChartVersion, i.values.Defaults, manifests.Defaults},
+	}
+	for _, rel := range releases {
+		count, err := countDriftedObjects(ctx, remoteClient, rel.objs)
+		if err != nil {
+			return 0, fmt.Errorf("check %s drift: %w", rel.chartName, err)
+		}
+		if count == 0 {
+			continue
+		}
+
+		drifted += count
+		if err := i.upgradeChart(ctx, actionConfig, release, rel.name, rel.chartName, rel.version, rel.values, rel.objs, true); err != nil {
+			return 0, err
+		}
+	}
+
+	return drifted, nil
+}
+
+// upgradeChart fetches the given chart of the release and installs or upgrades the Helm release with it. With
+// reapply, the release is upgraded even if its last revision is deployed with the objects already.
+func (i *helmInstaller) upgradeChart(ctx context.Context, actionConfig *action.Configuration, release *kubewardenRelease, releaseName, chartName, version string, values map[string]interface{}, objs []client.Object, reapply bool) error {
+	helmChart, err := kubewardenChartIndexes.get(release.Artifacts.ChartRepository, i.r.artifactFetcher()).fetchChart(ctx, i.r.artifactCache(), chartName, version)
+	if err != nil {
+		return fmt.Errorf("fetch %s helm chart: %w", chartName, err)
+	}
+
+	rel, err := upgradeHelmRelease(ctx, actionConfig, releaseName, helmChart, values, objs, reapply)
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Helm release is deployed", "release", rel.Name, "revision", rel.Version)
+
+	return nil
+}
+
+// uninstall deletes the policies and the policy servers while the kubewarden-controller is still there to clear
+// their finalizers, then uninstalls the Helm releases. CRDs are not part of the releases, they are deleted like in
+// the direct install mode.
+func (i *helmInstaller) uninstall(ctx context.Context, cluster *clusterv1.Cluster, addon *addonv1alpha1.KubewardenAddon) (bool, error) {
+	log := log.FromContext(ctx)
+
+	remoteClient, err := i.r.RemoteClientGetter(ctx, cluster.Name, i.r.Client, client.ObjectKeyFromObject(cluster))
+	if err != nil {
+		return false, fmt.Errorf("getting remote cluster client: %w", err)
+	}
+
+	log.Info("Deleting Kubewarden policies and policy servers", "cluster", cluster.Name)
+	remaining, err := deleteKubewardenPolicies(ctx, remoteClient)
+	if err != nil {
+		return false, err
+	}
+	if remaining > 0 {
+		return false, nil
+	}
+
+	actionConfig, err := i.r.helmActionConfig(ctx, cluster)
+	if err != nil {
+		return false, err
+	}
+	for n := len(kubewardenHelmReleaseNames) - 1; n >= 0; n-- {
+		name := kubewardenHelmReleaseNames[n]
+		log.Info("Uninstalling Helm release", "cluster", cluster.Name, "release", name)
+		uninstall := action.NewUninstall(actionConfig)
+		uninstall.Timeout = helmOperationTimeout
+		if _, err := uninstall.Run(name); err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+			return false, fmt.Errorf("uninstalling Helm release %s: %w", name, err)
+		}
+	}
+
+	if addon.Spec.RemoveCRDs {
+		// delete the CRDs of the version that was installed on the cluster
+		appVersion := cluster.GetAnnotations()[KubewardenVersionAnnotation]
+		if appVersion == "" {
+			appVersion = kubewardenAppVersion(addon)
+		}
+		release, err := i.r.resolveRelease(ctx, addon, appVersion)
+		if err != nil {
+			return false, fmt.Errorf("resolving kubewarden release: %w", err)
+		}
+
+		log.Info("Deleting Kubewarden CRDs", "cluster", cluster.Name)
+		if err := i.r.deleteKubewardenCRDs(ctx, release, remoteClient); err != nil {
+			return false, fmt.Errorf("deleting kubewarden CRDs: %w", err)
+		}
+	}
+
+	return true, nil
+}
+
+// upgradeHelmRelease installs the Helm release, or upgrades it unless its last revision is deployed with the given
+// objects already and reapply is false. Helm renders the chart with the values, for the chart hooks and the release
+// history, and a post-renderer replaces the rendered manifests with the objects. Releases left pending by an
+// interrupted operation are marked as failed once the operation timed out, so they can be upgraded again.
+func upgradeHelmRelease(ctx context.Context, actionConfig *action.Configuration, name string, helmChart *chart.Chart, values map[string]interface{}, objs []client.Object, reapply bool) (*helmrelease.Release, error) {
+	hash, err := hashObjects(objs)
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{helmReleaseHashLabel: hash[:helmReleaseHashLength]}
+
+	last, err := actionConfig.Releases.Last(name)
+	if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, fmt.Errorf("getting Helm release %s: %w", name, err)
+	}
+	if !reapply && last != nil && last.Info.Status == helmrelease.StatusDeployed && last.Labels[helmReleaseHashLabel] == labels[helmReleaseHashLabel] {
+		return last, nil
+	}
+	if last != nil && last.Info.Status.IsPending() {
+		if time.Since(last.Info.LastDeployed.Time) < helmOperationTimeout {
+			return nil, fmt.Errorf("helm release %s is %s", name, last.Info.Status)
+		}
+		last.SetStatus(helmrelease.StatusFailed, "Operation timed out")
+		if err := actionConfig.Releases.Update(last); err != nil {
+			return nil, fmt.Errorf("updating Helm release %s: %w", name, err)
+		}
+	}
+
+	postRenderer := &objectsPostRenderer{objs: objs}
+	if last == nil {
+		install := action.NewInstall(actionConfig)
+		install.ReleaseName = name
+		install.Namespace = kubewardenNamespace
+		install.Timeout = helmOperationTimeout
+		install.PostRenderer = postRenderer
+		install.Labels = labels
+		rel, err := install.RunWithContext(ctx, helmChart, values)
+		if err != nil {
+			return nil, fmt.Errorf("installing Helm release %s: %w", name, err)
+		}
+
+		return rel, nil
+	}
+
+	upgrade := action.NewUpgrade(actionConfig)
+	upgrade.Namespace = kubewardenNamespace
+	upgrade.Timeout = helmOperationTimeout
+	upgrade.MaxHistory = helmMaxHistory
+	upgrade.ResetValues = true
+	upgrade.PostRenderer = postRenderer
+	upgrade.Labels = labels
+	rel, err := upgrade.RunWithContext(ctx, name, helmChart, values)
+	if err != nil {
+		return nil, fmt.Errorf("upgrading Helm release %s: %w", name, err)
+	}
+
+	return rel, nil
+}
+
+// setHelmReleaseStatuses records the last revision of the Helm releases of the cluster in its installation status.
+func setHelmReleaseStatuses(actionConfig *action.Configuration, status *addonv1alpha1.ClusterInstallationStatus) error {
+	statuses := []addonv1alpha1.HelmReleaseStatus{}
+	for _, name := range kubewardenHelmReleaseNames {
+		last, err := actionConfig.Releases.Last(name)
+		if err != nil {
+			if errors.Is(err, driver.ErrReleaseNotFound) {
+				continue
+			}
+
+			return fmt.Errorf("getting Helm release %s: %w", name, err)
+		}
+		statuses = append(statuses, helmReleaseStatus(last))
+	}
+	status.HelmReleases = statuses
+
+	return nil
+}
+
+// helmReleaseStatus returns the status of the given revision of a Helm release.
+func helmReleaseStatus(rel *helmrelease.Release) addonv1alpha1.HelmReleaseStatus {
+	status := addonv1alpha1.HelmReleaseStatus{
+		Name:     rel.Name,
+		Revision: int32(rel.Version),
+	}
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		status.Chart = rel.Chart.Metadata.Name + "-" + rel.Chart.Metadata.Version
+	}
+	if rel.Info != nil {
+		status.Status = rel.Info.Status.String()
+	}
+
+	return status
+}
+
+// objectsPostRenderer replaces the manifests rendered by Helm with the given objects.
+type objectsPostRenderer struct {
+	objs []client.Object
+}
+
+func (p *objectsPostRenderer) Run(*bytes.Buffer) (*bytes.Buffer, error) {
+	manifests := &bytes.Buffer{}
+	for _, obj := range p.objs {
+		manifest, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("serializing %s %s: %w", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), err)
+		}
+		manifests.WriteString("---\n")
+		manifests.Write(manifest)
+	}
+
+	return manifests, nil
+}
+
+// helmActionConfig returns the configuration of the Helm actions on the cluster, connecting with the REST config
+// returned by RemoteRESTConfigGetter.
+func (r *KubewardenAddonReconciler) helmActionConfig(ctx context.Context, cluster *clusterv1.Cluster) (*action.Configuration, error) {
+	restConfig, err := r.RemoteRESTConfigGetter(ctx, cluster.Name, r.Client, client.ObjectKeyFromObject(cluster))
+	if err != nil {
+		return nil, fmt.Errorf("getting remote cluster REST config: %w", err)
+	}
+
+	logger := log.FromContext(ctx).V(1)
+	actionConfig := &action.Configuration{}
+	getter := &helmRESTClientGetter{restConfig: restConfig, namespace: kubewardenNamespace}
+	if err := actionConfig.Init(getter, kubewardenNamespace, helmStorageDriver, func(format string, v ...interface{}) {
+		logger.Info(fmt.Sprintf(format, v...))
+	}); err != nil {
+		return nil, fmt.Errorf("initializing Helm: %w", err)
+	}
+
+	return actionConfig, nil
+}
+
+// helmRESTClientGetter provides Helm with the clients of a workload cluster.
+type helmRESTClientGetter struct {
+	restConfig *rest.Config
+	namespace  string
+}
+
+func (g *helmRESTClientGetter) ToRESTConfig() (*rest.Config, error) {
+	return rest.CopyConfig(g.restConfig), nil
+}
+
+func (g *helmRESTClientGetter) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(g.restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return memory.NewMemCacheClient(discoveryClient), nil
+}
+
+func (g *helmRESTClientGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	discoveryClient, err := g.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return restmapper.NewDeferredDiscoveryRESTMapper(discoveryClient), nil
+}
+
+func (g *helmRESTClientGetter) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	return clientcmd.NewDefaultClientConfig(*clientcmdapi.NewConfig(), &clientcmd.ConfigOverrides{
+		Context: clientcmdapi.Context{Namespace: g.namespace},
+	})
+}
@@ -0,0 +1,303 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	helmrelease "helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	helmtime "helm.sh/helm/v3/pkg/time"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+var _ = Describe("Helm installer", func() {
+	var actionConfig *action.Configuration
+	var testChart *chart.Chart
+
+	BeforeEach(func() {
+		// releases are stored in memory and never reach a cluster
+		actionConfig = &action.Configuration{
+			Releases:     storage.Init(driver.NewMemory()),
+			KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard},
+			Capabilities: chartutil.DefaultCapabilities,
+			Log:          func(string, ...interface{}) {},
+		}
+		testChart = &chart.Chart{
+			Metadata: &chart.Metadata{
+				APIVersion: chart.APIVersionV2,
+				Name:       kubewardenControllerChartName,
+				Version:    "3.1.0",
+				AppVersion: "v1.18.0",
+			},
+			Templates: []*chart.File{{
+				Name: "templates/configmap.yaml",
+				Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: rendered\n"),
+			}},
+		}
+	})
+
+	It("should replace the rendered manifests with the objects", func() {
+		renderer := &objectsPostRenderer{objs: []client.Object{
+			newManifestObject("ConfigMap", "kubewarden-config"),
+			newManifestObject("Secret", "kubewarden-secret"),
+		}}
+		manifests, err := renderer.Run(bytes.NewBufferString("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: rendered\n"))
+		Expect(err).NotTo(HaveOccurred())
+
+		objs, err := decodeObjects(manifests)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objs).To(HaveExactElements(
+			HaveField("GetName()", "kubewarden-config"),
+			HaveField("GetName()", "kubewarden-secret"),
+		))
+	})
+
+	It("should install and upgrade the release when the objects change", func() {
+		objs := []client.Object{newManifestObject("ConfigMap", "kubewarden-config")}
+		rel, err := upgradeHelmRelease(ctx, actionConfig, kubewardenHelmReleaseName, testChart, nil, objs, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rel.Version).To(Equal(1))
+		Expect(rel.Manifest).To(ContainSubstring("name: kubewarden-config"))
+		Expect(rel.Manifest).NotTo(ContainSubstring("name: rendered"))
+
+		// the same objects are not released again
+		rel, err = upgradeHelmRelease(ctx, actionConfig, kubewardenHelmReleaseName, testChart, nil, objs, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rel.Version).To(Equal(1))
+
+		objs = append(objs, newManifestObject("Secret", "kubewarden-secret"))
+		rel, err = upgradeHelmRelease(ctx, actionConfig, kubewardenHelmReleaseName, testChart, map[string]interface{}{"replicas": 2}, objs, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rel.Version).To(Equal(2))
+		Expect(rel.Manifest).To(ContainSubstring("name: kubewarden-secret"))
+		Expect(rel.Config).To(HaveKeyWithValue("replicas", BeEquivalentTo(2)))
+	})
+
+	It("should upgrade the release again when the objects are reapplied", func() {
+		objs := []client.Object{newManifestObject("ConfigMap", "kubewarden-config")}
+		_, err := upgradeHelmRelease(ctx, actionConfig, kubewardenHelmReleaseName, testChart, nil, objs, false)
+		Expect(err).NotTo(HaveOccurred())
+
+		// drifted objects are restored by a new revision with the same objects
+		rel, err := upgradeHelmRelease(ctx, actionConfig, kubewardenHelmReleaseName, testChart, nil, objs, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rel.Version).To(Equal(2))
+		Expect(rel.Manifest).To(ContainSubstring("name: kubewarden-config"))
+	})
+
+	It("should upgrade releases left pending once the operation timed out", func() {
+		objs := []client.Object{newManifestObject("ConfigMap", "kubewarden-config")}
+		rel, err := upgradeHelmRelease(ctx, actionConfig, kubewardenHelmReleaseName, testChart, nil, objs, false)
+		Expect(err).NotTo(HaveOccurred())
+
+		rel.SetStatus(helmrelease.StatusPendingUpgrade, "Upgrading")
+		Expect(actionConfig.Releases.Update(rel)).To(Succeed())
+		_, err = upgradeHelmRelease(ctx, actionConfig, kubewardenHelmReleaseName, testChart, nil, objs, false)
+		Expect(err).To(MatchError(ContainSubstring("is pending-upgrade")))
+
+		rel.Info.LastDeployed = helmtime.Time{Time: time.Now().Add(-helmOperationTimeout)}
+		Expect(actionConfig.Releases.Update(rel)).To(Succeed())
+		rel, err = upgradeHelmRelease(ctx, actionConfig, kubewardenHelmReleaseName, testChart, nil, objs, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rel.Version).To(Equal(2))
+		Expect(rel.Info.Status).To(Equal(helmrelease.StatusDeployed))
+	})
+
+	It("should record the last revision of the releases", func() {
+		status := &addonv1alpha1.ClusterInstallationStatus{}
+		Expect(setHelmReleaseStatuses(actionConfig, status)).To(Succeed())
+		Expect(status.HelmReleases).To(BeEmpty())
+
+		objs := []client.Object{newManifestObject("ConfigMap", "kubewarden-config")}
+		_, err := upgradeHelmRelease(ctx, actionConfig, kubewardenHelmReleaseName, testChart, nil, objs, false)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = upgradeHelmRelease(ctx, actionConfig, kubewardenHelmReleaseName, testChart, nil,
+			append(objs, newManifestObject("Secret", "kubewarden-secret")), false)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(setHelmReleaseStatuses(actionConfig, status)).To(Succeed())
+		Expect(status.HelmReleases).To(ConsistOf(addonv1alpha1.HelmReleaseStatus{
+			Name:     kubewardenHelmReleaseName,
+			Chart:    "kubewarden-controller-3.1.0",
+			Revision: 2,
+			Status:   "deployed",
+		}))
+	})
+})
+
+// completeJobs marks the Jobs of the cluster as complete until the context is done, as no controller runs them.
+// Helm waits for the Jobs of the chart hooks to complete.
+func completeJobs(ctx context.Context, k8sClient client.Client) {
+	defer GinkgoRecover()
+
+	for ctx.Err() == nil {
+		jobs := &batchv1.JobList{}
+		if err := k8sClient.List(ctx, jobs); err == nil {
+			for i := range jobs.Items {
+				job := &jobs.Items[i]
+				if job.Status.CompletionTime != nil {
+					continue
+				}
+
+				now := metav1.Now()
+				job.Status.StartTime = &now
+				job.Status.CompletionTime = &now
+				job.Status.Succeeded = 1
+				job.Status.Conditions = []batchv1.JobCondition{
+					{Type: batchv1.JobSuccessCriteriaMet, Status: corev1.ConditionTrue, LastTransitionTime: now},
+					{Type: batchv1.JobComplete, Status: corev1.ConditionTrue, LastTransitionTime: now},
+				}
+				_ = k8sClient.Status().Update(ctx, job)
+			}
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+var _ = Describe("KubewardenAddon Helm install mode", func() {
+	const namespace = "helm-install-mode"
+
+	It("should install, upgrade and uninstall Kubewarden as Helm releases", func() {
+		By("Starting a workload cluster of its own, Helm refuses to adopt the objects left by the other tests")
+		workloadEnv := &envtest.Environment{BinaryAssetsDirectory: testEnv.BinaryAssetsDirectory}
+		workloadCfg, err := workloadEnv.Start()
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(workloadEnv.Stop)
+		workloadClient, err := client.New(workloadCfg, client.Options{Scheme: scheme.Scheme})
+		Expect(err).NotTo(HaveOccurred())
+
+		jobsCtx, stopJobs := context.WithCancel(ctx)
+		DeferCleanup(stopJobs)
+		go completeJobs(jobsCtx, workloadClient)
+
+		By("Creating the CAPI Cluster and the addon")
+		Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})).To(Succeed())
+		cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "helm-cluster", Namespace: namespace}}
+		Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, cluster))).To(Succeed())
+		})
+		cluster.Status.ControlPlaneReady = true
+		Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+
+		addon := &addonv1alpha1.KubewardenAddon{
+			ObjectMeta: metav1.ObjectMeta{Name: "helm-addon", Namespace: namespace},
+			Spec:       addonv1alpha1.KubewardenAddonSpec{InstallMode: addonv1alpha1.InstallModeHelm},
+		}
+		Expect(k8sClient.Create(ctx, addon)).To(Succeed())
+		addonKey := client.ObjectKeyFromObject(addon)
+
+		controllerReconciler := &KubewardenAddonReconciler{
+			Client: k8sClient,
+			Scheme: k8sClient.Scheme(),
+			RemoteClientGetter: func(context.Context, string, client.Client, client.ObjectKey) (client.Client, error) {
+				return workloadClient, nil
+			},
+			RemoteRESTConfigGetter: func(context.Context, string, client.Reader, client.ObjectKey) (*rest.Config, error) {
+				return workloadCfg, nil
+			},
+		}
+
+		// expectReleased reconciles the addon and checks the cluster is ready with the given revision of the releases
+		expectReleased := func(g Gomega, revision int32) {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: addonKey})
+			g.Expect(err).NotTo(HaveOccurred())
+			markKubewardenHealthy(g, workloadClient)
+
+			g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+			g.Expect(cluster.GetAnnotations()).To(HaveKey(KubewardenHashAnnotation))
+			g.Expect(k8sClient.Get(ctx, addonKey, addon)).To(Succeed())
+			g.Expect(addon.Status.Clusters).To(ConsistOf(And(
+				HaveField("ClusterName", cluster.Name),
+				HaveField("Phase", addonv1alpha1.ClusterInstallationReady),
+				HaveField("AppliedHash", cluster.GetAnnotations()[KubewardenHashAnnotation]),
+				HaveField("HelmReleases", ConsistOf(
+					And(
+						HaveField("Name", kubewardenHelmReleaseNames[0]),
+						HaveField("Chart", HavePrefix(kubewardenControllerChartName)),
+						HaveField("Revision", revision),
+						HaveField("Status", "deployed"),
+					),
+					And(
+						HaveField("Name", kubewardenHelmReleaseNames[1]),
+						HaveField("Chart", HavePrefix(kubewardenDefaultsChartName)),
+						HaveField("Revision", revision),
+						HaveField("Status", "deployed"),
+					),
+				)),
+			)))
+		}
+
+		By("Installing the Helm releases")
+		Eventually(func(g Gomega) {
+			expectReleased(g, 1)
+		}).Should(Succeed())
+
+		deployment := &appsv1.Deployment{}
+		Expect(workloadClient.Get(ctx, client.ObjectKey{Name: kubewardenHelmReleaseName + "-kubewarden-controller", Namespace: kubewardenNamespace}, deployment)).To(Succeed())
+		Expect(deployment.GetAnnotations()).To(HaveKeyWithValue("meta.helm.sh/release-name", kubewardenHelmReleaseName))
+		hash := cluster.GetAnnotations()[KubewardenHashAnnotation]
+
+		By("Upgrading the Helm releases when the manifests change")
+		addonCopy := addon.DeepCopy()
+		addon.Spec.Scheduling.TolerateControlPlane = true
+		Expect(k8sClient.Patch(ctx, addon, client.MergeFrom(addonCopy))).To(Succeed())
+		Eventually(func(g Gomega) {
+			expectReleased(g, 2)
+			g.Expect(cluster.GetAnnotations()).NotTo(HaveKeyWithValue(KubewardenHashAnnotation, hash))
+		}).Should(Succeed())
+
+		By("Uninstalling the Helm releases when the addon is deleted")
+		Expect(k8sClient.Delete(ctx, addon)).To(Succeed())
+		Eventually(func(g Gomega) {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: addonKey})
+			g.Expect(err).NotTo(HaveOccurred())
+
+			releases := &corev1.SecretList{}
+			g.Expect(workloadClient.List(ctx, releases, client.InNamespace(kubewardenNamespace), client.MatchingLabels{"owner": "helm"})).To(Succeed())
+			g.Expect(releases.Items).To(BeEmpty())
+			err = workloadClient.Get(ctx, client.ObjectKeyFromObject(deployment), &appsv1.Deployment{})
+			g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+			err = k8sClient.Get(ctx, addonKey, &addonv1alpha1.KubewardenAddon{})
+			g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		}).Should(Succeed())
+	})
+})
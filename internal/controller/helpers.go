@@ -8,21 +8,42 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
-	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/registry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/log"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
 )
 
+// kubewardenPolicyKinds lists the Kubewarden policy kinds that must be removed before uninstalling Kubewarden.
+var kubewardenPolicyKinds = []string{
+	"ClusterAdmissionPolicy",
+	"AdmissionPolicy",
+	"ClusterAdmissionPolicyGroup",
+	"AdmissionPolicyGroup",
+}
+
 const (
 	deployToAll = true
 
@@ -35,9 +56,42 @@ const (
 	kubewardenHelmReleaseName             = "caapkw"
 	kubewardenHelmDefaultPolicyServerName = "default"
 
-	defaultRequeueDuration = 1 * time.Minute
+	kubewardenControllerImageName   = "kubewarden-controller"
+	kubewardenPolicyServerImageName = "policy-server"
+	kubewardenAuditScannerImageName = "audit-scanner"
+	dockerHubRegistry               = "docker.io"
+
+	defaultRequeueDuration  = 1 * time.Minute
+	deletionRequeueDuration = 10 * time.Second
+	upgradeRequeueDuration  = 15 * time.Second
+	failureRequeueDuration  = 30 * time.Second
+	driftCheckInterval      = 10 * time.Minute
+	healthCheckInterval     = 1 * time.Minute
+
+	// rolloutUnhealthyTimeout is how long a cluster being rolled out may stay unhealthy before the rollout counts
+	// it as failed, when the soak time is shorter
+	rolloutUnhealthyTimeout = 10 * time.Minute
+
+	// DefaultMaxConcurrentClusterReconciles is the default number of clusters of an addon reconciled in parallel
+	DefaultMaxConcurrentClusterReconciles = 10
 
+	// kubewardenFieldManager is the field manager used to server-side apply Kubewarden resources
+	kubewardenFieldManager = "caapkw"
+
+	// KubewardenInstalledAnnotation marked the clusters Kubewarden was installed on before the hash annotation
+	// existed. It is still honored, and replaced by the hash annotation on the next reconcile
 	KubewardenInstalledAnnotation = "caapkw.kubewarden.io/installed"
+	KubewardenVersionAnnotation   = "caapkw.kubewarden.io/version"
+
+	// KubewardenHashAnnotation records the hash of the Kubewarden manifests applied to the cluster
+	KubewardenHashAnnotation = "caapkw.kubewarden.io/hash"
+
+	// KubewardenAddonAnnotation records the name of the KubewardenAddon that installed Kubewarden on the cluster
+	KubewardenAddonAnnotation = "caapkw.kubewarden.io/addon"
+
+	// KubewardenAddonLabel selects the clusters for the ClusterResourceSet or the HelmChartProxies of the
+	// KubewardenAddon it names
+	KubewardenAddonLabel = "caapkw.kubewarden.io/addon"
 )
 
 func createKubewardenNamespace(ctx context.Context, remoteClient client.Client) error {
@@ -56,126 +110,322 @@ func createKubewardenNamespace(ctx context.Context, remoteClient client.Client)
 	return nil
 }
 
-// renderHelmChart downloads and renders a Helm chart. The `version` parameter is treated
-// as an appVersion hint; if provided, we resolve a chart version compatible with that
-// appVersion. If resolution is not implemented, we default to latest chart version.
-func renderHelmChart(ctx context.Context, name, version string, values map[string]interface{}) (string, error) {
-	_, settings, err := createActionConfig(ctx, kubewardenNamespace)
-	if err != nil {
-		return "", err
+// kubewardenAppVersion returns the Kubewarden app version to deploy for the given addon.
+func kubewardenAppVersion(addon *addonv1alpha1.KubewardenAddon) string {
+	// Use appVersion from spec if provided; otherwise default.
+	if addon.Spec.Version != "" {
+		return addon.Spec.Version
 	}
 
-	var chartPathOptions action.ChartPathOptions = action.ChartPathOptions{
-		RepoURL: kubewardenHelmChartURL,
-		// Chart version differs from appVersion; resolve chart version or use latest.
-		Version: resolveChartVersion(version, name),
+	return kubewardenVersion
+}
+
+// kubewardenControllerValues returns the values used to render the kubewarden-controller chart.
+func kubewardenControllerValues(addon *addonv1alpha1.KubewardenAddon) map[string]interface{} {
+	values := map[string]interface{}{}
+	auditScanner := auditScannerValues(addon.Spec.AuditScanner)
+
+	if prefix := addon.Spec.ImageRepositoryPrefix(); prefix != "" {
+		registry, repository := splitImageRepository(prefix)
+		values["global"] = imageRegistryValues(registry)
+		values["image"] = map[string]interface{}{
+			"repository": path.Join(repository, kubewardenControllerImageName),
+		}
+		auditScanner["image"] = map[string]interface{}{
+			"repository": path.Join(repository, kubewardenAuditScannerImageName),
+		}
 	}
 
-	chart, err := getChart(chartPathOptions, name, settings)
-	if err != nil {
-		return "", err
+	if len(auditScanner) > 0 {
+		values["auditScanner"] = auditScanner
+	}
+	if resources := auditScannerResourcesValues(addon.Spec.AuditScanner.Resources); len(resources) > 0 {
+		values["resources"] = map[string]interface{}{
+			"auditScanner": resources,
+		}
+	}
+
+	return values
+}
+
+// kubewardenDefaultsValues returns the values used to render the kubewarden-defaults chart.
+func kubewardenDefaultsValues(addon *addonv1alpha1.KubewardenAddon) map[string]interface{} {
+	policyServer := map[string]interface{}{}
+
+	config := addon.Spec.PolicyServerConfig
+	if config.Replicas > 0 {
+		policyServer["replicaCount"] = int64(config.Replicas)
+	}
+	if requests := resourceListValues(config.Resources.CPU, config.Resources.Memory); len(requests) > 0 {
+		policyServer["requests"] = requests
+	}
+	if limits := resourceListValues(config.Resources.Limits.CPU, config.Resources.Limits.Memory); len(limits) > 0 {
+		policyServer["limits"] = limits
+	}
+
+	values := map[string]interface{}{
+		"policyServer": policyServer,
+	}
+
+	if prefix := addon.Spec.ImageRepositoryPrefix(); prefix != "" {
+		registry, repository := splitImageRepository(prefix)
+		values["global"] = imageRegistryValues(registry)
+		policyServer["image"] = map[string]interface{}{
+			"repository": path.Join(repository, kubewardenPolicyServerImageName),
+		}
+	}
+
+	return values
+}
+
+// splitImageRepository splits an image repository prefix into the registry and the repository path. Like in image
+// references, the first component is a registry only if it looks like a host, otherwise images come from Docker Hub.
+func splitImageRepository(prefix string) (string, string) {
+	registry, repository, found := strings.Cut(prefix, "/")
+	if !found {
+		repository = ""
+	}
+	if !strings.ContainsAny(registry, ".:") && registry != "localhost" {
+		return dockerHubRegistry, prefix
+	}
+
+	return registry, repository
+}
+
+// imageRegistryValues returns the chart values setting the registry all the Kubewarden images are pulled from.
+func imageRegistryValues(registry string) map[string]interface{} {
+	return map[string]interface{}{
+		"cattle": map[string]interface{}{
+			"systemDefaultRegistry": registry,
+		},
+	}
+}
+
+// resourceListValues returns the chart values of a resource list, leaving out the unset resources.
+func resourceListValues(cpu, memory string) map[string]interface{} {
+	values := map[string]interface{}{}
+	if cpu != "" {
+		values["cpu"] = cpu
+	}
+	if memory != "" {
+		values["memory"] = memory
 	}
 
-	rendered, err := helmTemplate(TemplateConfig{
-		ReleaseName: kubewardenHelmReleaseName,
-		Namespace:   kubewardenNamespace,
-		Chart:       chart,
-		Values:      values,
+	return values
+}
+
+// deleteKubewardenResources deletes all the Kubewarden resources of the given kind from the cluster and returns
+// the number of resources that still exist. Kinds that are not served by the cluster are ignored.
+func deleteKubewardenResources(ctx context.Context, remoteClient client.Client, kind string) (int, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "policies.kubewarden.io",
+		Version: "v1",
+		Kind:    kind + "List",
 	})
-	if err != nil {
-		return "", err
+	if err := remoteClient.List(ctx, list); err != nil {
+		if meta.IsNoMatchError(err) || apierrors.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
 	}
 
-	renderedFile, err := os.CreateTemp("", "kubewarden-helm-rendered-*.yaml")
-	if err != nil {
-		return "", err
+	for i := range list.Items {
+		item := &list.Items[i]
+		if item.GetDeletionTimestamp() != nil {
+			continue
+		}
+		if err := remoteClient.Delete(ctx, item); err != nil && !apierrors.IsNotFound(err) {
+			return 0, err
+		}
 	}
-	defer func() {
-		if err := renderedFile.Close(); err != nil {
-			fmt.Printf("Error closing temporary file: %v\n", err)
+
+	// resources without finalizers are gone right away, check again
+	if err := remoteClient.List(ctx, list); err != nil {
+		if meta.IsNoMatchError(err) || apierrors.IsNotFound(err) {
+			return 0, nil
 		}
-	}()
+		return 0, err
+	}
 
-	_, err = renderedFile.WriteString(rendered)
-	if err != nil {
-		return "", err
+	return len(list.Items), nil
+}
+
+// deleteKubewardenPolicies deletes the Kubewarden policies and policy servers from the cluster and returns the
+// number of them that still exist.
+func deleteKubewardenPolicies(ctx context.Context, remoteClient client.Client) (int, error) {
+	remaining := 0
+	for _, kind := range append(append([]string{}, kubewardenPolicyKinds...), "PolicyServer") {
+		count, err := deleteKubewardenResources(ctx, remoteClient, kind)
+		if err != nil {
+			return 0, fmt.Errorf("deleting %s resources: %w", kind, err)
+		}
+		remaining += count
+	}
+
+	return remaining, nil
+}
+
+// deleteKubewardenObject deletes the object from the cluster and returns whether it existed.
+func deleteKubewardenObject(ctx context.Context, remoteClient client.Client, obj client.Object) (bool, error) {
+	if err := remoteClient.Delete(ctx, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+
+		return false, err
 	}
 
-	return renderedFile.Name(), nil
+	return true, nil
 }
 
-// resolveChartVersion attempts to map an appVersion (e.g., "v1.18.0") to a chart version.
-// If appVersion is empty, or mapping isn't implemented, returns empty string so Helm uses latest.
-// In future, this can fetch index.yaml and match entries by appVersion.
-func resolveChartVersion(appVersion string, chartName string) string {
-	if appVersion == "" {
-		return ""
+// isObjectRendered returns whether the objects include the one of the given kind and name.
+func isObjectRendered(objs []client.Object, kind, name string) bool {
+	for _, obj := range objs {
+		if obj.GetObjectKind().GroupVersionKind().Kind == kind && obj.GetName() == name {
+			return true
+		}
 	}
-	// TODO: Implement index.yaml resolution to match by appVersion.
-	// For now, return empty to let Helm pull the latest chart version compatible with current repo.
-	return ""
+
+	return false
 }
 
-func createActionConfig(ctx context.Context, targetNamespace string) (*action.Configuration, *cli.EnvSettings, error) {
-	log := log.FromContext(ctx)
-	settings := cli.New()
-	actionConfig := new(action.Configuration)
+// isAppliedByKubewarden returns whether the provider applied the object, according to its managed fields.
+func isAppliedByKubewarden(obj client.Object) bool {
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager == kubewardenFieldManager {
+			return true
+		}
+	}
 
-	err := actionConfig.Init(settings.RESTClientGetter(), targetNamespace, os.Getenv("HELM_DRIVER"), log.Info)
+	return false
+}
 
-	return actionConfig, settings, err
+// applyObject applies the object to the cluster using server-side apply, taking ownership of conflicting fields.
+func applyObject(ctx context.Context, k8sClient client.Client, obj client.Object) error {
+	return k8sClient.Patch(ctx, obj, client.Apply, client.FieldOwner(kubewardenFieldManager), client.ForceOwnership)
 }
 
-func getChart(chartPathOption action.ChartPathOptions, chartName string, settings *cli.EnvSettings) (*chart.Chart, error) {
-	chartPath, err := chartPathOption.LocateChart(chartName, settings)
-	if err != nil {
-		return nil, err
+// hasObjectDrifted returns true if applying the object would change it in the cluster, i.e. it is missing or
+// somebody else changed the fields that are managed by the provider.
+func hasObjectDrifted(ctx context.Context, k8sClient client.Client, obj client.Object) (bool, error) {
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(obj.GetObjectKind().GroupVersionKind())
+	if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
 	}
 
-	chart, err := loader.Load(chartPath)
+	// a dry-run apply returns the object as it would be once the desired state is applied
+	desired, ok := obj.DeepCopyObject().(client.Object)
+	if !ok {
+		return false, fmt.Errorf("failed to cast runtime object to client.Object")
+	}
+	if err := k8sClient.Patch(ctx, desired, client.Apply, client.FieldOwner(kubewardenFieldManager),
+		client.ForceOwnership, client.DryRunAll); err != nil {
+		return false, err
+	}
+	desiredContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 
-	return chart, nil
+	return !equality.Semantic.DeepEqual(withoutServerFields(live.UnstructuredContent()), withoutServerFields(desiredContent)), nil
 }
 
-// downloadFile downloads a file from a URL and returns the local path
-func downloadFile(url string) (string, error) {
-	response, err := http.Get(url)
-	if err != nil {
-		return "", fmt.Errorf("failed to download file: %w", err)
+// countDriftedObjects returns how many of the given objects drifted from their desired state in the cluster.
+func countDriftedObjects(ctx context.Context, k8sClient client.Client, objs []client.Object) (int, error) {
+	drifted := 0
+	for _, desired := range objs {
+		hasDrifted, err := hasObjectDrifted(ctx, k8sClient, desired.DeepCopyObject().(client.Object))
+		if err != nil {
+			return 0, fmt.Errorf("failed to check resource drift: %w", err)
+		}
+		if hasDrifted {
+			drifted++
+		}
 	}
-	defer func() {
-		if err := response.Body.Close(); err != nil {
-			fmt.Printf("Error closing response body: %v\n", err)
+
+	return drifted, nil
+}
+
+// withoutServerFields returns a copy of the object without the fields that are maintained by the API server.
+func withoutServerFields(obj map[string]interface{}) map[string]interface{} {
+	obj = runtime.DeepCopyJSON(obj)
+	unstructured.RemoveNestedField(obj, "metadata", "managedFields")
+	unstructured.RemoveNestedField(obj, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(obj, "metadata", "generation")
+	unstructured.RemoveNestedField(obj, "status")
+
+	return obj
+}
+
+// isDeploymentAvailable returns true if the Deployment in the kubewarden namespace has rolled out and all its
+// replicas are available.
+func isDeploymentAvailable(ctx context.Context, remoteClient client.Client, name string) (bool, error) {
+	deployment := &appsv1.Deployment{}
+	if err := remoteClient.Get(ctx, client.ObjectKey{Name: name, Namespace: kubewardenNamespace}, deployment); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
 		}
-	}()
+		return false, err
+	}
 
-	if response.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to download file: HTTP %d", response.StatusCode)
+	if deployment.Status.ObservedGeneration < deployment.Generation {
+		return false, nil
 	}
 
-	tempFile, err := os.CreateTemp("", "kubewarden-*.tar.gz")
-	if err != nil {
-		return "", fmt.Errorf("failed to create temp file: %w", err)
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
 	}
-	defer func() {
-		if err := tempFile.Close(); err != nil {
-			fmt.Printf("Error closing temp file: %v\n", err)
+
+	return deployment.Status.UpdatedReplicas >= replicas &&
+		deployment.Status.Replicas == deployment.Status.UpdatedReplicas &&
+		deployment.Status.AvailableReplicas >= replicas, nil
+}
+
+// areCRDsEstablished returns true once the API server established all the given CRDs, so the objects of their new
+// versions can be served.
+func areCRDsEstablished(ctx context.Context, remoteClient client.Client, crds []client.Object) (bool, error) {
+	for _, obj := range crds {
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := remoteClient.Get(ctx, client.ObjectKey{Name: obj.GetName()}, crd); err != nil {
+			if apierrors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
 		}
-	}()
 
-	_, err = io.Copy(tempFile, response.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to write file: %w", err)
+		established := false
+		for _, condition := range crd.Status.Conditions {
+			if condition.Type == apiextensionsv1.Established && condition.Status == apiextensionsv1.ConditionTrue {
+				established = true
+			}
+		}
+		if !established {
+			return false, nil
+		}
 	}
 
-	return tempFile.Name(), nil
+	return true, nil
 }
 
-// extractTarGz extracts a tar.gz file to a temporary directory
-func extractTarGz(tarGzPath string) (string, error) {
+// newRegistryClient returns a client of OCI registries, using the registry credentials of the Helm settings and the
+// given HTTP client.
+func newRegistryClient(settings *cli.EnvSettings, httpClient *http.Client) (*registry.Client, error) {
+	return registry.NewClient(
+		registry.ClientOptCredentialsFile(settings.RegistryConfig),
+		registry.ClientOptEnableCache(true),
+		registry.ClientOptHTTPClient(httpClient),
+	)
+}
+
+// extractTarGz extracts the regular files of a tar.gz file to a temporary directory. Entries escaping the directory,
+// links and special files are rejected, and the extracted files can't exceed maxSize bytes in total.
+func extractTarGz(tarGzPath string, maxSize int64) (string, error) {
 	file, err := os.Open(tarGzPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to open tar.gz file: %w", err)
@@ -201,39 +451,74 @@ func extractTarGz(tarGzPath string) (string, error) {
 		return "", fmt.Errorf("failed to create temp directory: %w", err)
 	}
 
-	tarReader := tar.NewReader(gzipReader)
+	if err := extractTar(tar.NewReader(gzipReader), extractDir, maxSize); err != nil {
+		if err := os.RemoveAll(extractDir); err != nil {
+			fmt.Printf("Error removing extracted files: %v\n", err)
+		}
+
+		return "", err
+	}
+
+	return extractDir, nil
+}
+
+// extractTar extracts the regular files of the tar archive to the given directory.
+func extractTar(tarReader *tar.Reader, dir string, maxSize int64) error {
+	remaining := maxSize
 	for {
 		header, err := tarReader.Next()
 		if err == io.EOF {
-			break
+			return nil
 		}
 		if err != nil {
-			return "", fmt.Errorf("failed to read tar header: %w", err)
+			return fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		if !filepath.IsLocal(header.Name) {
+			return fmt.Errorf("unsafe path %s in archive", header.Name)
 		}
 
-		// Skip directories
-		if header.Typeflag == tar.TypeDir {
+		switch header.Typeflag {
+		case tar.TypeDir:
+			// directories are created along with the files they hold
 			continue
+		case tar.TypeReg:
+		default:
+			return fmt.Errorf("unsupported entry %s of type %c in archive", header.Name, header.Typeflag)
 		}
 
-		// Write each file
-		targetPath := filepath.Join(extractDir, header.Name)
-		outFile, err := os.Create(targetPath)
-		if err != nil {
-			return "", fmt.Errorf("failed to create file %s: %w", targetPath, err)
+		if header.Size > remaining {
+			return fmt.Errorf("archive is larger than %d bytes once extracted", maxSize)
 		}
-		defer func() {
-			if err := outFile.Close(); err != nil {
-				fmt.Printf("Error closing file: %v\n", err)
-			}
-		}()
+		remaining -= header.Size
 
-		if _, err := io.Copy(outFile, tarReader); err != nil {
-			return "", fmt.Errorf("failed to write file %s: %w", targetPath, err)
+		targetPath := filepath.Join(dir, header.Name)
+		if err := os.MkdirAll(filepath.Dir(targetPath), 0o755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", targetPath, err)
+		}
+		if err := writeTarFile(tarReader, targetPath, header.Size); err != nil {
+			return err
 		}
 	}
+}
 
-	return extractDir, nil
+// writeTarFile writes the current file of the tar archive, of the given size, to the target path.
+func writeTarFile(tarReader *tar.Reader, targetPath string, size int64) error {
+	outFile, err := os.OpenFile(targetPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", targetPath, err)
+	}
+	defer func() {
+		if err := outFile.Close(); err != nil {
+			fmt.Printf("Error closing file: %v\n", err)
+		}
+	}()
+
+	if _, err := io.CopyN(outFile, tarReader, size); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", targetPath, err)
+	}
+
+	return nil
 }
 
 type TemplateConfig struct {
@@ -264,6 +549,27 @@ func helmTemplate(config TemplateConfig) (string, error) {
 	return rel.Manifest, nil
 }
 
+// isClusterPaused returns whether the cluster is paused with spec.paused or the cluster.x-k8s.io/paused annotation,
+// like during a clusterctl move. Paused clusters must be left untouched.
+func isClusterPaused(cluster *clusterv1.Cluster) bool {
+	return annotations.IsPaused(cluster, cluster)
+}
+
+// setPausedCondition reports whether the reconciliation of the object, or of some of its selected clusters, is
+// paused.
+func setPausedCondition(obj conditions.Setter, paused bool, pausedClusters []string) {
+	switch {
+	case paused:
+		conditions.MarkTrueWithNegativePolarity(obj, addonv1alpha1.PausedCondition, addonv1alpha1.PausedReason,
+			clusterv1.ConditionSeverityInfo, "Reconciliation is paused by spec.paused")
+	case len(pausedClusters) > 0:
+		conditions.MarkTrueWithNegativePolarity(obj, addonv1alpha1.PausedCondition, addonv1alpha1.ClustersPausedReason,
+			clusterv1.ConditionSeverityInfo, "Paused clusters are left untouched: %s", strings.Join(pausedClusters, ", "))
+	default:
+		conditions.MarkFalseWithNegativePolarity(obj, addonv1alpha1.PausedCondition)
+	}
+}
+
 // HasAnnotation returns true if the object has the specified annotation.
 func HasAnnotation(o metav1.Object, annotation string) bool {
 	annotations := o.GetAnnotations()
@@ -275,3 +581,9 @@ func HasAnnotation(o metav1.Object, annotation string) bool {
 
 	return ok
 }
+
+// isKubewardenInstalled returns whether the cluster is annotated with Kubewarden installed, either with the hash of
+// the applied manifests or with the legacy installed annotation.
+func isKubewardenInstalled(cluster *clusterv1.Cluster) bool {
+	return HasAnnotation(cluster, KubewardenHashAnnotation) || HasAnnotation(cluster, KubewardenInstalledAnnotation)
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+var _ = Describe("Kubewarden chart values", func() {
+	Context("When building the kubewarden-defaults values", func() {
+		It("should map the policy server config", func() {
+			addon := &addonv1alpha1.KubewardenAddon{
+				Spec: addonv1alpha1.KubewardenAddonSpec{
+					PolicyServerConfig: addonv1alpha1.PolicyServerConfig{
+						Replicas: 3,
+						Resources: addonv1alpha1.ResourceRequirements{
+							CPU: "100m",
+							Limits: addonv1alpha1.ResourceLimits{
+								Memory: "512Mi",
+							},
+						},
+					},
+				},
+			}
+
+			policyServer := kubewardenDefaultsValues(addon)["policyServer"].(map[string]interface{})
+			Expect(policyServer).To(HaveKeyWithValue("replicaCount", int64(3)))
+			Expect(policyServer).To(HaveKeyWithValue("requests", map[string]interface{}{"cpu": "100m"}))
+			Expect(policyServer).To(HaveKeyWithValue("limits", map[string]interface{}{"memory": "512Mi"}))
+		})
+
+		It("should keep the chart defaults when the policy server config is empty", func() {
+			policyServer := kubewardenDefaultsValues(&addonv1alpha1.KubewardenAddon{})["policyServer"].(map[string]interface{})
+			Expect(policyServer).NotTo(HaveKey("replicaCount"))
+			Expect(policyServer).NotTo(HaveKey("requests"))
+			Expect(policyServer).NotTo(HaveKey("limits"))
+			Expect(policyServer).NotTo(HaveKey("image"))
+		})
+	})
+
+	Context("When an image repository is set", func() {
+		It("should pull every Kubewarden image from the repository", func() {
+			addon := &addonv1alpha1.KubewardenAddon{
+				Spec: addonv1alpha1.KubewardenAddonSpec{
+					ImageRepository: "registry.example.com:5000/mirror/kubewarden",
+				},
+			}
+			registry := map[string]interface{}{
+				"cattle": map[string]interface{}{"systemDefaultRegistry": "registry.example.com:5000"},
+			}
+
+			controllerValues := kubewardenControllerValues(addon)
+			Expect(controllerValues).To(HaveKeyWithValue("global", registry))
+			Expect(controllerValues).To(HaveKeyWithValue("image", map[string]interface{}{
+				"repository": "mirror/kubewarden/kubewarden-controller",
+			}))
+			Expect(controllerValues).To(HaveKeyWithValue("auditScanner", map[string]interface{}{
+				"image": map[string]interface{}{"repository": "mirror/kubewarden/audit-scanner"},
+			}))
+
+			defaultsValues := kubewardenDefaultsValues(addon)
+			Expect(defaultsValues).To(HaveKeyWithValue("global", registry))
+			Expect(defaultsValues["policyServer"]).To(HaveKeyWithValue("image", map[string]interface{}{
+				"repository": "mirror/kubewarden/policy-server",
+			}))
+		})
+
+		It("should split registries from repository paths", func() {
+			registry, repository := splitImageRepository("ghcr.io/kubewarden")
+			Expect(registry).To(Equal("ghcr.io"))
+			Expect(repository).To(Equal("kubewarden"))
+
+			registry, repository = splitImageRepository("localhost:5000")
+			Expect(registry).To(Equal("localhost:5000"))
+			Expect(repository).To(BeEmpty())
+
+			registry, repository = splitImageRepository("kubewarden")
+			Expect(registry).To(Equal("docker.io"))
+			Expect(repository).To(Equal("kubewarden"))
+		})
+
+		It("should use the prefix of legacy image references", func() {
+			addon := &addonv1alpha1.KubewardenAddon{
+				Spec: addonv1alpha1.KubewardenAddonSpec{
+					ImageRepository: "ghcr.io/kubewarden/kubewarden-controller:v1.18.0",
+				},
+			}
+
+			Expect(kubewardenControllerValues(addon)).To(HaveKeyWithValue("image", map[string]interface{}{
+				"repository": "kubewarden/kubewarden-controller",
+			}))
+		})
+	})
+})
+
+var _ = Describe("Paused reconciliation", func() {
+	It("should detect clusters paused with the spec or the annotation", func() {
+		cluster := &clusterv1.Cluster{}
+		Expect(isClusterPaused(cluster)).To(BeFalse())
+
+		cluster.Spec.Paused = true
+		Expect(isClusterPaused(cluster)).To(BeTrue())
+
+		cluster.Spec.Paused = false
+		cluster.Annotations = map[string]string{clusterv1.PausedAnnotation: ""}
+		Expect(isClusterPaused(cluster)).To(BeTrue())
+	})
+
+	It("should report the paused object or clusters in the Paused condition", func() {
+		policy := &addonv1alpha1.KubewardenPolicy{}
+
+		setPausedCondition(policy, true, nil)
+		Expect(conditions.IsTrue(policy, addonv1alpha1.PausedCondition)).To(BeTrue())
+		Expect(conditions.GetReason(policy, addonv1alpha1.PausedCondition)).To(Equal(addonv1alpha1.PausedReason))
+
+		setPausedCondition(policy, false, []string{"cluster-a", "cluster-b"})
+		Expect(conditions.GetReason(policy, addonv1alpha1.PausedCondition)).To(Equal(addonv1alpha1.ClustersPausedReason))
+		Expect(conditions.GetMessage(policy, addonv1alpha1.PausedCondition)).To(ContainSubstring("cluster-a, cluster-b"))
+
+		setPausedCondition(policy, false, nil)
+		Expect(conditions.IsFalse(policy, addonv1alpha1.PausedCondition)).To(BeTrue())
+	})
+})
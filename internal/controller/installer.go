@@ -0,0 +1,596 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+const (
+	// clusterResourceSetMaxDataSize is the maximum size of the manifests held by a single ConfigMap or Secret of a
+	// ClusterResourceSet, well under the size limit of the objects stored by the API server
+	clusterResourceSetMaxDataSize = 512 << 10
+
+	// helmChartProxyLabel is set by the Cluster API Addon Provider for Helm on the HelmReleaseProxies of a
+	// HelmChartProxy, with the name of the HelmChartProxy
+	helmChartProxyLabel = "helmchartproxy.addons.cluster.x-k8s.io/name"
+)
+
+var (
+	helmChartProxyGVK       = schema.GroupVersionKind{Group: "addons.cluster.x-k8s.io", Version: "v1alpha1", Kind: "HelmChartProxy"}
+	helmReleaseProxyListGVK = schema.GroupVersionKind{Group: "addons.cluster.x-k8s.io", Version: "v1alpha1", Kind: "HelmReleaseProxyList"}
+)
+
+// errInstallModeNotAvailable is returned when the management cluster does not serve the API the install mode of an
+// addon relies on.
+var errInstallModeNotAvailable = errors.New("install mode not available")
+
+// kubewardenInstaller installs Kubewarden on the selected clusters of an addon, following its install mode.
+type kubewardenInstaller interface {
+	// prepare creates or updates the objects the install mode shares between the selected clusters of the addon.
+	// It is called once per reconcile, before the clusters are reconciled.
+	prepare(ctx context.Context, addon *addonv1alpha1.KubewardenAddon, release *kubewardenRelease, values *kubewardenChartValues, manifests *kubewardenManifests) error
+
+	// reconcileCluster installs, upgrades or checks Kubewarden on a selected cluster, recording the outcome in the
+	// cluster installation status. It returns when the cluster should be checked again. It is called concurrently
+	// for the clusters of an addon and must not modify the addon.
+	reconcileCluster(ctx context.Context, addonName string, cluster *clusterv1.Cluster, status *addonv1alpha1.ClusterInstallationStatus, release *kubewardenRelease, manifests *kubewardenManifests, desiredHash string, phases *clusterPhasePublisher) (time.Duration, error)
+
+	// uninstall removes Kubewarden from the cluster. It returns false while resources are still being deleted.
+	uninstall(ctx context.Context, cluster *clusterv1.Cluster, addon *addonv1alpha1.KubewardenAddon) (bool, error)
+}
+
+// installer returns the installer of the install mode of the addon.
+func (r *KubewardenAddonReconciler) installer(addon *addonv1alpha1.KubewardenAddon) kubewardenInstaller {
+	switch addon.Spec.InstallMode {
+	case addonv1alpha1.InstallModeHelm:
+		return &helmInstaller{r: r}
+	case addonv1alpha1.InstallModeClusterResourceSet:
+		return &clusterResourceSetInstaller{r: r}
+	case addonv1alpha1.InstallModeHelmChartProxy:
+		return &helmChartProxyInstaller{r: r}
+	default:
+		return &directInstaller{r: r}
+	}
+}
+
+// directInstaller applies the rendered manifests to the clusters with their own client.
+type directInstaller struct {
+	r *KubewardenAddonReconciler
+}
+
+func (i *directInstaller) prepare(context.Context, *addonv1alpha1.KubewardenAddon, *kubewardenRelease, *kubewardenChartValues, *kubewardenManifests) error {
+	return nil
+}
+
+func (i *directInstaller) reconcileCluster(ctx context.Context, addonName string, cluster *clusterv1.Cluster, status *addonv1alpha1.ClusterInstallationStatus, release *kubewardenRelease, manifests *kubewardenManifests, desiredHash string, phases *clusterPhasePublisher) (time.Duration, error) {
+	return i.r.reconcileCluster(ctx, addonName, cluster, status, release, manifests, desiredHash, phases)
+}
+
+func (i *directInstaller) uninstall(ctx context.Context, cluster *clusterv1.Cluster, addon *addonv1alpha1.KubewardenAddon) (bool, error) {
+	return i.r.uninstallKubewarden(ctx, cluster, addon)
+}
+
+// clusterResourceSetInstaller hands the rendered manifests over to a ClusterResourceSet, which applies them to the
+// clusters labelled for the addon.
+type clusterResourceSetInstaller struct {
+	r *KubewardenAddonReconciler
+}
+
+// prepare stores the rendered manifests in ConfigMaps, and Secrets for the rendered Secrets, referenced by the
+// ClusterResourceSet of the addon. ConfigMaps and Secrets the manifests don't need anymore are removed.
+func (i *clusterResourceSetInstaller) prepare(ctx context.Context, addon *addonv1alpha1.KubewardenAddon, _ *kubewardenRelease, _ *kubewardenChartValues, manifests *kubewardenManifests) error {
+	resources, err := clusterResourceSetResources(addon, manifests)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range append(resources, clusterResourceSet(addon, resources)) {
+		if err := controllerutil.SetControllerReference(addon, obj, i.r.Scheme); err != nil {
+			return fmt.Errorf("setting owner of %s %s: %w", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), err)
+		}
+		if err := applyObject(ctx, i.r.Client, obj); err != nil {
+			if meta.IsNoMatchError(err) {
+				return fmt.Errorf("%w: %w", errInstallModeNotAvailable, err)
+			}
+
+			return fmt.Errorf("applying %s %s: %w", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), err)
+		}
+	}
+
+	// the ClusterResourceSet no longer references the resources of larger manifests
+	current := map[string]bool{}
+	for _, obj := range resources {
+		current[obj.GetObjectKind().GroupVersionKind().Kind+"/"+obj.GetName()] = true
+	}
+	for _, list := range []client.ObjectList{&corev1.ConfigMapList{}, &corev1.SecretList{}} {
+		if err := i.r.Client.List(ctx, list, client.InNamespace(addon.Namespace), client.MatchingLabels{KubewardenAddonLabel: addon.Name}); err != nil {
+			return fmt.Errorf("listing ClusterResourceSet resources: %w", err)
+		}
+		stale := []client.Object{}
+		switch list := list.(type) {
+		case *corev1.ConfigMapList:
+			for n := range list.Items {
+				if !current["ConfigMap/"+list.Items[n].Name] && metav1.IsControlledBy(&list.Items[n], addon) {
+					stale = append(stale, &list.Items[n])
+				}
+			}
+		case *corev1.SecretList:
+			for n := range list.Items {
+				if !current["Secret/"+list.Items[n].Name] && metav1.IsControlledBy(&list.Items[n], addon) {
+					stale = append(stale, &list.Items[n])
+				}
+			}
+		}
+		for _, obj := range stale {
+			if err := i.r.Client.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("deleting stale ClusterResourceSet resource %s: %w", obj.GetName(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (i *clusterResourceSetInstaller) reconcileCluster(ctx context.Context, addonName string, cluster *clusterv1.Cluster, status *addonv1alpha1.ClusterInstallationStatus, release *kubewardenRelease, manifests *kubewardenManifests, desiredHash string, phases *clusterPhasePublisher) (time.Duration, error) {
+	// the ClusterResourceSet applied the manifests once none of the objects differs from them
+	rolledOut := func(ctx context.Context, remoteClient client.Client) (bool, error) {
+		for _, objs := range [][]client.Object{manifests.CRDs, manifests.Controller, manifests.Defaults} {
+			for _, obj := range objs {
+				drifted, err := hasObjectDrifted(ctx, remoteClient, obj)
+				if err != nil {
+					// the CRDs of the custom resources are not applied yet
+					if meta.IsNoMatchError(err) {
+						return false, nil
+					}
+
+					return false, fmt.Errorf("checking %s %s: %w", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), err)
+				}
+				if drifted {
+					return false, nil
+				}
+			}
+		}
+
+		return true, nil
+	}
+
+	return i.r.reconcileDelegatedCluster(ctx, addonName, cluster, status, release, manifests, desiredHash, phases, rolledOut)
+}
+
+// uninstall stops the ClusterResourceSet from applying the manifests to the cluster, then removes Kubewarden like
+// the direct install mode: ClusterResourceSets never delete the objects they applied.
+func (i *clusterResourceSetInstaller) uninstall(ctx context.Context, cluster *clusterv1.Cluster, addon *addonv1alpha1.KubewardenAddon) (bool, error) {
+	if err := i.r.removeClusterLabels(ctx, cluster, KubewardenAddonLabel); err != nil {
+		return false, err
+	}
+
+	return i.r.uninstallKubewarden(ctx, cluster, addon)
+}
+
+// clusterResourceSetResources returns the ConfigMaps and Secrets holding the manifests applied by the
+// ClusterResourceSet of the addon, in the order they must be applied: the kubewarden namespace and the CRDs, the
+// rendered Secrets, then the kubewarden-controller and the kubewarden-defaults charts. Manifests are split across
+// several objects when they are too large for one.
+func clusterResourceSetResources(addon *addonv1alpha1.KubewardenAddon, manifests *kubewardenManifests) ([]client.Object, error) {
+	namespace := &unstructured.Unstructured{}
+	namespace.SetAPIVersion("v1")
+	namespace.SetKind("Namespace")
+	namespace.SetName(kubewardenNamespace)
+
+	// Secrets are never stored in ConfigMaps
+	secrets := []client.Object{}
+	withoutSecrets := func(objs []client.Object) []client.Object {
+		filtered := []client.Object{}
+		for _, obj := range objs {
+			if obj.GetObjectKind().GroupVersionKind().Kind == "Secret" {
+				secrets = append(secrets, obj)
+				continue
+			}
+			filtered = append(filtered, obj)
+		}
+
+		return filtered
+	}
+	crds := append([]client.Object{namespace}, withoutSecrets(manifests.CRDs)...)
+	controller := withoutSecrets(manifests.Controller)
+	defaults := withoutSecrets(manifests.Defaults)
+
+	components := []struct {
+		name   string
+		secret bool
+		objs   []client.Object
+	}{
+		{name: "crds", objs: crds},
+		{name: "secrets", secret: true, objs: secrets},
+		{name: "controller", objs: controller},
+		{name: "defaults", objs: defaults},
+	}
+
+	resources := []client.Object{}
+	for _, component := range components {
+		chunks, err := chunkManifests(component.objs)
+		if err != nil {
+			return nil, fmt.Errorf("serializing %s manifests: %w", component.name, err)
+		}
+
+		for n, data := range chunks {
+			objectMeta := metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-kubewarden-%s-%d", addon.Name, component.name, n),
+				Namespace: addon.Namespace,
+				Labels:    map[string]string{KubewardenAddonLabel: addon.Name},
+			}
+			if component.secret {
+				secret := &corev1.Secret{
+					TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+					ObjectMeta: objectMeta,
+					Type:       addonsv1.ClusterResourceSetSecretType,
+					Data:       map[string][]byte{},
+				}
+				for key, manifest := range data {
+					secret.Data[key] = []byte(manifest)
+				}
+				resources = append(resources, secret)
+				continue
+			}
+
+			resources = append(resources, &corev1.ConfigMap{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				ObjectMeta: objectMeta,
+				Data:       data,
+			})
+		}
+	}
+
+	return resources, nil
+}
+
+// chunkManifests serializes the objects into chunks of at most clusterResourceSetMaxDataSize bytes, unless a single
+// object is larger. ClusterResourceSets apply the keys of a resource in alphabetical order, so keys follow the
+// order of the objects.
+func chunkManifests(objs []client.Object) ([]map[string]string, error) {
+	chunks := []map[string]string{}
+	size := 0
+	for n, obj := range objs {
+		manifest, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("serializing %s %s: %w", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), err)
+		}
+
+		if len(chunks) == 0 || size+len(manifest) > clusterResourceSetMaxDataSize {
+			chunks = append(chunks, map[string]string{})
+			size = 0
+		}
+		chunks[len(chunks)-1][fmt.Sprintf("%03d.yaml", n)] = string(manifest)
+		size += len(manifest)
+	}
+
+	return chunks, nil
+}
+
+// clusterResourceSet returns the ClusterResourceSet applying the given resources to the clusters labelled for the
+// addon. The Reconcile strategy applies the resources again whenever they change, upgrading Kubewarden.
+func clusterResourceSet(addon *addonv1alpha1.KubewardenAddon, resources []client.Object) *addonsv1.ClusterResourceSet {
+	crs := &addonsv1.ClusterResourceSet{
+		TypeMeta: metav1.TypeMeta{APIVersion: addonsv1.GroupVersion.String(), Kind: "ClusterResourceSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      addon.Name + "-kubewarden",
+			Namespace: addon.Namespace,
+			Labels:    map[string]string{KubewardenAddonLabel: addon.Name},
+		},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{KubewardenAddonLabel: addon.Name},
+			},
+		},
+	}
+	crs.Spec.SetTypedStrategy(addonsv1.ClusterResourceSetStrategyReconcile)
+	for _, obj := range resources {
+		crs.Spec.Resources = append(crs.Spec.Resources, addonsv1.ResourceRef{
+			Name: obj.GetName(),
+			Kind: obj.GetObjectKind().GroupVersionKind().Kind,
+		})
+	}
+
+	return crs
+}
+
+// helmChartProxyInstaller creates HelmChartProxies installing the Kubewarden charts with the Cluster API Addon
+// Provider for Helm on the clusters labelled for the addon.
+type helmChartProxyInstaller struct {
+	r *KubewardenAddonReconciler
+}
+
+// prepare creates or updates the HelmChartProxies of the kubewarden-crds, kubewarden-controller and
+// kubewarden-defaults charts of the release.
+func (i *helmChartProxyInstaller) prepare(ctx context.Context, addon *addonv1alpha1.KubewardenAddon, release *kubewardenRelease, values *kubewardenChartValues, _ *kubewardenManifests) error {
+	proxies, err := helmChartProxies(addon, release, values)
+	if err != nil {
+		return err
+	}
+
+	for _, proxy := range proxies {
+		if err := controllerutil.SetControllerReference(addon, proxy, i.r.Scheme); err != nil {
+			return fmt.Errorf("setting owner of HelmChartProxy %s: %w", proxy.GetName(), err)
+		}
+		if err := applyObject(ctx, i.r.Client, proxy); err != nil {
+			if meta.IsNoMatchError(err) {
+				return fmt.Errorf("%w: %w", errInstallModeNotAvailable, err)
+			}
+
+			return fmt.Errorf("applying HelmChartProxy %s: %w", proxy.GetName(), err)
+		}
+	}
+
+	return nil
+}
+
+func (i *helmChartProxyInstaller) reconcileCluster(ctx context.Context, addonName string, cluster *clusterv1.Cluster, status *addonv1alpha1.ClusterInstallationStatus, release *kubewardenRelease, manifests *kubewardenManifests, desiredHash string, phases *clusterPhasePublisher) (time.Duration, error) {
+	// the charts are rolled out once the HelmReleaseProxies of the cluster are ready with the version and the
+	// values of their HelmChartProxy
+	rolledOut := func(ctx context.Context, _ client.Client) (bool, error) {
+		for _, chart := range []string{kubewardenCRDsChartName, kubewardenControllerChartName, kubewardenDefaultsChartName} {
+			proxy := &unstructured.Unstructured{}
+			proxy.SetGroupVersionKind(helmChartProxyGVK)
+			key := client.ObjectKey{Name: helmChartProxyName(addonName, chart), Namespace: cluster.Namespace}
+			if err := i.r.Client.Get(ctx, key, proxy); err != nil {
+				return false, fmt.Errorf("getting HelmChartProxy %s: %w", key.Name, err)
+			}
+
+			releases := &unstructured.UnstructuredList{}
+			releases.SetGroupVersionKind(helmReleaseProxyListGVK)
+			if err := i.r.Client.List(ctx, releases, client.InNamespace(cluster.Namespace), client.MatchingLabels{
+				helmChartProxyLabel:        key.Name,
+				clusterv1.ClusterNameLabel: cluster.Name,
+			}); err != nil {
+				return false, fmt.Errorf("listing HelmReleaseProxies of %s: %w", key.Name, err)
+			}
+			if len(releases.Items) != 1 || !isHelmReleaseProxyUpToDate(&releases.Items[0], proxy) {
+				return false, nil
+			}
+		}
+
+		return true, nil
+	}
+
+	return i.r.reconcileDelegatedCluster(ctx, addonName, cluster, status, release, manifests, desiredHash, phases, rolledOut)
+}
+
+// uninstall deletes the policies and the policy servers while the kubewarden-controller is still there to clear
+// their finalizers, then stops selecting the cluster so the Cluster API Addon Provider for Helm uninstalls the
+// charts. It returns false until the kubewarden-controller is gone.
+func (i *helmChartProxyInstaller) uninstall(ctx context.Context, cluster *clusterv1.Cluster, _ *addonv1alpha1.KubewardenAddon) (bool, error) {
+	log := log.FromContext(ctx)
+
+	remoteClient, err := i.r.RemoteClientGetter(ctx, cluster.Name, i.r.Client, client.ObjectKeyFromObject(cluster))
+	if err != nil {
+		return false, fmt.Errorf("getting remote cluster client: %w", err)
+	}
+
+	log.Info("Deleting Kubewarden policies and policy servers", "cluster", cluster.Name)
+	remaining, err := deleteKubewardenPolicies(ctx, remoteClient)
+	if err != nil {
+		return false, err
+	}
+	if remaining > 0 {
+		return false, nil
+	}
+
+	log.Info("Uninstalling Kubewarden charts", "cluster", cluster.Name)
+	if err := i.r.removeClusterLabels(ctx, cluster, KubewardenAddonLabel); err != nil {
+		return false, err
+	}
+
+	deployment := &unstructured.Unstructured{}
+	deployment.SetAPIVersion("apps/v1")
+	deployment.SetKind("Deployment")
+	key := client.ObjectKey{Name: kubewardenHelmReleaseName + "-kubewarden-controller", Namespace: kubewardenNamespace}
+	if err := remoteClient.Get(ctx, key, deployment); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+
+		return false, fmt.Errorf("checking Deployment %s: %w", key.Name, err)
+	}
+
+	return false, nil
+}
+
+// helmChartProxyName returns the name of the HelmChartProxy of the given chart for the addon.
+func helmChartProxyName(addonName, chart string) string {
+	return addonName + "-" + chart
+}
+
+// helmChartProxies returns the HelmChartProxies installing the charts of the release with the values of the addon
+// on the clusters labelled for it. The kubewarden-controller release keeps the name used by the direct install
+// mode, the names of its objects are the ones the health checks look for.
+func helmChartProxies(addon *addonv1alpha1.KubewardenAddon, release *kubewardenRelease, values *kubewardenChartValues) ([]*unstructured.Unstructured, error) {
+	if release.CRDsChartVersion == "" {
+		return nil, fmt.Errorf("%w: no %s chart for app version %s in %s", errArtifactsNotResolved,
+			kubewardenCRDsChartName, release.AppVersion, release.Artifacts.ChartRepository)
+	}
+
+	charts := []struct {
+		name        string
+		version     string
+		releaseName string
+		values      map[string]interface{}
+	}{
+		{name: kubewardenCRDsChartName, version: release.CRDsChartVersion, releaseName: kubewardenHelmReleaseName + "-crds"},
+		{name: kubewardenControllerChartName, version: release.ControllerChartVersion, releaseName: kubewardenHelmReleaseName, values: values.Controller},
+		{name: kubewardenDefaultsChartName, version: release.DefaultsChartVersion, releaseName: kubewardenHelmReleaseName + "-defaults", values: values.Defaults},
+	}
+
+	proxies := []*unstructured.Unstructured{}
+	for _, chart := range charts {
+		spec := map[string]interface{}{
+			"clusterSelector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{KubewardenAddonLabel: addon.Name},
+			},
+			"repoURL":     release.Artifacts.ChartRepository,
+			"chartName":   chart.name,
+			"version":     chart.version,
+			"releaseName": chart.releaseName,
+			"namespace":   kubewardenNamespace,
+			"options": map[string]interface{}{
+				"wait":    true,
+				"install": map[string]interface{}{"createNamespace": true},
+			},
+		}
+		if len(chart.values) > 0 {
+			valuesYAML, err := yaml.Marshal(chart.values)
+			if err != nil {
+				return nil, fmt.Errorf("serializing %s values: %w", chart.name, err)
+			}
+			spec["valuesTemplate"] = escapeValuesTemplate(string(valuesYAML))
+		}
+
+		proxy := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+		proxy.SetGroupVersionKind(helmChartProxyGVK)
+		proxy.SetName(helmChartProxyName(addon.Name, chart.name))
+		proxy.SetNamespace(addon.Namespace)
+		proxy.SetLabels(map[string]string{KubewardenAddonLabel: addon.Name})
+		proxies = append(proxies, proxy)
+	}
+
+	return proxies, nil
+}
+
+// isHelmReleaseProxyUpToDate returns whether the HelmReleaseProxy installed the version and the values of its
+// HelmChartProxy and is ready.
+func isHelmReleaseProxyUpToDate(helmRelease, proxy *unstructured.Unstructured) bool {
+	version, _, _ := unstructured.NestedString(proxy.Object, "spec", "version")
+	valuesTemplate, _, _ := unstructured.NestedString(proxy.Object, "spec", "valuesTemplate")
+	installedVersion, _, _ := unstructured.NestedString(helmRelease.Object, "spec", "version")
+	installedValues, _, _ := unstructured.NestedString(helmRelease.Object, "spec", "values")
+
+	return installedVersion == version && installedValues == valuesTemplateUnescaper.Replace(valuesTemplate) &&
+		conditions.IsTrue(conditions.UnstructuredGetter(helmRelease), clusterv1.ReadyCondition)
+}
+
+// escapeValuesTemplate escapes the template actions of the values, the Cluster API Addon Provider for Helm renders
+// the valuesTemplate of the HelmChartProxies as a Go template.
+func escapeValuesTemplate(values string) string {
+	return strings.ReplaceAll(values, "{{", `{{ "{{" }}`)
+}
+
+// valuesTemplateUnescaper reverts escapeValuesTemplate, giving the values rendered in the HelmReleaseProxies.
+var valuesTemplateUnescaper = strings.NewReplacer(`{{ "{{" }}`, "{{")
+
+// reconcileDelegatedCluster selects the cluster for the ClusterResourceSet or the HelmChartProxies of the addon,
+// and records Kubewarden as installed once rolledOut reports the desired manifests applied to the cluster and the
+// components are healthy. Drift is left to the install mode, installed clusters are only checked for health.
+func (r *KubewardenAddonReconciler) reconcileDelegatedCluster(ctx context.Context, addonName string, cluster *clusterv1.Cluster, status *addonv1alpha1.ClusterInstallationStatus, release *kubewardenRelease, manifests *kubewardenManifests, desiredHash string, phases *clusterPhasePublisher, rolledOut func(context.Context, client.Client) (bool, error)) (time.Duration, error) {
+	log := log.FromContext(ctx).WithValues("cluster", cluster.Name)
+
+	// cluster must be ready before we can deploy kubewarden
+	if !isControlPlaneReady(cluster) {
+		setClusterPhase(status, addonv1alpha1.ClusterInstallationPending, nil)
+		return defaultRequeueDuration, nil
+	}
+
+	if cluster.GetLabels()[KubewardenAddonLabel] != addonName {
+		log.Info("Selecting cluster for Kubewarden installation", "label", KubewardenAddonLabel)
+		if err := r.labelCluster(ctx, cluster, map[string]string{KubewardenAddonLabel: addonName}); err != nil {
+			return 0, err
+		}
+	}
+
+	desiredVersion := release.AppVersion
+	installedVersion := cluster.GetAnnotations()[KubewardenVersionAnnotation]
+	installedHash := cluster.GetAnnotations()[KubewardenHashAnnotation]
+	status.InstalledVersion = installedVersion
+	status.AppliedHash = installedHash
+
+	remoteClient, err := r.RemoteClientGetter(ctx, cluster.Name, r.Client, client.ObjectKeyFromObject(cluster))
+	if err != nil {
+		return 0, fmt.Errorf("getting remote cluster client: %w", err)
+	}
+
+	if installedVersion == desiredVersion && installedHash == desiredHash {
+		// Kubewarden only stays ready as long as its components keep running
+		healthy, err := updateKubewardenHealth(ctx, remoteClient, status, manifests)
+		if err != nil {
+			return 0, err
+		}
+		if !healthy {
+			setClusterPhase(status, addonv1alpha1.ClusterInstallationDegraded, nil)
+			return healthCheckInterval, nil
+		}
+
+		setClusterPhase(status, addonv1alpha1.ClusterInstallationReady, nil)
+		return driftCheckInterval, nil
+	}
+
+	if isKubewardenInstalled(cluster) {
+		setClusterPhase(status, addonv1alpha1.ClusterInstallationUpgrading, nil)
+	} else {
+		setClusterPhase(status, addonv1alpha1.ClusterInstallationInstalling, nil)
+	}
+	phases.publish(ctx, cluster, status)
+
+	done, err := rolledOut(ctx, remoteClient)
+	if err != nil {
+		return 0, err
+	}
+	if !done {
+		log.Info("Waiting for Kubewarden to be rolled out")
+		return upgradeRequeueDuration, nil
+	}
+	healthy, err := updateKubewardenHealth(ctx, remoteClient, status, manifests)
+	if err != nil || !healthy {
+		return upgradeRequeueDuration, err
+	}
+
+	log.Info(fmt.Sprintf("Kubewarden %s rolled out to cluster %s", desiredVersion, cluster.Name))
+	if err := r.annotateCluster(ctx, cluster, map[string]string{
+		KubewardenHashAnnotation:    desiredHash,
+		KubewardenVersionAnnotation: desiredVersion,
+		KubewardenAddonAnnotation:   addonName,
+	}); err != nil {
+		return 0, err
+	}
+	if err := r.removeClusterAnnotations(ctx, cluster, KubewardenInstalledAnnotation); err != nil {
+		return 0, err
+	}
+	status.InstalledVersion = desiredVersion
+	status.AppliedHash = desiredHash
+	setClusterDriftStatus(status, 0)
+	setClusterPhase(status, addonv1alpha1.ClusterInstallationReady, nil)
+
+	return driftCheckInterval, nil
+}
@@ -0,0 +1,276 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+// nestedString returns the string field of the object at the given path, or an empty string.
+func nestedString(obj *unstructured.Unstructured, fields ...string) string {
+	value, _, _ := unstructured.NestedString(obj.Object, fields...)
+
+	return value
+}
+
+// newManifestObject returns a rendered object of the given kind and name in the kubewarden namespace.
+func newManifestObject(kind, name string) client.Object {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind(kind)
+	obj.SetName(name)
+	obj.SetNamespace(kubewardenNamespace)
+
+	return obj
+}
+
+var _ = Describe("Kubewarden installers", func() {
+	It("should pick the installer of the install mode", func() {
+		r := &KubewardenAddonReconciler{}
+		addon := &addonv1alpha1.KubewardenAddon{}
+		Expect(r.installer(addon)).To(BeAssignableToTypeOf(&directInstaller{}))
+
+		addon.Spec.InstallMode = addonv1alpha1.InstallModeHelm
+		Expect(r.installer(addon)).To(BeAssignableToTypeOf(&helmInstaller{}))
+
+		addon.Spec.InstallMode = addonv1alpha1.InstallModeClusterResourceSet
+		Expect(r.installer(addon)).To(BeAssignableToTypeOf(&clusterResourceSetInstaller{}))
+
+		addon.Spec.InstallMode = addonv1alpha1.InstallModeHelmChartProxy
+		Expect(r.installer(addon)).To(BeAssignableToTypeOf(&helmChartProxyInstaller{}))
+	})
+})
+
+var _ = Describe("ClusterResourceSet installer", func() {
+	var addon *addonv1alpha1.KubewardenAddon
+	var manifests *kubewardenManifests
+
+	BeforeEach(func() {
+		addon = &addonv1alpha1.KubewardenAddon{
+			ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+			Spec: addonv1alpha1.KubewardenAddonSpec{
+				// the addon is reconciled by the manager too, keep it away from the clusters of the other tests
+				ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"install-mode": "crs"}},
+				InstallMode:     addonv1alpha1.InstallModeClusterResourceSet,
+			},
+		}
+		manifests = &kubewardenManifests{
+			CRDs:       []client.Object{newManifestObject("CustomResourceDefinition", "policyservers.policies.kubewarden.io")},
+			Controller: []client.Object{newManifestObject("Secret", "webhook-server-cert"), newManifestObject("Deployment", "caapkw-kubewarden-controller")},
+			Defaults:   []client.Object{newManifestObject("PolicyServer", "default")},
+		}
+	})
+
+	It("should keep the Secrets out of the ConfigMaps", func() {
+		resources, err := clusterResourceSetResources(addon, manifests)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resources).To(HaveLen(4))
+
+		names := []string{}
+		for _, obj := range resources {
+			names = append(names, obj.GetObjectKind().GroupVersionKind().Kind+"/"+obj.GetName())
+		}
+		Expect(names).To(Equal([]string{
+			"ConfigMap/crs-kubewarden-crds-0",
+			"Secret/crs-kubewarden-secrets-0",
+			"ConfigMap/crs-kubewarden-controller-0",
+			"ConfigMap/crs-kubewarden-defaults-0",
+		}))
+
+		crds := resources[0].(*corev1.ConfigMap)
+		Expect(crds.Data).To(HaveLen(2))
+		Expect(crds.Data["000.yaml"]).To(ContainSubstring("kind: Namespace"))
+		Expect(crds.Data["001.yaml"]).To(ContainSubstring("kind: CustomResourceDefinition"))
+
+		secrets := resources[1].(*corev1.Secret)
+		Expect(secrets.Type).To(Equal(addonsv1.ClusterResourceSetSecretType))
+		Expect(string(secrets.Data["000.yaml"])).To(ContainSubstring("name: webhook-server-cert"))
+
+		controller := resources[2].(*corev1.ConfigMap)
+		Expect(controller.Data).To(HaveLen(1))
+		Expect(controller.Data["000.yaml"]).To(ContainSubstring("kind: Deployment"))
+
+		crs := clusterResourceSet(addon, resources)
+		Expect(crs.Spec.Strategy).To(Equal(string(addonsv1.ClusterResourceSetStrategyReconcile)))
+		Expect(crs.Spec.ClusterSelector.MatchLabels).To(Equal(map[string]string{KubewardenAddonLabel: "crs"}))
+		Expect(crs.Spec.Resources).To(HaveLen(4))
+		Expect(crs.Spec.Resources[1]).To(Equal(addonsv1.ResourceRef{Name: "crs-kubewarden-secrets-0", Kind: "Secret"}))
+	})
+
+	It("should split large manifests in order", func() {
+		objs := []client.Object{}
+		for _, name := range []string{"a", "b", "c"} {
+			obj := newManifestObject("ConfigMap", name).(*unstructured.Unstructured)
+			obj.Object["data"] = map[string]interface{}{"large": strings.Repeat(name, clusterResourceSetMaxDataSize/2)}
+			objs = append(objs, obj)
+		}
+
+		chunks, err := chunkManifests(objs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chunks).To(HaveLen(3))
+		Expect(chunks[0]).To(HaveKey("000.yaml"))
+		Expect(chunks[1]).To(HaveKey("001.yaml"))
+		Expect(chunks[2]).To(HaveKey("002.yaml"))
+	})
+
+	It("should create the ClusterResourceSet and remove the stale resources", func() {
+		Expect(k8sClient.Create(ctx, addon)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, addon)
+
+		r := &KubewardenAddonReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		installer := r.installer(addon)
+		Expect(installer.prepare(ctx, addon, nil, nil, manifests)).To(Succeed())
+
+		crs := &addonsv1.ClusterResourceSet{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Name: "crs-kubewarden", Namespace: "default"}, crs)).To(Succeed())
+		Expect(crs.Spec.Resources).To(HaveLen(4))
+		Expect(metav1.IsControlledBy(crs, addon)).To(BeTrue())
+
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Name: "crs-kubewarden-secrets-0", Namespace: "default"}, secret)).To(Succeed())
+		Expect(secret.Type).To(Equal(addonsv1.ClusterResourceSetSecretType))
+
+		By("Rendering no Secret anymore")
+		manifests.Controller = manifests.Controller[1:]
+		Expect(installer.prepare(ctx, addon, nil, nil, manifests)).To(Succeed())
+
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Name: "crs-kubewarden", Namespace: "default"}, crs)).To(Succeed())
+		Expect(crs.Spec.Resources).To(HaveLen(3))
+		err := k8sClient.Get(ctx, client.ObjectKey{Name: "crs-kubewarden-secrets-0", Namespace: "default"}, secret)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("HelmChartProxy installer", func() {
+	var addon *addonv1alpha1.KubewardenAddon
+	var release *kubewardenRelease
+
+	BeforeEach(func() {
+		addon = &addonv1alpha1.KubewardenAddon{
+			ObjectMeta: metav1.ObjectMeta{Name: "hcp", Namespace: "default"},
+			Spec: addonv1alpha1.KubewardenAddonSpec{
+				InstallMode: addonv1alpha1.InstallModeHelmChartProxy,
+			},
+		}
+		release = &kubewardenRelease{
+			AppVersion:             "v1.18.0",
+			ControllerChartVersion: "3.1.0",
+			DefaultsChartVersion:   "2.4.0",
+			CRDsChartVersion:       "1.9.0",
+			Artifacts:              &kubewardenArtifacts{ArtifactSources: ArtifactSources{ChartRepository: kubewardenHelmChartURL}},
+		}
+	})
+
+	It("should install each chart with its own release", func() {
+		values := &kubewardenChartValues{
+			Controller: map[string]interface{}{"replicas": int64(2)},
+			Defaults:   map[string]interface{}{"policyServer": map[string]interface{}{"replicaCount": int64(3)}},
+		}
+		proxies, err := helmChartProxies(addon, release, values)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxies).To(HaveLen(3))
+
+		releases := map[string]string{}
+		for _, proxy := range proxies {
+			Expect(proxy.GetKind()).To(Equal("HelmChartProxy"))
+			Expect(proxy.GetNamespace()).To(Equal("default"))
+			Expect(nestedString(proxy, "spec", "clusterSelector", "matchLabels", KubewardenAddonLabel)).To(Equal("hcp"))
+			Expect(nestedString(proxy, "spec", "repoURL")).To(Equal(kubewardenHelmChartURL))
+			Expect(nestedString(proxy, "spec", "namespace")).To(Equal(kubewardenNamespace))
+			releases[nestedString(proxy, "spec", "chartName")] = nestedString(proxy, "spec", "releaseName")
+		}
+		Expect(releases).To(Equal(map[string]string{
+			kubewardenCRDsChartName:       "caapkw-crds",
+			kubewardenControllerChartName: "caapkw",
+			kubewardenDefaultsChartName:   "caapkw-defaults",
+		}))
+
+		controller := proxies[1]
+		Expect(controller.GetName()).To(Equal("hcp-kubewarden-controller"))
+		Expect(nestedString(controller, "spec", "version")).To(Equal("3.1.0"))
+		Expect(nestedString(controller, "spec", "valuesTemplate")).To(Equal("replicas: 2\n"))
+		_, found, _ := unstructured.NestedString(proxies[0].Object, "spec", "valuesTemplate")
+		Expect(found).To(BeFalse())
+	})
+
+	It("should escape template actions in the values", func() {
+		values := &kubewardenChartValues{
+			Controller: map[string]interface{}{"annotations": map[string]interface{}{"note": "{{ .Cluster.metadata.name }}"}},
+		}
+		proxies, err := helmChartProxies(addon, release, values)
+		Expect(err).NotTo(HaveOccurred())
+
+		proxy := proxies[1]
+		valuesTemplate := nestedString(proxy, "spec", "valuesTemplate")
+		Expect(valuesTemplate).To(Equal("annotations:\n  note: '{{ \"{{\" }} .Cluster.metadata.name }}'\n"))
+
+		// the release installs the values as they were set
+		helmRelease := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"version": "3.1.0", "values": "annotations:\n  note: '{{ .Cluster.metadata.name }}'\n"},
+			"status": map[string]interface{}{
+				"conditions": []interface{}{map[string]interface{}{"type": string(clusterv1.ReadyCondition), "status": "True"}},
+			},
+		}}
+		Expect(isHelmReleaseProxyUpToDate(helmRelease, proxy)).To(BeTrue())
+	})
+
+	It("should require the kubewarden-crds chart", func() {
+		release.CRDsChartVersion = ""
+		_, err := helmChartProxies(addon, release, &kubewardenChartValues{})
+		Expect(err).To(MatchError(errArtifactsNotResolved))
+	})
+
+	It("should only report the charts rolled out once their releases are ready", func() {
+		proxies, err := helmChartProxies(addon, release, &kubewardenChartValues{Controller: map[string]interface{}{"replicas": int64(2)}})
+		Expect(err).NotTo(HaveOccurred())
+		proxy := proxies[1]
+
+		helmRelease := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"version": "3.0.0", "values": "replicas: 2\n"},
+			"status": map[string]interface{}{
+				"conditions": []interface{}{map[string]interface{}{"type": string(clusterv1.ReadyCondition), "status": "True"}},
+			},
+		}}
+		Expect(isHelmReleaseProxyUpToDate(helmRelease, proxy)).To(BeFalse())
+
+		Expect(unstructured.SetNestedField(helmRelease.Object, "3.1.0", "spec", "version")).To(Succeed())
+		Expect(isHelmReleaseProxyUpToDate(helmRelease, proxy)).To(BeTrue())
+
+		Expect(unstructured.SetNestedField(helmRelease.Object, []interface{}{
+			map[string]interface{}{"type": string(clusterv1.ReadyCondition), "status": "False"},
+		}, "status", "conditions")).To(Succeed())
+		Expect(isHelmReleaseProxyUpToDate(helmRelease, proxy)).To(BeFalse())
+	})
+
+	It("should report the install mode as not available without the HelmChartProxy API", func() {
+		r := &KubewardenAddonReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		err := r.installer(addon).prepare(ctx, addon, release, &kubewardenChartValues{}, &kubewardenManifests{})
+		Expect(err).To(MatchError(errInstallModeNotAvailable))
+	})
+})
@@ -17,26 +17,37 @@ limitations under the License.
 package controller
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
-	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	labels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	labels "k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/rest"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/controllers/remote"
 	"sigs.k8s.io/cluster-api/util/conditions"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/source"
@@ -49,8 +60,85 @@ type KubewardenAddonReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 
+	// APIReader reads the ConfigMaps and Secrets referenced by the addons, which are not cached by the manager.
+	// Defaults to the API reader of the manager, or to Client if the reconciler is not set up with a manager.
+	APIReader client.Reader
+
 	// RemoteClientGetter is used for accessing workload clusters
 	RemoteClientGetter remote.ClusterClientGetter
+
+	// RemoteRESTConfigGetter returns the REST config Helm connects to the workload clusters with in the Helm
+	// install mode. Defaults to remote.RESTConfig.
+	RemoteRESTConfigGetter ClusterRESTConfigGetter
+
+	// MaxConcurrentClusterReconciles is the maximum number of clusters of an addon reconciled in parallel.
+	// Defaults to DefaultMaxConcurrentClusterReconciles.
+	MaxConcurrentClusterReconciles int
+
+	// ArtifactSources sets where the Kubewarden charts and CRDs are fetched from when addons don't set it. Unset
+	// fields default to DefaultArtifactSources.
+	ArtifactSources ArtifactSources
+
+	// ArtifactCache caches the Kubewarden charts and CRDs downloaded by the reconciler. Defaults to a cache in the
+	// temporary directory of the manager.
+	ArtifactCache *ArtifactCache
+
+	// ArtifactFetcher downloads the Kubewarden charts and CRDs. Defaults to a fetcher with the default options.
+	ArtifactFetcher *ArtifactFetcher
+}
+
+// ClusterRESTConfigGetter returns the REST config of a workload cluster, like remote.RESTConfig.
+type ClusterRESTConfigGetter func(ctx context.Context, sourceName string, c client.Reader, cluster client.ObjectKey) (*rest.Config, error)
+
+// clusterReconcileResult holds the outcome of reconciling Kubewarden on a single cluster.
+type clusterReconcileResult struct {
+	status       addonv1alpha1.ClusterInstallationStatus
+	requeueAfter time.Duration
+	err          error
+}
+
+// clusterPhasePublisher patches the phase of the clusters in the addon status as soon as it changes, so long
+// installations and upgrades show up while the clusters of the addon are still being reconciled. It is shared by
+// the workers and holds the addon as last patched.
+type clusterPhasePublisher struct {
+	client client.Client
+
+	mu    sync.Mutex
+	addon *addonv1alpha1.KubewardenAddon
+}
+
+func newClusterPhasePublisher(c client.Client, addon *addonv1alpha1.KubewardenAddon) *clusterPhasePublisher {
+	return &clusterPhasePublisher{client: c, addon: addon.DeepCopy()}
+}
+
+// publish patches the installation status of the cluster in the addon status if its phase changed. A failed patch
+// is only logged, the phase is then reported once the reconcile ends.
+func (p *clusterPhasePublisher) publish(ctx context.Context, cluster *clusterv1.Cluster, status *addonv1alpha1.ClusterInstallationStatus) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	previous := p.addon.DeepCopy()
+	published := clusterInstallationStatus(p.addon, cluster)
+	if published.Phase == status.Phase {
+		return
+	}
+	*published = *status
+	if err := p.client.Status().Patch(ctx, p.addon, client.MergeFrom(previous)); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to publish the cluster phase", "cluster", cluster.Name, "phase", status.Phase)
+		p.addon = previous
+	}
+}
+
+// published returns the addon as last patched by the publisher.
+func (p *clusterPhasePublisher) published() *addonv1alpha1.KubewardenAddon {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.addon
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -58,8 +146,22 @@ func (r *KubewardenAddonReconciler) SetupWithManager(ctx context.Context, mgr ct
 	if r.RemoteClientGetter == nil {
 		r.RemoteClientGetter = remote.NewClusterClient
 	}
+	if r.RemoteRESTConfigGetter == nil {
+		r.RemoteRESTConfigGetter = remote.RESTConfig
+	}
+	if r.APIReader == nil {
+		r.APIReader = mgr.GetAPIReader()
+	}
+	// NOTE: index addons by the ConfigMaps and Secrets they reference, such as the ones holding their values
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &addonv1alpha1.KubewardenAddon{}, referencesIndexKey, referencesIndexValues); err != nil {
+		return fmt.Errorf("indexing addons by references: %w", err)
+	}
+
 	c, err := ctrl.NewControllerManagedBy(mgr).
 		For(&addonv1alpha1.KubewardenAddon{}).
+		// NOTE: only the metadata of ConfigMaps and Secrets is cached, referenced objects are read with the API reader
+		WatchesMetadata(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.referencedObjectToKubewardenAddons("ConfigMap"))).
+		WatchesMetadata(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.referencedObjectToKubewardenAddons("Secret"))).
 		Build(r)
 	if err != nil {
 		return fmt.Errorf("creating new controller: %w", err)
@@ -81,6 +183,9 @@ func (r *KubewardenAddonReconciler) SetupWithManager(ctx context.Context, mgr ct
 // +kubebuilder:rbac:groups=addon.cluster.x-k8s.io,resources=kubewardenaddons,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=addon.cluster.x-k8s.io,resources=kubewardenaddons/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=addon.cluster.x-k8s.io,resources=kubewardenaddons/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=configmaps;secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=clusterresourcesets;helmchartproxies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=helmreleaseproxies,verbs=get;list;watch
 
 // Reconcile reconciles a KubewardenAddon object, ensuring the addon is deployed to the workload cluster
 func (r *KubewardenAddonReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -91,134 +196,1089 @@ func (r *KubewardenAddonReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	addon := &addonv1alpha1.KubewardenAddon{}
 	if err := r.Client.Get(ctx, req.NamespacedName, addon); err != nil {
 		if apierrors.IsNotFound(err) {
-			return ctrl.Result{Requeue: true}, nil
+			return ctrl.Result{}, nil
 		}
 
 		return ctrl.Result{Requeue: true}, err
 	}
 
-	// for now we will deploy kubewarden to all clusters
+	// a paused addon is left alone, deletion included, until it is resumed
+	if addon.Spec.Paused {
+		log.Info("Reconciliation is paused for this addon")
+		addonCopy := addon.DeepCopy()
+		setPausedCondition(addon, true, nil)
+		if err := r.Client.Status().Patch(ctx, addon, client.MergeFrom(addonCopy)); err != nil {
+			return ctrl.Result{}, fmt.Errorf("updating addon status: %w", err)
+		}
 
-	if !addon.DeletionTimestamp.IsZero() {
-		// this won't be the case as there is no finalizer yet
 		return ctrl.Result{}, nil
 	}
 
+	if !addon.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, addon)
+	}
+
+	// add the finalizer first so Kubewarden can be uninstalled when the addon is deleted
+	if !controllerutil.ContainsFinalizer(addon, addonv1alpha1.KubewardenAddonFinalizer) {
+		addonCopy := addon.DeepCopy()
+		controllerutil.AddFinalizer(addon, addonv1alpha1.KubewardenAddonFinalizer)
+		if err := r.Client.Patch(ctx, addon, client.MergeFrom(addonCopy)); err != nil {
+			return ctrl.Result{}, fmt.Errorf("adding finalizer: %w", err)
+		}
+	}
+
 	return r.reconcileNormal(ctx, addon)
 }
 
 func (r *KubewardenAddonReconciler) reconcileNormal(ctx context.Context, addon *addonv1alpha1.KubewardenAddon) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
+	addonCopy := addon.DeepCopy()
+	setPausedCondition(addon, false, nil)
+
+	// Resolve the charts shipping the requested Kubewarden version
+	release, err := r.resolveRelease(ctx, addon, kubewardenAppVersion(addon))
+	if err != nil {
+		if !errors.Is(err, errChartNotFound) {
+			return ctrl.Result{}, fmt.Errorf("resolving kubewarden release: %w", err)
+		}
+
+		// nothing to do until the addon version changes
+		log.Error(err, "No Kubewarden chart matches the addon version", "version", addon.Spec.Version)
+		return r.markSpecsNotResolved(ctx, addon, addonCopy, addonv1alpha1.KubewardenChartNotFoundReason, err)
+	}
+
+	// Resolve the chart values, referenced objects are watched so missing ones are picked up once created
+	values, err := r.resolveChartValues(ctx, addon)
+	if err != nil {
+		if !errors.Is(err, errValuesNotResolved) {
+			return ctrl.Result{}, fmt.Errorf("resolving kubewarden values: %w", err)
+		}
+
+		log.Error(err, "Failed to resolve the Kubewarden values")
+		return r.markSpecsNotResolved(ctx, addon, addonCopy, addonv1alpha1.KubewardenValuesNotResolvedReason, err)
+	}
+
+	// Resolve the verification config, Kubewarden is never rolled out without the verification it requires
+	verificationConfig, err := r.resolveVerificationConfig(ctx, addon)
+	if err != nil {
+		if !errors.Is(err, errVerificationConfigNotResolved) {
+			return ctrl.Result{}, fmt.Errorf("resolving verification config: %w", err)
+		}
+
+		log.Error(err, "Failed to resolve the verification config")
+		return r.markSpecsNotResolved(ctx, addon, addonCopy, addonv1alpha1.KubewardenVerificationConfigNotResolvedReason, err)
+	}
+
+	// Resolve the registry credentials and sources, policy modules can't be pulled without them
+	registries, err := r.resolveRegistries(ctx, addon)
+	if err != nil {
+		if !errors.Is(err, errRegistriesNotResolved) {
+			return ctrl.Result{}, fmt.Errorf("resolving registries: %w", err)
+		}
+
+		log.Error(err, "Failed to resolve the registries")
+		return r.markSpecsNotResolved(ctx, addon, addonCopy, addonv1alpha1.KubewardenRegistriesNotResolvedReason, err)
+	}
 
 	// Get all clusters in the addon's namespace
 	allClusters, err := r.getAllCapiClusters(ctx, addon.Namespace)
 	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("getting capi clusters: %w", err)
+		return ctrl.Result{}, r.clusterSelectionFailed(ctx, addon, addonCopy, fmt.Errorf("getting capi clusters: %w", err))
 	}
 
 	// Filter clusters using ClusterSelector
 	selectedClusters, err := r.selectClusters(allClusters, addon.Spec.ClusterSelector)
 	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("selecting clusters: %w", err)
+		return ctrl.Result{}, r.clusterSelectionFailed(ctx, addon, addonCopy, fmt.Errorf("selecting clusters: %w", err))
 	}
 
 	// Update status with matching clusters
 	addon.SetMatchingClusters(selectedClusters)
+	pruneClusterStatuses(addon, selectedClusters)
+
+	// Render the Kubewarden manifests once, they are shared by all the clusters
+	installer := r.installer(addon)
+	manifests := &kubewardenManifests{}
+	manifestsHash := ""
+	if len(selectedClusters) > 0 {
+		manifests, err = r.renderKubewardenManifests(ctx, release, values)
+		if err != nil {
+			if !errors.Is(err, errArtifactsNotResolved) {
+				return ctrl.Result{}, fmt.Errorf("rendering kubewarden manifests: %w", err)
+			}
 
-	clusters := selectedClusters
+			log.Error(err, "Failed to read the Kubewarden artifacts")
+			return r.markSpecsNotResolved(ctx, addon, addonCopy, addonv1alpha1.KubewardenArtifactsNotResolvedReason, err)
+		}
+		if err := applyKubewardenScheduling(manifests, addon.Spec.Scheduling); err != nil {
+			return ctrl.Result{}, fmt.Errorf("applying kubewarden scheduling: %w", err)
+		}
+		if err := applyAuditScannerSkipNamespaces(manifests, addon.Spec.AuditScanner.SkipNamespaces); err != nil {
+			return ctrl.Result{}, fmt.Errorf("applying audit scanner namespaces: %w", err)
+		}
+		if err := applyVerificationConfig(manifests, verificationConfig); err != nil {
+			return ctrl.Result{}, fmt.Errorf("applying verification config: %w", err)
+		}
+		if err := applyRegistries(manifests, registries); err != nil {
+			return ctrl.Result{}, fmt.Errorf("applying registries: %w", err)
+		}
+		manifestsHash, err = manifests.hash()
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("hashing kubewarden manifests: %w", err)
+		}
 
-	for _, cluster := range clusters {
-		log = log.WithValues("cluster", cluster.Name)
+		// Create the objects the install mode shares between the clusters, such as a ClusterResourceSet
+		if err := installer.prepare(ctx, addon, release, values, manifests); err != nil {
+			if !errors.Is(err, errInstallModeNotAvailable) {
+				return ctrl.Result{}, fmt.Errorf("preparing kubewarden installation: %w", err)
+			}
 
-		// cluster must be ready before we can deploy kubewarden
-		if !cluster.Status.ControlPlaneReady && !conditions.IsTrue(&cluster, clusterv1.ControlPlaneReadyCondition) {
-			return ctrl.Result{RequeueAfter: defaultRequeueDuration}, nil
+			log.Error(err, "The install mode is not available on the management cluster", "installMode", addon.Spec.InstallMode)
+			return r.markSpecsNotResolved(ctx, addon, addonCopy, addonv1alpha1.KubewardenInstallModeNotAvailableReason, err)
 		}
+	}
 
-		if HasAnnotation(&cluster, KubewardenInstalledAnnotation) {
-			log.Info("Kubewarden already installed on cluster, skipping", "cluster", cluster.Name)
-			return ctrl.Result{}, nil
+	// The rollout strategy decides which clusters Kubewarden can be installed or upgraded on, the others wait
+	admitted := planRollout(addon, selectedClusters, release.AppVersion, manifestsHash, time.Now())
+
+	// Paused clusters keep their status and are reconciled again once the cluster watch sees them resumed
+	pausedClusters := []string{}
+
+	// Each cluster is reconciled on its own so a failing cluster does not hold back the rest of the fleet. Workers
+	// only update their own copy of the cluster status, which is merged back once all of them are done.
+	results := make([]clusterReconcileResult, len(selectedClusters))
+	phases := newClusterPhasePublisher(r.Client, addonCopy)
+	workers := make(chan struct{}, r.maxConcurrentClusterReconciles())
+	wg := sync.WaitGroup{}
+	for i := range selectedClusters {
+		cluster := &selectedClusters[i]
+		result := &results[i]
+		result.status = *clusterInstallationStatus(addon, cluster)
+		if isClusterPaused(cluster) {
+			log.Info("Cluster is paused, skipping Kubewarden reconciliation", "cluster", cluster.Name)
+			pausedClusters = append(pausedClusters, cluster.Name)
+			continue
+		}
+		if !admitted[cluster.Name] {
+			// clusters running a previous rollout keep serving it until their turn comes
+			if result.status.Phase != addonv1alpha1.ClusterInstallationReady {
+				setClusterPhase(&result.status, addonv1alpha1.ClusterInstallationPending, nil)
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			result.requeueAfter, result.err = installer.reconcileCluster(ctx, addon.Name, cluster, &result.status, release, manifests, manifestsHash, phases)
+		}()
+	}
+	wg.Wait()
+
+	requeueAfter := time.Duration(0)
+	errs := []error{}
+	for i := range selectedClusters {
+		cluster := &selectedClusters[i]
+		result := &results[i]
+
+		if result.err != nil {
+			log.Error(result.err, "Failed to reconcile Kubewarden on cluster", "cluster", cluster.Name)
+			setClusterPhase(&result.status, addonv1alpha1.ClusterInstallationFailed, result.err)
+			errs = append(errs, fmt.Errorf("cluster %s: %w", cluster.Name, result.err))
+			result.requeueAfter = failureRequeueDuration
 		}
 
-		// create a remote client to connect to the workload cluster
-		remoteClient, err := r.RemoteClientGetter(ctx, cluster.Name, r.Client, client.ObjectKeyFromObject(&cluster))
+		*clusterInstallationStatus(addon, cluster) = result.status
+		requeueAfter = shortestRequeue(requeueAfter, result.requeueAfter)
+	}
+
+	// Clusters the addon installed Kubewarden to that are no longer selected follow the deselection policy
+	deselectedRequeueAfter, deselectedErrs := r.reconcileDeselectedClusters(ctx, addon, allClusters, selectedClusters)
+	requeueAfter = shortestRequeue(requeueAfter, deselectedRequeueAfter)
+	errs = append(errs, deselectedErrs...)
+
+	// Update addon status
+	keepTransitionTimes(addon, addonCopy)
+	updateClusterCounts(addon)
+	requeueAfter = shortestRequeue(requeueAfter, updateRolloutProgress(addon, time.Now()))
+	setPausedCondition(addon, false, pausedClusters)
+	setKubewardenAddonConditions(addon)
+	addon.Status.Ready = len(selectedClusters) > 0 && int(addon.Status.ReadyClusters) == len(selectedClusters) &&
+		(addon.Status.Rollout == nil || int(addon.Status.Rollout.UpdatedClusters) == len(selectedClusters))
+	if addon.Status.Ready {
+		log.Info("All selected clusters have Kubewarden installed", "ready", addon.Status.Ready)
+	}
+	if len(errs) > 0 {
+		log.Info("Kubewarden could not be reconciled on some clusters, retrying later",
+			"failed", len(errs), "errors", kerrors.NewAggregate(errs).Error(), "requeueAfter", requeueAfter)
+	}
+
+	// Patch addon status, the failures are only recorded there. The phases published by the workers are already in
+	// the addon status, the patch goes on from them.
+	statusPath := client.MergeFrom(phases.published())
+	if err := r.Client.Status().Patch(ctx, addon, statusPath); err != nil {
+		return ctrl.Result{}, fmt.Errorf("updating addon status: %w", err)
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// markSpecsNotResolved reports that the specs of the addon could not be resolved for the given reason. Nothing can
+// be rolled out until the addon or the objects it references change, so the reconcile is not retried.
+func (r *KubewardenAddonReconciler) markSpecsNotResolved(ctx context.Context, addon, addonCopy *addonv1alpha1.KubewardenAddon, reason string, err error) (ctrl.Result, error) {
+	addon.Status.Ready = false
+	conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonSpecsUpToDateCondition, reason,
+		clusterv1.ConditionSeverityError, "%s", err.Error())
+	summarizeKubewardenAddonConditions(addon)
+	if err := r.Client.Status().Patch(ctx, addon, client.MergeFrom(addonCopy)); err != nil {
+		return ctrl.Result{}, fmt.Errorf("updating addon status: %w", err)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// clusterSelectionFailed reports that the workload clusters could not be selected and returns the error.
+func (r *KubewardenAddonReconciler) clusterSelectionFailed(ctx context.Context, addon, addonCopy *addonv1alpha1.KubewardenAddon, err error) error {
+	conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonSpecsUpToDateCondition, addonv1alpha1.ClusterSelectionFailedReason,
+		clusterv1.ConditionSeverityError, "%s", err.Error())
+	summarizeKubewardenAddonConditions(addon)
+	if err := r.Client.Status().Patch(ctx, addon, client.MergeFrom(addonCopy)); err != nil {
+		log.FromContext(ctx).Error(err, "failed to update addon status")
+	}
+
+	return err
+}
+
+// reconcileCluster installs, upgrades or corrects the drift of Kubewarden on a selected cluster, recording the
+// outcome in the cluster installation status. It returns when the cluster should be checked again. It is called
+// concurrently for the clusters of an addon and must not modify the addon.
+func (r *KubewardenAddonReconciler) reconcileCluster(ctx context.Context, addonName string, cluster *clusterv1.Cluster, status *addonv1alpha1.ClusterInstallationStatus, release *kubewardenRelease, manifests *kubewardenManifests, desiredHash string, phases *clusterPhasePublisher) (time.Duration, error) {
+	log := log.FromContext(ctx).WithValues("cluster", cluster.Name)
+
+	// cluster must be ready before we can deploy kubewarden
+	if !isControlPlaneReady(cluster) {
+		setClusterPhase(status, addonv1alpha1.ClusterInstallationPending, nil)
+		return defaultRequeueDuration, nil
+	}
+
+	desiredVersion := release.AppVersion
+	if isKubewardenInstalled(cluster) {
+		remoteClient, err := r.RemoteClientGetter(ctx, cluster.Name, r.Client, client.ObjectKeyFromObject(cluster))
 		if err != nil {
-			return ctrl.Result{}, fmt.Errorf("getting remote cluster client: %w", err)
+			return 0, fmt.Errorf("getting remote cluster client: %w", err)
+		}
+
+		// clusters installed before the addon annotation existed are adopted by the addon selecting them
+		if !HasAnnotation(cluster, KubewardenAddonAnnotation) {
+			if err := r.annotateCluster(ctx, cluster, map[string]string{
+				KubewardenAddonAnnotation: addonName,
+			}); err != nil {
+				return 0, err
+			}
 		}
 
-		// create kubewarden namespace
-		log.Info("Creating namespace for Kubewarden", "cluster", cluster.Name)
-		if err := createKubewardenNamespace(ctx, remoteClient); err != nil {
-			return ctrl.Result{}, fmt.Errorf("creating kubewarden namespace: %w", err)
+		installedVersion := cluster.GetAnnotations()[KubewardenVersionAnnotation]
+		installedHash := cluster.GetAnnotations()[KubewardenHashAnnotation]
+		status.InstalledVersion = installedVersion
+		status.AppliedHash = installedHash
+		// clusters installed before the hash annotation existed are brought to the desired state by the drift
+		// correction, instead of being upgraded again
+		if installedVersion == desiredVersion && (installedHash == desiredHash || installedHash == "") {
+			// Kubewarden is installed, make sure nobody changed it in the meantime
+			log.Info("Checking Kubewarden resources for drift")
+			drifted, err := r.correctKubewardenDrift(ctx, remoteClient, manifests)
+			if err != nil {
+				return 0, fmt.Errorf("correcting kubewarden drift: %w", err)
+			}
+			if drifted > 0 {
+				log.Info("Corrected drifted Kubewarden resources", "count", drifted)
+			}
+
+			setClusterDriftStatus(status, drifted)
+
+			if installedHash == "" {
+				log.Info(fmt.Sprintf("Replacing %s annotation with %s", KubewardenInstalledAnnotation, KubewardenHashAnnotation))
+				if err := r.annotateCluster(ctx, cluster, map[string]string{
+					KubewardenHashAnnotation: desiredHash,
+				}); err != nil {
+					return 0, err
+				}
+				if err := r.removeClusterAnnotations(ctx, cluster, KubewardenInstalledAnnotation); err != nil {
+					return 0, err
+				}
+				status.AppliedHash = desiredHash
+			}
+
+			// Kubewarden only stays ready as long as its components keep running
+			healthy, err := updateKubewardenHealth(ctx, remoteClient, status, manifests)
+			if err != nil {
+				return 0, err
+			}
+			if !healthy {
+				setClusterPhase(status, addonv1alpha1.ClusterInstallationDegraded, nil)
+				return healthCheckInterval, nil
+			}
+
+			setClusterPhase(status, addonv1alpha1.ClusterInstallationReady, nil)
+			return driftCheckInterval, nil
 		}
 
-		// create kubewarden crds
-		log.Info("Applying Kubewarden CRDs", "cluster", cluster.Name)
-		// Use appVersion from spec if provided; otherwise default.
-		appVersion := kubewardenVersion
-		if addon.Spec.Version != "" {
-			appVersion = addon.Spec.Version
+		// new values or addon settings are rolled out like a new version, one component after the other
+		if installedVersion == desiredVersion {
+			log.Info("Reconfiguring Kubewarden", "hash", desiredHash)
+		} else {
+			log.Info("Upgrading Kubewarden", "from", installedVersion, "to", desiredVersion)
 		}
-		err = r.installKubewardenCRDs(ctx, appVersion, remoteClient)
+		setClusterPhase(status, addonv1alpha1.ClusterInstallationUpgrading, nil)
+		phases.publish(ctx, cluster, status)
+		upgraded, err := r.upgradeKubewarden(ctx, remoteClient, manifests)
 		if err != nil {
-			return ctrl.Result{}, fmt.Errorf("creating kubewarden CRDs: %w", err)
+			return 0, fmt.Errorf("upgrading kubewarden: %w", err)
+		}
+		if !upgraded {
+			log.Info("Waiting for Kubewarden components to become available")
+			return upgradeRequeueDuration, nil
+		}
+		healthy, err := updateKubewardenHealth(ctx, remoteClient, status, manifests)
+		if err != nil || !healthy {
+			return upgradeRequeueDuration, err
 		}
 
-		// install kubewarden-controller
-		log.Info("Installing Kubewarden controller", "cluster", cluster.Name)
-		if err := r.installKubewardenController(ctx, remoteClient, addon); err != nil {
-			return ctrl.Result{}, fmt.Errorf("installing kubewarden controller: %w", err)
+		log.Info(fmt.Sprintf("Successfully upgraded Kubewarden on cluster %s to %s", cluster.Name, desiredVersion))
+		if err := r.annotateCluster(ctx, cluster, map[string]string{
+			KubewardenHashAnnotation:    desiredHash,
+			KubewardenVersionAnnotation: desiredVersion,
+		}); err != nil {
+			return 0, err
 		}
+		if err := r.removeClusterAnnotations(ctx, cluster, KubewardenInstalledAnnotation); err != nil {
+			return 0, err
+		}
+		status.InstalledVersion = desiredVersion
+		status.AppliedHash = desiredHash
+		setClusterPhase(status, addonv1alpha1.ClusterInstallationReady, nil)
+		return driftCheckInterval, nil
+	}
+
+	setClusterPhase(status, addonv1alpha1.ClusterInstallationInstalling, nil)
+	phases.publish(ctx, cluster, status)
+
+	// create a remote client to connect to the workload cluster
+	remoteClient, err := r.RemoteClientGetter(ctx, cluster.Name, r.Client, client.ObjectKeyFromObject(cluster))
+	if err != nil {
+		return 0, fmt.Errorf("getting remote cluster client: %w", err)
+	}
+
+	// create kubewarden namespace
+	log.Info("Creating namespace for Kubewarden")
+	if err := createKubewardenNamespace(ctx, remoteClient); err != nil {
+		return 0, fmt.Errorf("creating kubewarden namespace: %w", err)
+	}
+
+	// create kubewarden crds
+	log.Info("Applying Kubewarden CRDs")
+	if err := r.applyObjects(ctx, remoteClient, manifests.CRDs); err != nil {
+		return 0, fmt.Errorf("creating kubewarden CRDs: %w", err)
+	}
+
+	// install kubewarden-controller
+	log.Info("Installing Kubewarden controller")
+	if err := r.applyObjects(ctx, remoteClient, manifests.Controller); err != nil {
+		return 0, fmt.Errorf("installing kubewarden controller: %w", err)
+	}
+
+	// install kubewarden-defaults
+	log.Info("Installing default 'PolicyServer'")
+	if err := r.applyObjects(ctx, remoteClient, manifests.Defaults); err != nil {
+		return 0, fmt.Errorf("installing kubewarden defaults: %w", err)
+	}
+
+	// the cluster is only recorded as installed once the components are running, until then everything is
+	// applied again on the next attempt
+	healthy, err := updateKubewardenHealth(ctx, remoteClient, status, manifests)
+	if err != nil || !healthy {
+		return upgradeRequeueDuration, err
+	}
 
-		// install kubewarden-defaults
-		log.Info("Installing default 'PolicyServer'", "cluster", cluster.Name)
-		if err := r.installKubewardenDefaults(ctx, remoteClient, addon); err != nil {
-			return ctrl.Result{}, fmt.Errorf("installing kubewarden defaults: %w", err)
+	// annotate cluster so we don't try to deploy kubewarden again until the manifests change
+	log.Info(fmt.Sprintf("Successfully deployed Kubewarden to cluster %s: annotating with %s",
+		cluster.Name,
+		KubewardenHashAnnotation))
+
+	if err := r.annotateCluster(ctx, cluster, map[string]string{
+		KubewardenHashAnnotation:    desiredHash,
+		KubewardenVersionAnnotation: desiredVersion,
+		KubewardenAddonAnnotation:   addonName,
+	}); err != nil {
+		return 0, err
+	}
+	status.InstalledVersion = desiredVersion
+	status.AppliedHash = desiredHash
+	setClusterDriftStatus(status, 0)
+	setClusterPhase(status, addonv1alpha1.ClusterInstallationReady, nil)
+
+	return driftCheckInterval, nil
+}
+
+// maxConcurrentClusterReconciles returns the maximum number of clusters of an addon reconciled in parallel.
+func (r *KubewardenAddonReconciler) maxConcurrentClusterReconciles() int {
+	if r.MaxConcurrentClusterReconciles > 0 {
+		return r.MaxConcurrentClusterReconciles
+	}
+
+	return DefaultMaxConcurrentClusterReconciles
+}
+
+// apiReader returns the reader of the ConfigMaps and Secrets referenced by the addons.
+func (r *KubewardenAddonReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+
+	return r.Client
+}
+
+// artifactCache returns the artifact cache of the reconciler.
+func (r *KubewardenAddonReconciler) artifactCache() *ArtifactCache {
+	if r.ArtifactCache != nil {
+		return r.ArtifactCache
+	}
+
+	return defaultArtifactCache
+}
+
+// artifactFetcher returns the artifact fetcher of the reconciler.
+func (r *KubewardenAddonReconciler) artifactFetcher() *ArtifactFetcher {
+	if r.ArtifactFetcher != nil {
+		return r.ArtifactFetcher
+	}
+
+	return defaultArtifactFetcher
+}
+
+// shortestRequeue returns the shortest of two requeue intervals, zero meaning no requeue.
+func shortestRequeue(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+
+	return a
+}
+
+// annotateCluster sets the given annotations on the cluster.
+func (r *KubewardenAddonReconciler) annotateCluster(ctx context.Context, cluster *clusterv1.Cluster, values map[string]string) error {
+	annotations := cluster.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	clusterCopy := cluster.DeepCopy()
+	for key, value := range values {
+		annotations[key] = value
+	}
+	cluster.SetAnnotations(annotations)
+
+	patch := client.MergeFrom(clusterCopy)
+	if err := r.Client.Patch(ctx, cluster, patch); err != nil {
+		return fmt.Errorf("update cluster annotations: %w", err)
+	}
+
+	return nil
+}
+
+// removeClusterAnnotations removes the given annotations from the cluster.
+func (r *KubewardenAddonReconciler) removeClusterAnnotations(ctx context.Context, cluster *clusterv1.Cluster, keys ...string) error {
+	clusterCopy := cluster.DeepCopy()
+	annotations := cluster.GetAnnotations()
+	for _, key := range keys {
+		delete(annotations, key)
+	}
+	cluster.SetAnnotations(annotations)
+
+	patch := client.MergeFrom(clusterCopy)
+	if err := r.Client.Patch(ctx, cluster, patch); err != nil {
+		return fmt.Errorf("remove cluster annotations: %w", err)
+	}
+
+	return nil
+}
+
+// labelCluster sets the given labels on the cluster.
+func (r *KubewardenAddonReconciler) labelCluster(ctx context.Context, cluster *clusterv1.Cluster, values map[string]string) error {
+	clusterLabels := cluster.GetLabels()
+	if clusterLabels == nil {
+		clusterLabels = map[string]string{}
+	}
+
+	clusterCopy := cluster.DeepCopy()
+	for key, value := range values {
+		clusterLabels[key] = value
+	}
+	cluster.SetLabels(clusterLabels)
+
+	patch := client.MergeFrom(clusterCopy)
+	if err := r.Client.Patch(ctx, cluster, patch); err != nil {
+		return fmt.Errorf("update cluster labels: %w", err)
+	}
+
+	return nil
+}
+
+// removeClusterLabels removes the given labels from the cluster.
+func (r *KubewardenAddonReconciler) removeClusterLabels(ctx context.Context, cluster *clusterv1.Cluster, keys ...string) error {
+	clusterCopy := cluster.DeepCopy()
+	clusterLabels := cluster.GetLabels()
+	for _, key := range keys {
+		delete(clusterLabels, key)
+	}
+	cluster.SetLabels(clusterLabels)
+
+	patch := client.MergeFrom(clusterCopy)
+	if err := r.Client.Patch(ctx, cluster, patch); err != nil {
+		return fmt.Errorf("remove cluster labels: %w", err)
+	}
+
+	return nil
+}
+
+// isLabelledForAddon returns whether the cluster is selected for the ClusterResourceSet or the HelmChartProxies of
+// the given addon.
+func isLabelledForAddon(cluster *clusterv1.Cluster, addon *addonv1alpha1.KubewardenAddon) bool {
+	return cluster.GetLabels()[KubewardenAddonLabel] == addon.Name
+}
+
+// isInstalledByAddon returns whether Kubewarden was installed on the cluster by the given addon.
+func isInstalledByAddon(cluster *clusterv1.Cluster, addon *addonv1alpha1.KubewardenAddon) bool {
+	return isKubewardenInstalled(cluster) && cluster.GetAnnotations()[KubewardenAddonAnnotation] == addon.Name
+}
+
+// deselectedClusters returns the clusters the addon installed Kubewarden to, or selected for its ClusterResourceSet
+// or HelmChartProxies, that no longer match its cluster selector.
+func deselectedClusters(addon *addonv1alpha1.KubewardenAddon, allClusters, selectedClusters []clusterv1.Cluster) []clusterv1.Cluster {
+	selected := map[string]bool{}
+	for _, cluster := range selectedClusters {
+		selected[cluster.Name] = true
+	}
+
+	deselected := []clusterv1.Cluster{}
+	for _, cluster := range allClusters {
+		if !selected[cluster.Name] && (isInstalledByAddon(&cluster, addon) || isLabelledForAddon(&cluster, addon)) {
+			deselected = append(deselected, cluster)
+		}
+	}
+
+	return deselected
+}
+
+// reconcileDeselectedClusters applies the deselection policy of the addon to the clusters it installed Kubewarden
+// to that no longer match its cluster selector: Kubewarden is uninstalled from them, or left in place and no longer
+// managed by the addon. Clusters being uninstalled are reported with the Uninstalling phase until they are clean.
+// It returns when they should be checked again.
+func (r *KubewardenAddonReconciler) reconcileDeselectedClusters(ctx context.Context, addon *addonv1alpha1.KubewardenAddon, allClusters, selectedClusters []clusterv1.Cluster) (time.Duration, []error) {
+	log := log.FromContext(ctx)
+
+	requeueAfter := time.Duration(0)
+	errs := []error{}
+	for _, cluster := range deselectedClusters(addon, allClusters, selectedClusters) {
+		log := log.WithValues("cluster", cluster.Name)
+
+		// nothing to clean up on a cluster that is going away, and paused clusters are left untouched
+		if !cluster.DeletionTimestamp.IsZero() || isClusterPaused(&cluster) {
+			continue
 		}
 
-		// Patch PolicyServer and deployments to tolerate control-plane taint
-		log.Info("Applying control-plane tolerations", "cluster", cluster.Name)
-		if err := r.applyControlPlaneTolerations(ctx, remoteClient); err != nil {
-			return ctrl.Result{}, fmt.Errorf("applying control-plane tolerations: %w", err)
+		if addon.Spec.DeselectionPolicy == addonv1alpha1.DeselectionPolicyOrphan {
+			log.Info("Cluster is no longer selected, leaving Kubewarden in place")
+			err := r.removeClusterAnnotations(ctx, &cluster, KubewardenAddonAnnotation)
+			if err == nil {
+				// a ClusterResourceSet leaves the objects it applied in place
+				err = r.removeClusterLabels(ctx, &cluster, KubewardenAddonLabel)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("cluster %s: %w", cluster.Name, err))
+			}
+			continue
 		}
 
-		// annotate cluster so we don't try to deploy kubewarden again
-		log.Info(fmt.Sprintf("Successfully deployed Kubewarden to cluster %s: annotating with %s",
-			cluster.Name,
-			KubewardenInstalledAnnotation))
+		log.Info("Cluster is no longer selected, uninstalling Kubewarden")
+		uninstalled, err := r.installer(addon).uninstall(ctx, &cluster, addon)
+		if err == nil && uninstalled {
+			log.Info("Successfully uninstalled Kubewarden from deselected cluster")
+			err = r.removeClusterAnnotations(ctx, &cluster, KubewardenHashAnnotation, KubewardenInstalledAnnotation,
+				KubewardenVersionAnnotation, KubewardenAddonAnnotation)
+			if err == nil {
+				continue
+			}
+		}
+
+		status := clusterInstallationStatus(addon, &cluster)
+		status.InstalledVersion = cluster.GetAnnotations()[KubewardenVersionAnnotation]
+		setClusterPhase(status, addonv1alpha1.ClusterInstallationUninstalling, err)
+		if err != nil {
+			log.Error(err, "Failed to uninstall Kubewarden from deselected cluster")
+			errs = append(errs, fmt.Errorf("cluster %s: %w", cluster.Name, err))
+			requeueAfter = shortestRequeue(requeueAfter, failureRequeueDuration)
+			continue
+		}
+		requeueAfter = shortestRequeue(requeueAfter, deletionRequeueDuration)
+	}
+
+	return requeueAfter, errs
+}
+
+// clusterInstallationStatus returns the installation status of the cluster, adding it to the addon status if missing.
+// The returned pointer is only valid until the next status is added.
+func clusterInstallationStatus(addon *addonv1alpha1.KubewardenAddon, cluster *clusterv1.Cluster) *addonv1alpha1.ClusterInstallationStatus {
+	for i := range addon.Status.Clusters {
+		status := &addon.Status.Clusters[i]
+		if status.ClusterName == cluster.Name && status.ClusterNamespace == cluster.Namespace {
+			return status
+		}
+	}
+
+	addon.Status.Clusters = append(addon.Status.Clusters, addonv1alpha1.ClusterInstallationStatus{
+		ClusterName:      cluster.Name,
+		ClusterNamespace: cluster.Namespace,
+	})
+
+	return &addon.Status.Clusters[len(addon.Status.Clusters)-1]
+}
+
+// setClusterDriftStatus records the number of drifted objects found on the cluster during the last drift check.
+func setClusterDriftStatus(status *addonv1alpha1.ClusterInstallationStatus, drifted int) {
+	status.DriftedObjects = int32(drifted)
+	if drifted > 0 {
+		now := metav1.Now()
+		status.LastDriftTime = &now
+	}
+}
+
+// setClusterPhase records the installation phase of the cluster, along with the error of a failed phase. The
+// transition time only changes with the phase.
+func setClusterPhase(status *addonv1alpha1.ClusterInstallationStatus, phase addonv1alpha1.ClusterInstallationPhase, err error) {
+	if status.Phase != phase {
+		now := metav1.Now()
+		status.Phase = phase
+		status.LastTransitionTime = &now
+	}
+
+	status.LastError = ""
+	if err != nil {
+		status.LastError = err.Error()
+	}
+}
+
+// setKubewardenAddonConditions sets the KubewardenAddon conditions from the installation status of the selected
+// clusters, and summarizes them in the Ready condition.
+func setKubewardenAddonConditions(addon *addonv1alpha1.KubewardenAddon) {
+	var failed, degraded, upgrading, updating []string
+	for _, status := range addon.Status.Clusters {
+		switch status.Phase {
+		case addonv1alpha1.ClusterInstallationFailed:
+			failed = append(failed, fmt.Sprintf("%s: %s", status.ClusterName, status.LastError))
+		case addonv1alpha1.ClusterInstallationDegraded:
+			degraded = append(degraded, fmt.Sprintf("%s: %s", status.ClusterName, clusterReadyCondition(&status).Message))
+		case addonv1alpha1.ClusterInstallationUpgrading:
+			upgrading = append(upgrading, status.ClusterName)
+		case addonv1alpha1.ClusterInstallationPending, addonv1alpha1.ClusterInstallationInstalling:
+			updating = append(updating, status.ClusterName)
+		}
+	}
+
+	rollout := addon.Status.Rollout
+	rolling := rollout != nil && int(rollout.UpdatedClusters) < len(addon.Status.MatchingClusters)
+	// clusters still running a previous rollout stay ready, the clusters being rolled out are waited on
+	waiting := append(upgrading, updating...)
+	if len(waiting) == 0 && rollout != nil {
+		waiting = rollout.Clusters
+	}
+
+	switch {
+	case len(failed) > 0 && rollout != nil && rollout.Halted:
+		conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonSpecsUpToDateCondition, addonv1alpha1.RolloutHaltedReason,
+			clusterv1.ConditionSeverityError, "%s", rollout.Message)
+		conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonsReadyCondition, addonv1alpha1.KubewardenAddonCreationFailedReason,
+			clusterv1.ConditionSeverityError, "Failed to install or upgrade Kubewarden on clusters: %s", strings.Join(failed, "; "))
+	case rollout != nil && rollout.Halted:
+		// the clusters that halted the rollout did not become healthy in time
+		conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonSpecsUpToDateCondition, addonv1alpha1.RolloutHaltedReason,
+			clusterv1.ConditionSeverityError, "%s", rollout.Message)
+		conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonsReadyCondition, addonv1alpha1.KubewardenComponentsNotReadyReason,
+			clusterv1.ConditionSeverityError, "%s", rollout.Message)
+	case len(failed) > 0:
+		message := fmt.Sprintf("Failed to install or upgrade Kubewarden on clusters: %s", strings.Join(failed, "; "))
+		conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonSpecsUpToDateCondition, addonv1alpha1.KubewardenAddonCreationFailedReason,
+			clusterv1.ConditionSeverityError, "%s", message)
+		conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonsReadyCondition, addonv1alpha1.KubewardenAddonCreationFailedReason,
+			clusterv1.ConditionSeverityError, "%s", message)
+	case len(degraded) > 0 && len(upgrading) == 0 && len(updating) == 0:
+		conditions.MarkTrue(addon, addonv1alpha1.KubewardenAddonSpecsUpToDateCondition)
+		conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonsReadyCondition, addonv1alpha1.KubewardenComponentsNotReadyReason,
+			clusterv1.ConditionSeverityWarning, "Kubewarden components are not healthy on clusters: %s", strings.Join(degraded, "; "))
+	case rolling && len(waiting) > 0:
+		conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonSpecsUpToDateCondition, addonv1alpha1.RolloutInProgressReason,
+			clusterv1.ConditionSeverityInfo, "%s: %d/%d clusters updated", rollout.Message, rollout.UpdatedClusters, len(addon.Status.MatchingClusters))
+		conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonsReadyCondition, addonv1alpha1.RolloutInProgressReason,
+			clusterv1.ConditionSeverityInfo, "Waiting for the rollout of Kubewarden %s on clusters: %s", rollout.Version, strings.Join(waiting, ", "))
+	case len(upgrading) > 0:
+		conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonSpecsUpToDateCondition, addonv1alpha1.KubewardenAddonSpecsUpdatingReason,
+			clusterv1.ConditionSeverityInfo, "Updating Kubewarden on clusters: %s", strings.Join(append(upgrading, updating...), ", "))
+		conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonsReadyCondition, addonv1alpha1.KubewardenAddonReinstallingReason,
+			clusterv1.ConditionSeverityInfo, "Upgrading Kubewarden on clusters: %s", strings.Join(upgrading, ", "))
+	case len(updating) > 0:
+		conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonSpecsUpToDateCondition, addonv1alpha1.KubewardenAddonSpecsUpdatingReason,
+			clusterv1.ConditionSeverityInfo, "Installing Kubewarden on clusters: %s", strings.Join(updating, ", "))
+		conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonsReadyCondition, addonv1alpha1.KubewardenAddonSpecsUpdatingReason,
+			clusterv1.ConditionSeverityInfo, "Installing Kubewarden on clusters: %s", strings.Join(updating, ", "))
+	case len(addon.Status.MatchingClusters) == 0:
+		conditions.MarkTrue(addon, addonv1alpha1.KubewardenAddonSpecsUpToDateCondition)
+		conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonsReadyCondition, addonv1alpha1.NoMatchingClustersReason,
+			clusterv1.ConditionSeverityInfo, "No cluster matches the cluster selector")
+	default:
+		conditions.MarkTrue(addon, addonv1alpha1.KubewardenAddonSpecsUpToDateCondition)
+		conditions.MarkTrue(addon, addonv1alpha1.KubewardenAddonsReadyCondition)
+	}
+
+	summarizeKubewardenAddonConditions(addon)
+}
+
+// summarizeKubewardenAddonConditions sets the Ready condition of the addon from its other conditions.
+func summarizeKubewardenAddonConditions(addon *addonv1alpha1.KubewardenAddon) {
+	conditions.SetSummary(addon,
+		conditions.WithConditions(
+			addonv1alpha1.KubewardenAddonSpecsUpToDateCondition,
+			addonv1alpha1.KubewardenAddonsReadyCondition,
+		),
+	)
+}
 
-		annotations := cluster.GetAnnotations()
-		if annotations == nil {
-			annotations = map[string]string{}
+// keepTransitionTimes restores the transition time of the clusters that went through intermediate phases during
+// the reconcile but ended up in the phase they started with, such as a failed cluster failing again.
+func keepTransitionTimes(addon, previous *addonv1alpha1.KubewardenAddon) {
+	for i := range addon.Status.Clusters {
+		status := &addon.Status.Clusters[i]
+		for _, previousStatus := range previous.Status.Clusters {
+			if previousStatus.ClusterName == status.ClusterName && previousStatus.ClusterNamespace == status.ClusterNamespace &&
+				previousStatus.Phase == status.Phase {
+				status.LastTransitionTime = previousStatus.LastTransitionTime
+			}
 		}
+	}
+}
+
+// updateClusterCounts updates the number of selected, ready and failed clusters in the addon status.
+func updateClusterCounts(addon *addonv1alpha1.KubewardenAddon) {
+	addon.Status.SelectedClusters = int32(len(addon.Status.MatchingClusters))
+	addon.Status.ReadyClusters = 0
+	addon.Status.FailedClusters = 0
+	for _, status := range addon.Status.Clusters {
+		switch status.Phase {
+		case addonv1alpha1.ClusterInstallationReady:
+			addon.Status.ReadyClusters++
+		case addonv1alpha1.ClusterInstallationFailed:
+			addon.Status.FailedClusters++
+		}
+	}
+}
 
-		clusterCopy := cluster.DeepCopy()
-		annotations[KubewardenInstalledAnnotation] = "true"
-		cluster.SetAnnotations(annotations)
+// pruneClusterStatuses removes the installation status of the clusters that are no longer selected by the addon.
+func pruneClusterStatuses(addon *addonv1alpha1.KubewardenAddon, selectedClusters []clusterv1.Cluster) {
+	selected := map[types.NamespacedName]bool{}
+	for _, cluster := range selectedClusters {
+		selected[client.ObjectKeyFromObject(&cluster)] = true
+	}
 
-		patch := client.MergeFrom(clusterCopy)
-		if err := r.Client.Patch(ctx, &cluster, patch); err != nil {
-			return ctrl.Result{}, fmt.Errorf("update cluster annotations: %w", err)
+	statuses := []addonv1alpha1.ClusterInstallationStatus{}
+	for _, status := range addon.Status.Clusters {
+		if selected[types.NamespacedName{Name: status.ClusterName, Namespace: status.ClusterNamespace}] {
+			statuses = append(statuses, status)
 		}
 	}
+	addon.Status.Clusters = statuses
+}
+
+// upgradeKubewarden upgrades Kubewarden on the workload cluster to the version and the configuration of the addon. CRDs are upgraded
+// first, then the kubewarden-controller once they are established and the kubewarden-defaults chart once the
+// controller is available. It returns false while the upgraded components are not available yet.
+func (r *KubewardenAddonReconciler) upgradeKubewarden(ctx context.Context, remoteClient client.Client, manifests *kubewardenManifests) (bool, error) {
+	log := log.FromContext(ctx)
+
+	// upgrade kubewarden crds
+	log.Info("Upgrading Kubewarden CRDs")
+	if err := r.applyObjects(ctx, remoteClient, manifests.CRDs); err != nil {
+		return false, fmt.Errorf("upgrading kubewarden CRDs: %w", err)
+	}
+
+	// the new controller may rely on the new versions of the CRDs, it waits for them to be served
+	established, err := areCRDsEstablished(ctx, remoteClient, manifests.CRDs)
+	if err != nil || !established {
+		return false, err
+	}
+
+	// upgrade kubewarden-controller
+	log.Info("Upgrading Kubewarden controller")
+	if err := r.applyObjects(ctx, remoteClient, manifests.Controller); err != nil {
+		return false, fmt.Errorf("upgrading kubewarden controller: %w", err)
+	}
+	available, err := isDeploymentAvailable(ctx, remoteClient, kubewardenHelmReleaseName+"-kubewarden-controller")
+	if err != nil || !available {
+		return false, err
+	}
+
+	// upgrade kubewarden-defaults
+	log.Info("Upgrading default 'PolicyServer'")
+	if err := r.applyObjects(ctx, remoteClient, manifests.Defaults); err != nil {
+		return false, fmt.Errorf("upgrading kubewarden defaults: %w", err)
+	}
+
+	// the objects of the previous installation the addon does not render anymore are removed
+	if _, err := removeStaleKubewardenObjects(ctx, remoteClient, manifests); err != nil {
+		return false, err
+	}
+
+	// the policy server Deployment is created by the kubewarden-controller
+	return isDeploymentAvailable(ctx, remoteClient, "policy-server-"+kubewardenHelmDefaultPolicyServerName)
+}
+
+// correctKubewardenDrift compares the Kubewarden resources in the workload cluster with the desired state of the
+// addon and re-applies the ones that drifted. It returns the number of drifted resources.
+func (r *KubewardenAddonReconciler) correctKubewardenDrift(ctx context.Context, remoteClient client.Client, manifests *kubewardenManifests) (int, error) {
+	drifted := 0
+
+	components := []struct {
+		name string
+		objs []client.Object
+	}{
+		{name: "CRDs", objs: manifests.CRDs},
+		{name: kubewardenControllerChartName, objs: manifests.Controller},
+		{name: kubewardenDefaultsChartName, objs: manifests.Defaults},
+	}
+	for _, component := range components {
+		count, err := r.correctObjectsDrift(ctx, remoteClient, component.objs)
+		if err != nil {
+			return 0, fmt.Errorf("correct %s drift: %w", component.name, err)
+		}
+		drifted += count
+	}
+
+	count, err := removeStaleKubewardenObjects(ctx, remoteClient, manifests)
+	if err != nil {
+		return 0, err
+	}
+	drifted += count
+
+	return drifted, nil
+}
+
+// removeStaleKubewardenObjects deletes the objects left on the cluster by a previous installation that the addon
+// does not render anymore. It returns the number of deleted objects counted as drift.
+func removeStaleKubewardenObjects(ctx context.Context, remoteClient client.Client, manifests *kubewardenManifests) (int, error) {
+	// a disabled audit scanner is not rendered anymore, the one left from a previous installation is removed. This
+	// follows a change of the addon settings, so it is not counted.
+	if err := removeDisabledAuditScanner(ctx, remoteClient, manifests); err != nil {
+		return 0, fmt.Errorf("removing disabled audit scanner: %w", err)
+	}
+
+	// the verification config is not rendered anymore once the addon stops setting it
+	removed, err := removeStaleVerificationConfig(ctx, remoteClient, manifests)
+	if err != nil {
+		return 0, fmt.Errorf("correct verification config drift: %w", err)
+	}
+
+	// so are the registry credentials
+	count, err := removeStaleRegistryCredentials(ctx, remoteClient, manifests)
+	if err != nil {
+		return 0, fmt.Errorf("correct registry credentials drift: %w", err)
+	}
+	removed += count
+
+	return removed, nil
+}
+
+func (r *KubewardenAddonReconciler) reconcileDelete(ctx context.Context, addon *addonv1alpha1.KubewardenAddon) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	log.Info("Deleting Kubewarden addon")
+
+	if !controllerutil.ContainsFinalizer(addon, addonv1alpha1.KubewardenAddonFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	allClusters, err := r.getAllCapiClusters(ctx, addon.Namespace)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("getting capi clusters: %w", err)
+	}
+
+	selectedClusters, err := r.selectClusters(allClusters, addon.Spec.ClusterSelector)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("selecting clusters: %w", err)
+	}
+
+	// clusters still being uninstalled after they were deselected are cleaned up as well
+	clusters := append(selectedClusters, deselectedClusters(addon, allClusters, selectedClusters)...)
 
-	// Update addon status: all selected clusters are now ready
 	addonCopy := addon.DeepCopy()
-	addon.Status.Ready = len(selectedClusters) > 0 && len(clusters) == len(selectedClusters)
-	if addon.Status.Ready {
-		log.Info("All selected clusters have Kubewarden installed", "ready", addon.Status.Ready)
+	pendingClusters := []string{}
+	errs := []error{}
+
+	for _, cluster := range clusters {
+		log := log.WithValues("cluster", cluster.Name)
+
+		// clusters selected by several addons are only uninstalled by the addon that installed Kubewarden on them
+		if !isInstalledByAddon(&cluster, addon) && !isLabelledForAddon(&cluster, addon) {
+			continue
+		}
+
+		// nothing to clean up on a cluster that is going away
+		if !cluster.DeletionTimestamp.IsZero() {
+			log.Info("Cluster is being deleted, skipping Kubewarden uninstall")
+			continue
+		}
+
+		// paused clusters hold the deletion of the addon until they are resumed
+		if isClusterPaused(&cluster) {
+			log.Info("Cluster is paused, waiting to uninstall Kubewarden")
+			pendingClusters = append(pendingClusters, cluster.Name)
+			continue
+		}
+
+		uninstalled, err := r.installer(addon).uninstall(ctx, &cluster, addon)
+		if err != nil {
+			log.Error(err, "Failed to uninstall Kubewarden from cluster")
+			errs = append(errs, fmt.Errorf("cluster %s: %w", cluster.Name, err))
+			continue
+		}
+
+		if !uninstalled {
+			pendingClusters = append(pendingClusters, cluster.Name)
+			continue
+		}
+
+		// remove the annotations so Kubewarden can be installed again by another addon
+		log.Info(fmt.Sprintf("Successfully uninstalled Kubewarden from cluster %s: removing %s annotation",
+			cluster.Name,
+			KubewardenHashAnnotation))
+
+		if err := r.removeClusterAnnotations(ctx, &cluster, KubewardenHashAnnotation, KubewardenInstalledAnnotation,
+			KubewardenVersionAnnotation, KubewardenAddonAnnotation); err != nil {
+			errs = append(errs, fmt.Errorf("cluster %s: %w", cluster.Name, err))
+		}
 	}
 
-	// Patch addon status
-	statusPath := client.MergeFrom(addonCopy)
-	if err := r.Client.Status().Patch(ctx, addon, statusPath); err != nil {
-		log.Error(err, "failed to update addon status")
-		// Don't return error here as the main functionality succeeded
+	if len(errs) > 0 {
+		aggregate := kerrors.NewAggregate(errs)
+		conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonsReadyCondition, addonv1alpha1.KubewardenAddonDeletionFailedReason,
+			clusterv1.ConditionSeverityWarning, "%s", aggregate.Error())
+		summarizeKubewardenAddonConditions(addon)
+		if err := r.Client.Status().Patch(ctx, addon, client.MergeFrom(addonCopy)); err != nil {
+			log.Error(err, "failed to update addon status")
+		}
+
+		return ctrl.Result{}, aggregate
+	}
+
+	if len(pendingClusters) > 0 {
+		log.Info("Waiting for Kubewarden resources to be removed", "clusters", pendingClusters)
+		conditions.MarkFalse(addon, addonv1alpha1.KubewardenAddonsReadyCondition, clusterv1.DeletingReason,
+			clusterv1.ConditionSeverityInfo, "Uninstalling Kubewarden from clusters: %s", strings.Join(pendingClusters, ", "))
+		summarizeKubewardenAddonConditions(addon)
+		if err := r.Client.Status().Patch(ctx, addon, client.MergeFrom(addonCopy)); err != nil {
+			log.Error(err, "failed to update addon status")
+		}
+
+		return ctrl.Result{RequeueAfter: deletionRequeueDuration}, nil
+	}
+
+	// all clusters are clean, let the addon go
+	addonCopy = addon.DeepCopy()
+	controllerutil.RemoveFinalizer(addon, addonv1alpha1.KubewardenAddonFinalizer)
+	if err := r.Client.Patch(ctx, addon, client.MergeFrom(addonCopy)); err != nil {
+		return ctrl.Result{}, fmt.Errorf("removing finalizer: %w", err)
 	}
 
 	return ctrl.Result{}, nil
 }
 
+// uninstallKubewarden removes Kubewarden from the workload cluster. Resources are removed in the reverse order of
+// the installation: policies and policy servers rely on the kubewarden-controller to clear their finalizers, so
+// they must be gone before the controller is removed. It returns false while resources are still being deleted.
+func (r *KubewardenAddonReconciler) uninstallKubewarden(ctx context.Context, cluster *clusterv1.Cluster, addon *addonv1alpha1.KubewardenAddon) (bool, error) {
+	log := log.FromContext(ctx)
+
+	// uninstall the version that was installed on the cluster
+	appVersion := cluster.GetAnnotations()[KubewardenVersionAnnotation]
+	if appVersion == "" {
+		appVersion = kubewardenAppVersion(addon)
+	}
+	release, err := r.resolveRelease(ctx, addon, appVersion)
+	if err != nil {
+		return false, fmt.Errorf("resolving kubewarden release: %w", err)
+	}
+
+	// the referenced values might be gone already, they are only needed to know which objects to delete
+	values, err := r.resolveChartValues(ctx, addon)
+	if err != nil {
+		log.Error(err, "Failed to resolve the Kubewarden values, uninstalling with the provider values")
+		values = providerChartValues(addon)
+	}
+
+	remoteClient, err := r.RemoteClientGetter(ctx, cluster.Name, r.Client, client.ObjectKeyFromObject(cluster))
+	if err != nil {
+		return false, fmt.Errorf("getting remote cluster client: %w", err)
+	}
+
+	// delete kubewarden policies
+	log.Info("Deleting Kubewarden policies", "cluster", cluster.Name)
+	remaining := 0
+	for _, kind := range kubewardenPolicyKinds {
+		count, err := deleteKubewardenResources(ctx, remoteClient, kind)
+		if err != nil {
+			return false, fmt.Errorf("deleting %s resources: %w", kind, err)
+		}
+		remaining += count
+	}
+	if remaining > 0 {
+		return false, nil
+	}
+
+	// delete kubewarden-defaults
+	log.Info("Deleting Kubewarden defaults", "cluster", cluster.Name)
+	if err := r.uninstallKubewardenChart(ctx, remoteClient, release, kubewardenDefaultsChartName, release.DefaultsChartVersion, values.Defaults); err != nil {
+		return false, fmt.Errorf("uninstalling kubewarden defaults: %w", err)
+	}
+	remaining, err = deleteKubewardenResources(ctx, remoteClient, "PolicyServer")
+	if err != nil {
+		return false, fmt.Errorf("deleting PolicyServer resources: %w", err)
+	}
+	if remaining > 0 {
+		return false, nil
+	}
+	if _, err := deleteVerificationConfig(ctx, remoteClient); err != nil {
+		return false, err
+	}
+	if _, err := deleteRegistryCredentials(ctx, remoteClient); err != nil {
+		return false, err
+	}
+
+	// delete kubewarden-controller
+	log.Info("Deleting Kubewarden controller", "cluster", cluster.Name)
+	if err := r.uninstallKubewardenChart(ctx, remoteClient, release, kubewardenControllerChartName, release.ControllerChartVersion, values.Controller); err != nil {
+		return false, fmt.Errorf("uninstalling kubewarden controller: %w", err)
+	}
+
+	// delete kubewarden crds
+	if addon.Spec.RemoveCRDs {
+		log.Info("Deleting Kubewarden CRDs", "cluster", cluster.Name)
+		if err := r.deleteKubewardenCRDs(ctx, release, remoteClient); err != nil {
+			return false, fmt.Errorf("deleting kubewarden CRDs: %w", err)
+		}
+	}
+
+	return true, nil
+}
+
 func (r *KubewardenAddonReconciler) clusterToKubewardenAddon(ctx context.Context) handler.MapFunc {
 	log := log.FromContext(ctx)
 
@@ -283,22 +1343,88 @@ func (r *KubewardenAddonReconciler) getAllCapiClusters(ctx context.Context, ns s
 	return clusters.Items, nil
 }
 
-func (r *KubewardenAddonReconciler) installKubewardenCRDs(ctx context.Context, version string, remoteClient client.Client) error {
-	// kubewarden crds are published as a tarball on github releases
-	crdsURL := fmt.Sprintf("%s/%s/%s/CRDS.tar.gz", kubewardenControllerRepository, githubReleasesPath, version)
-	crdsPath, err := downloadFile(crdsURL)
+// kubewardenManifests holds the objects of a Kubewarden release rendered with the values of an addon. They are
+// rendered once per reconcile and shared by all the clusters of the addon, so they are never modified.
+type kubewardenManifests struct {
+	// CRDs holds the Kubewarden CRDs.
+	CRDs []client.Object
+
+	// Controller holds the objects of the kubewarden-controller chart.
+	Controller []client.Object
+
+	// Defaults holds the objects of the kubewarden-defaults chart.
+	Defaults []client.Object
+}
+
+// renderKubewardenManifests fetches the CRDs and renders the charts of the given release.
+func (r *KubewardenAddonReconciler) renderKubewardenManifests(ctx context.Context, release *kubewardenRelease, values *kubewardenChartValues) (*kubewardenManifests, error) {
+	crds, err := r.loadKubewardenCRDs(ctx, release)
 	if err != nil {
-		return fmt.Errorf("download CRDs tarball: %w", err)
+		return nil, fmt.Errorf("loading kubewarden CRDs: %w", err)
 	}
-	defer func() {
-		if err := os.Remove(crdsPath); err != nil {
-			fmt.Printf("Error removing CRDs tarball: %v\n", err)
+
+	controller, err := r.renderChartObjects(ctx, release.Artifacts.ChartRepository, kubewardenControllerChartName, release.ControllerChartVersion, values.Controller)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults, err := r.renderChartObjects(ctx, release.Artifacts.ChartRepository, kubewardenDefaultsChartName, release.DefaultsChartVersion, values.Defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kubewardenManifests{
+		CRDs:       crds,
+		Controller: controller,
+		Defaults:   defaults,
+	}, nil
+}
+
+// hash returns a hash of the manifests. It covers everything that ends up on the clusters, the version, the chart
+// values and the settings of the addon, so it only changes when Kubewarden has to be reconfigured.
+func (m *kubewardenManifests) hash() (string, error) {
+	return hashObjects(m.CRDs, m.Controller, m.Defaults)
+}
+
+// hashObjects returns a hash of the given objects, in order.
+func hashObjects(objLists ...[]client.Object) (string, error) {
+	hash := sha256.New()
+	for _, objs := range objLists {
+		for _, obj := range objs {
+			data, err := json.Marshal(obj)
+			if err != nil {
+				return "", fmt.Errorf("encoding %s %s: %w", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), err)
+			}
+			hash.Write(data)
 		}
-	}()
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (r *KubewardenAddonReconciler) deleteKubewardenCRDs(ctx context.Context, release *kubewardenRelease, remoteClient client.Client) error {
+	crds, err := r.loadKubewardenCRDs(ctx, release)
+	if err != nil {
+		return fmt.Errorf("loading kubewarden CRDs: %w", err)
+	}
 
-	extractDir, err := extractTarGz(crdsPath)
+	return r.deleteObjects(ctx, remoteClient, crds)
+}
+
+// downloadKubewardenCRDs downloads and decodes the Kubewarden CRDs for the given app version from the given
+// release URL. The tarball is kept in the artifact cache, and must match the digest if one is given.
+func (r *KubewardenAddonReconciler) downloadKubewardenCRDs(ctx context.Context, releasesURL, version, digest string) ([]client.Object, error) {
+	// kubewarden crds are published as a tarball on github releases
+	crdsURL := fmt.Sprintf("%s/%s/CRDS.tar.gz", strings.TrimSuffix(releasesURL, "/"), version)
+	crdsPath, release, err := r.artifactCache().fetch(artifactKindCRDs, crdsURL, digest, r.artifactFetcher().download(ctx, crdsURL))
 	if err != nil {
-		return fmt.Errorf("extract CRDs: %w", err)
+		return nil, fmt.Errorf("download CRDs tarball: %w", err)
+	}
+	defer release()
+
+	extractDir, err := extractTarGz(crdsPath, r.artifactFetcher().maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("%w: extract CRDs: %w", errArtifactsNotResolved, err)
 	}
 	defer func() {
 		if err := os.RemoveAll(extractDir); err != nil {
@@ -308,180 +1434,115 @@ func (r *KubewardenAddonReconciler) installKubewardenCRDs(ctx context.Context, v
 
 	files, err := filepath.Glob(filepath.Join(extractDir, "*.yaml"))
 	if err != nil {
-		return fmt.Errorf("list extracted files: %w", err)
+		return nil, fmt.Errorf("list extracted files: %w", err)
 	}
+
+	crds := []client.Object{}
 	for _, file := range files {
-		if err := r.applyManifest(ctx, remoteClient, file); err != nil {
-			return fmt.Errorf("apply CRD from file %s: %w", file, err)
+		objs, err := r.decodeManifest(file)
+		if err != nil {
+			return nil, fmt.Errorf("decode CRD from file %s: %w", file, err)
 		}
+		crds = append(crds, objs...)
 	}
 
-	return nil
+	return crds, nil
 }
 
-func (r *KubewardenAddonReconciler) installKubewardenController(ctx context.Context, remoteClient client.Client, addon *addonv1alpha1.KubewardenAddon) error {
-	// Add control-plane toleration for single-node clusters (CAPD, kind, etc.)
-	values := map[string]interface{}{
-		"tolerations": []map[string]interface{}{
-			{
-				"key":      "node-role.kubernetes.io/control-plane",
-				"operator": "Exists",
-				"effect":   "NoSchedule",
-			},
-		},
+// renderChartObjects renders the given chart of the repository and decodes the resulting objects. The chart is
+// fetched through the artifact cache.
+func (r *KubewardenAddonReconciler) renderChartObjects(ctx context.Context, repository, name, version string, values map[string]interface{}) ([]client.Object, error) {
+	chart, err := kubewardenChartIndexes.get(repository, r.artifactFetcher()).fetchChart(ctx, r.artifactCache(), name, version)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s helm chart: %w", name, err)
 	}
 
-	// render kubewarden-controller helm chart and apply it to the cluster
-	// Treat addon.Spec.Version as appVersion; chart version is resolved internally.
-	renderedPath, err := renderHelmChart(ctx, "kubewarden-controller", addon.Spec.Version, values)
+	rendered, err := helmTemplate(TemplateConfig{
+		ReleaseName: kubewardenHelmReleaseName,
+		Namespace:   kubewardenNamespace,
+		Chart:       chart,
+		Values:      values,
+	})
 	if err != nil {
-		return fmt.Errorf("render kubewarden-controller helm chart: %w", err)
+		return nil, fmt.Errorf("render %s helm chart: %w", name, err)
 	}
-	if err := r.applyManifest(ctx, remoteClient, renderedPath); err != nil {
-		return fmt.Errorf("apply kubewarden-controller manifest: %w", err)
+
+	objs, err := decodeObjects(strings.NewReader(rendered))
+	if err != nil {
+		return nil, fmt.Errorf("decode %s manifest: %w", name, err)
 	}
 
-	return nil
+	return objs, nil
 }
 
-func (r *KubewardenAddonReconciler) installKubewardenDefaults(ctx context.Context, remoteClient client.Client, addon *addonv1alpha1.KubewardenAddon) error {
-	// Add control-plane toleration for single-node clusters (CAPD, kind, etc.)
-	values := map[string]interface{}{
-		"policyServer": map[string]interface{}{
-			"tolerations": []map[string]interface{}{
-				{
-					"key":      "node-role.kubernetes.io/control-plane",
-					"operator": "Exists",
-					"effect":   "NoSchedule",
-				},
-			},
-		},
+// uninstallKubewardenChart renders the given chart of the release and deletes the resulting objects from the
+// cluster.
+func (r *KubewardenAddonReconciler) uninstallKubewardenChart(ctx context.Context, remoteClient client.Client, release *kubewardenRelease, name, version string, values map[string]interface{}) error {
+	objs, err := r.renderChartObjects(ctx, release.Artifacts.ChartRepository, name, version, values)
+	if err != nil {
+		return err
 	}
 
-	// render kubewarden-defaults helm chart and apply it to the cluster
-	renderedPath, err := renderHelmChart(ctx, "kubewarden-defaults", addon.Spec.Version, values)
-	if err != nil {
-		return fmt.Errorf("render kubewarden-defaults helm chart: %w", err)
+	if err := r.deleteObjects(ctx, remoteClient, objs); err != nil {
+		return fmt.Errorf("delete %s manifest: %w", name, err)
 	}
-	if err := r.applyManifest(ctx, remoteClient, renderedPath); err != nil {
-		return fmt.Errorf("apply kubewarden-defaults manifest: %w", err)
+
+	return nil
+}
+
+// applyObjects server-side applies the given objects to the cluster. The objects are copied first, as they are
+// shared between clusters.
+func (r *KubewardenAddonReconciler) applyObjects(ctx context.Context, k8sClient client.Client, objs []client.Object) error {
+	for _, obj := range objs {
+		if err := applyObject(ctx, k8sClient, obj.DeepCopyObject().(client.Object)); err != nil {
+			return fmt.Errorf("failed to apply resource: %w", err)
+		}
 	}
 
 	return nil
 }
 
-// applyControlPlaneTolerations patches Kubewarden deployments and PolicyServer
-// to tolerate control-plane taint for single-node clusters
-func (r *KubewardenAddonReconciler) applyControlPlaneTolerations(ctx context.Context, remoteClient client.Client) error {
-	log := log.FromContext(ctx)
+// correctObjectsDrift re-applies the given objects that drifted from their desired state in the cluster and
+// returns how many of them drifted
+func (r *KubewardenAddonReconciler) correctObjectsDrift(ctx context.Context, k8sClient client.Client, objs []client.Object) (int, error) {
+	drifted := 0
+	for _, desired := range objs {
+		obj := desired.DeepCopyObject().(client.Object)
+		hasDrifted, err := hasObjectDrifted(ctx, k8sClient, obj)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check resource drift: %w", err)
+		}
+		if !hasDrifted {
+			continue
+		}
 
-	// Patch kubewarden-controller deployment with proper JSON
-	patchController := `{
-  "spec": {
-    "template": {
-      "spec": {
-        "tolerations": [
-          {
-            "key": "node-role.kubernetes.io/control-plane",
-            "operator": "Exists",
-            "effect": "NoSchedule"
-          }
-        ]
-      }
-    }
-  }
-}`
-
-	log.Info("Patching kubewarden-controller deployment")
-	if err := remoteClient.Patch(ctx,
-		&appsv1.Deployment{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      kubewardenHelmReleaseName + "-kubewarden-controller",
-				Namespace: kubewardenNamespace,
-			},
-		},
-		client.RawPatch(types.StrategicMergePatchType, []byte(patchController)),
-	); err != nil {
-		return fmt.Errorf("patch kubewarden-controller deployment: %w", err)
-	}
-
-	// Patch PolicyServer CRD with proper JSON
-	patchPolicyServer := `{
-  "spec": {
-    "tolerations": [
-      {
-        "key": "node-role.kubernetes.io/control-plane",
-        "operator": "Exists",
-        "effect": "NoSchedule"
-      }
-    ]
-  }
-}`
-
-	log.Info("Patching PolicyServer default")
-	if err := remoteClient.Patch(ctx,
-		&unstructured.Unstructured{
-			Object: map[string]interface{}{
-				"apiVersion": "policies.kubewarden.io/v1",
-				"kind":       "PolicyServer",
-				"metadata": map[string]interface{}{
-					"name":      kubewardenHelmDefaultPolicyServerName,
-					"namespace": kubewardenNamespace,
-				},
-			},
-		},
-		client.RawPatch(types.MergePatchType, []byte(patchPolicyServer)),
-	); err != nil {
-		return fmt.Errorf("patch PolicyServer: %w", err)
-	}
-
-	// Patch audit-scanner CronJob
-	patchAuditScanner := `{
-  "spec": {
-    "jobTemplate": {
-      "spec": {
-        "template": {
-          "spec": {
-            "tolerations": [
-              {
-                "key": "node-role.kubernetes.io/control-plane",
-                "operator": "Exists",
-                "effect": "NoSchedule"
-              }
-            ]
-          }
-        }
-      }
-    }
-  }
-}`
-
-	log.Info("Patching audit-scanner CronJob")
-	if err := remoteClient.Patch(ctx,
-		&unstructured.Unstructured{
-			Object: map[string]interface{}{
-				"apiVersion": "batch/v1",
-				"kind":       "CronJob",
-				"metadata": map[string]interface{}{
-					"name":      "audit-scanner",
-					"namespace": kubewardenNamespace,
-				},
-			},
-		},
-		client.RawPatch(types.StrategicMergePatchType, []byte(patchAuditScanner)),
-	); err != nil {
-		// audit-scanner is optional, don't fail if it doesn't exist
-		log.Info("Could not patch audit-scanner CronJob (might not exist)", "error", err)
+		drifted++
+		if err := applyObject(ctx, k8sClient, desired.DeepCopyObject().(client.Object)); err != nil {
+			return 0, fmt.Errorf("failed to apply resource: %w", err)
+		}
+	}
+
+	return drifted, nil
+}
+
+// deleteObjects deletes the given objects from the cluster, in reverse order
+func (r *KubewardenAddonReconciler) deleteObjects(ctx context.Context, k8sClient client.Client, objs []client.Object) error {
+	for i := len(objs) - 1; i >= 0; i-- {
+		obj := objs[i].DeepCopyObject().(client.Object)
+		err := k8sClient.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			return fmt.Errorf("failed to delete resource: %w", err)
+		}
 	}
 
 	return nil
 }
 
-// applyManifest applies a single YAML manifest to the cluster
-func (r *KubewardenAddonReconciler) applyManifest(ctx context.Context, k8sClient client.Client, filePath string) error {
+// decodeManifest decodes all the objects of a single YAML manifest
+func (r *KubewardenAddonReconciler) decodeManifest(filePath string) ([]client.Object, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer func() {
 		if err := file.Close(); err != nil {
@@ -489,7 +1550,13 @@ func (r *KubewardenAddonReconciler) applyManifest(ctx context.Context, k8sClient
 		}
 	}()
 
-	decoder := yaml.NewYAMLOrJSONDecoder(file, 1024)
+	return decodeObjects(file)
+}
+
+// decodeObjects decodes the YAML or JSON manifests read from the reader.
+func decodeObjects(reader io.Reader) ([]client.Object, error) {
+	objs := []client.Object{}
+	decoder := yaml.NewYAMLOrJSONDecoder(reader, 1024)
 	for {
 		// use unknown to be able to decode any k8s object
 		unk := &runtime.Unknown{}
@@ -498,30 +1565,22 @@ func (r *KubewardenAddonReconciler) applyManifest(ctx context.Context, k8sClient
 			if err == io.EOF {
 				break
 			}
-			return fmt.Errorf("failed to decode manifest: %w", err)
+			return nil, fmt.Errorf("failed to decode manifest: %w", err)
 		}
 
-		// decode into a runtime.Object using the controller's scheme
-		codecFactory := serializer.NewCodecFactory(r.Scheme)
-		runtimeObject, kind, err := codecFactory.UniversalDeserializer().Decode(unk.Raw, nil, nil)
-		if kind == nil {
-			// this is an invalid object, skip it
-			break
+		// skip empty documents
+		raw := bytes.TrimSpace(unk.Raw)
+		if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+			continue
 		}
-		if err != nil {
-			return fmt.Errorf("failed to decode runtime object: %w", err)
-		}
-		obj, ok := runtimeObject.(client.Object)
-		if !ok {
-			return fmt.Errorf("failed to cast runtime object to client.Object")
-		}
-		// only create objects if they don't exist in the cluster already
-		if err := k8sClient.Create(ctx, obj); err != nil {
-			if !apierrors.IsAlreadyExists(err) {
-				return fmt.Errorf("failed to apply resource: %w", err)
-			}
+
+		// objects are kept unstructured so they are applied exactly as rendered
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(raw); err != nil {
+			return nil, fmt.Errorf("failed to decode object: %w", err)
 		}
+		objs = append(objs, obj)
 	}
 
-	return nil
+	return objs, nil
 }
@@ -20,6 +20,8 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	policiesv1 "github.com/kubewarden/kubewarden-controller/api/policies/v1"
 	. "github.com/onsi/ginkgo/v2"
@@ -28,12 +30,16 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/controllers/remote"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/secret"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/yaml"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -135,6 +141,13 @@ var _ = Describe("KubewardenAddon Controller", func() {
 				RemoteClientGetter: remote.NewClusterClient,
 			}
 
+			By("Removing the policy server Deployment left by previous tests")
+			policyServerDeployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+				Name:      "policy-server-" + kubewardenHelmDefaultPolicyServerName,
+				Namespace: kubewardenNamespace,
+			}}
+			Expect(client.IgnoreNotFound(workloadClient.Delete(ctx, policyServerDeployment))).To(Succeed())
+
 			By("Reconciling the created resource")
 			Eventually(func(g Gomega) {
 				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
@@ -142,6 +155,30 @@ var _ = Describe("KubewardenAddon Controller", func() {
 				})
 				g.Expect(err).NotTo(HaveOccurred())
 
+				By("Cluster should not be installed until the Kubewarden components are healthy")
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+				g.Expect(cluster.GetAnnotations()).NotTo(HaveKey(KubewardenHashAnnotation))
+				addon := &addonv1alpha1.KubewardenAddon{}
+				g.Expect(k8sClient.Get(ctx, typeNamespacedName, addon)).To(Succeed())
+				g.Expect(addon.Status.Clusters).To(ContainElement(And(
+					HaveField("ClusterName", cluster.Name),
+					HaveField("Phase", addonv1alpha1.ClusterInstallationInstalling),
+					HaveField("Conditions", ContainElement(And(
+						HaveField("Type", clusterv1.ReadyCondition),
+						HaveField("Status", corev1.ConditionFalse),
+						HaveField("Reason", addonv1alpha1.KubewardenComponentsNotReadyReason),
+					))),
+				)))
+			}).Should(Succeed())
+
+			By("Marking the Kubewarden components healthy")
+			Eventually(func(g Gomega) {
+				markKubewardenHealthy(g, workloadClient)
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+
 				By("Kubewarden namespace should exist in workload cluster")
 				kubewardenNs := &corev1.Namespace{}
 				g.Expect(workloadClient.Get(ctx, client.ObjectKey{Name: kubewardenNamespace}, kubewardenNs)).To(Succeed())
@@ -172,11 +209,52 @@ var _ = Describe("KubewardenAddon Controller", func() {
 				g.Expect(err).ToNot(HaveOccurred(), fmt.Sprintf("%s policy server should exist", kubewardenHelmDefaultPolicyServerName))
 				g.Expect(policyServer.GetName()).To(Equal(kubewardenHelmDefaultPolicyServerName))
 
-				By("Cluster should have installed annotation")
+				By("Cluster should have the hash annotation")
 				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
 				annotations := cluster.GetAnnotations()
-				_, ok := annotations[KubewardenInstalledAnnotation]
-				g.Expect(ok).To(BeTrue())
+				g.Expect(annotations).To(HaveKey(KubewardenHashAnnotation))
+				g.Expect(annotations).NotTo(HaveKey(KubewardenInstalledAnnotation))
+
+				By("Addon status should report the cluster installation")
+				addon := &addonv1alpha1.KubewardenAddon{}
+				g.Expect(k8sClient.Get(ctx, typeNamespacedName, addon)).To(Succeed())
+				g.Expect(addon.Status.Clusters).To(ContainElement(And(
+					HaveField("ClusterName", cluster.Name),
+					HaveField("Phase", addonv1alpha1.ClusterInstallationReady),
+					HaveField("InstalledVersion", annotations[KubewardenVersionAnnotation]),
+					HaveField("AppliedHash", annotations[KubewardenHashAnnotation]),
+					HaveField("LastTransitionTime", Not(BeNil())),
+					HaveField("Conditions", ContainElement(And(
+						HaveField("Type", clusterv1.ReadyCondition),
+						HaveField("Status", corev1.ConditionTrue),
+					))),
+				)))
+				g.Expect(addon.Status.ReadyClusters).To(BeNumerically(">=", 1))
+				g.Expect(addon.Status.FailedClusters).To(BeZero())
+
+				By("Addon conditions should report the addon as ready")
+				g.Expect(conditions.IsTrue(addon, addonv1alpha1.KubewardenAddonSpecsUpToDateCondition)).To(BeTrue())
+				g.Expect(conditions.IsTrue(addon, addonv1alpha1.KubewardenAddonsReadyCondition)).To(BeTrue())
+				g.Expect(conditions.IsTrue(addon, clusterv1.ReadyCondition)).To(BeTrue())
+			}).Should(Succeed())
+
+			By("Replacing the installed annotation of clusters installed by previous releases")
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+			hash := cluster.GetAnnotations()[KubewardenHashAnnotation]
+			clusterCopy := cluster.DeepCopy()
+			delete(cluster.Annotations, KubewardenHashAnnotation)
+			cluster.Annotations[KubewardenInstalledAnnotation] = "true"
+			Expect(k8sClient.Patch(ctx, cluster, client.MergeFrom(clusterCopy))).To(Succeed())
+
+			Eventually(func(g Gomega) {
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+				g.Expect(cluster.GetAnnotations()).To(HaveKeyWithValue(KubewardenHashAnnotation, hash))
+				g.Expect(cluster.GetAnnotations()).NotTo(HaveKey(KubewardenInstalledAnnotation))
 			}).Should(Succeed())
 		})
 
@@ -337,5 +415,720 @@ var _ = Describe("KubewardenAddon Controller", func() {
 			Expect(clusterNames).To(ContainElement("test-cluster-1"))
 			Expect(clusterNames).To(ContainElement("test-cluster-2"))
 		})
+
+		It("should correct drifted Kubewarden resources in workload clusters", func() {
+			By("Create CAPI Cluster & get remote client")
+			cluster := capiCluster.DeepCopy()
+			Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+			cluster.Status.ControlPlaneReady = true
+			Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+
+			Expect(k8sClient.Create(ctx, capiKubeconfigSecret)).To(Succeed())
+
+			workloadClient, err := remote.NewClusterClient(ctx, cluster.Name, k8sClient, client.ObjectKeyFromObject(cluster))
+			Expect(err).NotTo(HaveOccurred())
+
+			controllerReconciler := &KubewardenAddonReconciler{
+				Client:             k8sClient,
+				Scheme:             k8sClient.Scheme(),
+				RemoteClientGetter: remote.NewClusterClient,
+			}
+
+			By("Installing Kubewarden")
+			Eventually(func(g Gomega) {
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+				markKubewardenHealthy(g, workloadClient)
+
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+				g.Expect(cluster.GetAnnotations()).To(HaveKey(KubewardenHashAnnotation))
+			}).Should(Succeed())
+
+			By("Changing the kubewarden-controller deployment by hand")
+			deploymentKey := client.ObjectKey{Name: fmt.Sprintf("%s-kubewarden-controller", kubewardenHelmReleaseName), Namespace: kubewardenNamespace}
+			deployment := &appsv1.Deployment{}
+			Expect(workloadClient.Get(ctx, deploymentKey, deployment)).To(Succeed())
+			expectedLabels := deployment.GetLabels()
+			deploymentCopy := deployment.DeepCopy()
+			deployment.Labels["app.kubernetes.io/name"] = "tampered"
+			Expect(workloadClient.Patch(ctx, deployment, client.MergeFrom(deploymentCopy))).To(Succeed())
+
+			By("Reconciling the addon again")
+			Eventually(func(g Gomega) {
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+
+				By("Deployment should be restored")
+				g.Expect(workloadClient.Get(ctx, deploymentKey, deployment)).To(Succeed())
+				g.Expect(deployment.GetLabels()).To(HaveKeyWithValue("app.kubernetes.io/name", expectedLabels["app.kubernetes.io/name"]))
+
+				By("Addon status should report the drift")
+				addon := &addonv1alpha1.KubewardenAddon{}
+				g.Expect(k8sClient.Get(ctx, typeNamespacedName, addon)).To(Succeed())
+				g.Expect(addon.Status.Clusters).To(ContainElement(And(
+					HaveField("ClusterName", cluster.Name),
+					HaveField("LastDriftTime", Not(BeNil())),
+				)))
+			}).Should(Succeed())
+		})
+
+		It("should only update the version annotation once the upgraded Deployments are available", func() {
+			By("Create CAPI Cluster & get remote client")
+			cluster := capiCluster.DeepCopy()
+			Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+			cluster.Status.ControlPlaneReady = true
+			Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+
+			Expect(k8sClient.Create(ctx, capiKubeconfigSecret)).To(Succeed())
+
+			workloadClient, err := remote.NewClusterClient(ctx, cluster.Name, k8sClient, client.ObjectKeyFromObject(cluster))
+			Expect(err).NotTo(HaveOccurred())
+
+			controllerReconciler := &KubewardenAddonReconciler{
+				Client:             k8sClient,
+				Scheme:             k8sClient.Scheme(),
+				RemoteClientGetter: remote.NewClusterClient,
+			}
+
+			By("Installing Kubewarden")
+			Eventually(func(g Gomega) {
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+				markKubewardenHealthy(g, workloadClient)
+
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+				g.Expect(cluster.GetAnnotations()).To(HaveKey(KubewardenHashAnnotation))
+			}).Should(Succeed())
+			version := cluster.GetAnnotations()[KubewardenVersionAnnotation]
+
+			By("Making the Deployments unavailable, as they are while the new version rolls out")
+			deployments := &appsv1.DeploymentList{}
+			Expect(workloadClient.List(ctx, deployments, client.InNamespace(kubewardenNamespace))).To(Succeed())
+			for i := range deployments.Items {
+				deployment := &deployments.Items[i]
+				deployment.Status.AvailableReplicas = 0
+				deployment.Status.ReadyReplicas = 0
+				Expect(workloadClient.Status().Update(ctx, deployment)).To(Succeed())
+			}
+
+			By("Recording an older version on the cluster")
+			clusterCopy := cluster.DeepCopy()
+			cluster.Annotations[KubewardenVersionAnnotation] = "v0.0.1"
+			Expect(k8sClient.Patch(ctx, cluster, client.MergeFrom(clusterCopy))).To(Succeed())
+
+			By("Keeping the older version while the Deployments are not available")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+			Expect(cluster.GetAnnotations()).To(HaveKeyWithValue(KubewardenVersionAnnotation, "v0.0.1"))
+			addon := &addonv1alpha1.KubewardenAddon{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, addon)).To(Succeed())
+			Expect(addon.Status.Clusters).To(ContainElement(And(
+				HaveField("ClusterName", cluster.Name),
+				HaveField("Phase", addonv1alpha1.ClusterInstallationUpgrading),
+				HaveField("InstalledVersion", "v0.0.1"),
+			)))
+
+			By("Updating the version once the Deployments are available again")
+			Eventually(func(g Gomega) {
+				markKubewardenHealthy(g, workloadClient)
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+				g.Expect(cluster.GetAnnotations()).To(HaveKeyWithValue(KubewardenVersionAnnotation, version))
+			}).Should(Succeed())
+		})
+
+		It("should keep installing Kubewarden on the other clusters when one cluster fails", func() {
+			By("Create a healthy and a broken CAPI Cluster")
+			cluster := capiCluster.DeepCopy()
+			Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+			cluster.Status.ControlPlaneReady = true
+			Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+			Expect(k8sClient.Create(ctx, capiKubeconfigSecret)).To(Succeed())
+
+			workloadClient, err := remote.NewClusterClient(ctx, cluster.Name, k8sClient, client.ObjectKeyFromObject(cluster))
+			Expect(err).NotTo(HaveOccurred())
+
+			// the broken cluster has no kubeconfig secret, so it cannot be reached
+			brokenCluster := &clusterv1.Cluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "broken-cluster",
+					Namespace: "default",
+				},
+			}
+			Expect(k8sClient.Create(ctx, brokenCluster)).To(Succeed())
+			brokenCluster.Status.ControlPlaneReady = true
+			Expect(k8sClient.Status().Update(ctx, brokenCluster)).To(Succeed())
+
+			controllerReconciler := &KubewardenAddonReconciler{
+				Client:             k8sClient,
+				Scheme:             k8sClient.Scheme(),
+				RemoteClientGetter: remote.NewClusterClient,
+			}
+
+			By("Reconciling the addon")
+			Eventually(func(g Gomega) {
+				result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+				markKubewardenHealthy(g, workloadClient)
+				g.Expect(result.RequeueAfter).To(Equal(failureRequeueDuration))
+
+				By("The healthy cluster should have Kubewarden installed")
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+				g.Expect(cluster.GetAnnotations()).To(HaveKey(KubewardenHashAnnotation))
+
+				By("The broken cluster should be reported as failed")
+				addon := &addonv1alpha1.KubewardenAddon{}
+				g.Expect(k8sClient.Get(ctx, typeNamespacedName, addon)).To(Succeed())
+				g.Expect(addon.Status.Clusters).To(ContainElement(And(
+					HaveField("ClusterName", brokenCluster.Name),
+					HaveField("Phase", addonv1alpha1.ClusterInstallationFailed),
+					HaveField("LastError", Not(BeEmpty())),
+				)))
+				g.Expect(addon.Status.FailedClusters).To(BeEquivalentTo(1))
+				g.Expect(addon.Status.Ready).To(BeFalse())
+				g.Expect(conditions.GetReason(addon, addonv1alpha1.KubewardenAddonsReadyCondition)).To(Equal(addonv1alpha1.KubewardenAddonCreationFailedReason))
+				g.Expect(conditions.GetMessage(addon, addonv1alpha1.KubewardenAddonsReadyCondition)).To(ContainSubstring(brokenCluster.Name))
+			}).Should(Succeed())
+		})
+
+		It("should uninstall Kubewarden from clusters that are no longer selected", func() {
+			By("Create CAPI Cluster & get remote client")
+			cluster := capiCluster.DeepCopy()
+			Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+			cluster.Status.ControlPlaneReady = true
+			Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+
+			Expect(k8sClient.Create(ctx, capiKubeconfigSecret)).To(Succeed())
+
+			workloadClient, err := remote.NewClusterClient(ctx, cluster.Name, k8sClient, client.ObjectKeyFromObject(cluster))
+			Expect(err).NotTo(HaveOccurred())
+
+			controllerReconciler := &KubewardenAddonReconciler{
+				Client:             k8sClient,
+				Scheme:             k8sClient.Scheme(),
+				RemoteClientGetter: remote.NewClusterClient,
+			}
+
+			By("Installing Kubewarden")
+			Eventually(func(g Gomega) {
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+				markKubewardenHealthy(g, workloadClient)
+
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+				g.Expect(cluster.GetAnnotations()).To(HaveKeyWithValue(KubewardenAddonAnnotation, resourceName))
+			}).Should(Succeed())
+
+			By("Changing the cluster selector so the cluster is no longer selected")
+			addon := &addonv1alpha1.KubewardenAddon{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, addon)).To(Succeed())
+			Expect(addon.Spec.DeselectionPolicy).To(Equal(addonv1alpha1.DeselectionPolicyDelete))
+			addonCopy := addon.DeepCopy()
+			addon.Spec.ClusterSelector = metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}
+			Expect(k8sClient.Patch(ctx, addon, client.MergeFrom(addonCopy))).To(Succeed())
+
+			Eventually(func(g Gomega) {
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+
+				By("Kubewarden controller should be removed from workload cluster")
+				deployment := &appsv1.Deployment{}
+				err := workloadClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-kubewarden-controller", kubewardenHelmReleaseName), Namespace: kubewardenNamespace}, deployment)
+				g.Expect(errors.IsNotFound(err)).To(BeTrue())
+
+				By("Cluster should not have the Kubewarden annotations")
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+				g.Expect(cluster.GetAnnotations()).NotTo(HaveKey(KubewardenHashAnnotation))
+				g.Expect(cluster.GetAnnotations()).NotTo(HaveKey(KubewardenAddonAnnotation))
+
+				By("Addon status should no longer report the cluster")
+				g.Expect(k8sClient.Get(ctx, typeNamespacedName, addon)).To(Succeed())
+				g.Expect(addon.Status.Clusters).To(BeEmpty())
+			}).Should(Succeed())
+
+			By("Deleting the addon")
+			Expect(k8sClient.Delete(ctx, addon)).To(Succeed())
+			Eventually(func(g Gomega) {
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+
+				err = k8sClient.Get(ctx, typeNamespacedName, &addonv1alpha1.KubewardenAddon{})
+				g.Expect(errors.IsNotFound(err)).To(BeTrue())
+			}).Should(Succeed())
+		})
+
+		It("should uninstall Kubewarden from the selected clusters when the addon is deleted", func() {
+			By("Create CAPI Cluster & get remote client")
+			cluster := capiCluster.DeepCopy()
+			Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+			cluster.Status.ControlPlaneReady = true
+			Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+
+			Expect(k8sClient.Create(ctx, capiKubeconfigSecret)).To(Succeed())
+
+			workloadClient, err := remote.NewClusterClient(ctx, cluster.Name, k8sClient, client.ObjectKeyFromObject(cluster))
+			Expect(err).NotTo(HaveOccurred())
+
+			controllerReconciler := &KubewardenAddonReconciler{
+				Client:             k8sClient,
+				Scheme:             k8sClient.Scheme(),
+				RemoteClientGetter: remote.NewClusterClient,
+			}
+
+			By("Installing Kubewarden")
+			Eventually(func(g Gomega) {
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+				markKubewardenHealthy(g, workloadClient)
+
+				addon := &addonv1alpha1.KubewardenAddon{}
+				g.Expect(k8sClient.Get(ctx, typeNamespacedName, addon)).To(Succeed())
+				g.Expect(addon.GetFinalizers()).To(ContainElement(addonv1alpha1.KubewardenAddonFinalizer))
+
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+				g.Expect(cluster.GetAnnotations()).To(HaveKey(KubewardenHashAnnotation))
+			}).Should(Succeed())
+
+			By("Deleting the addon")
+			addon := &addonv1alpha1.KubewardenAddon{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, addon)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, addon)).To(Succeed())
+
+			Eventually(func(g Gomega) {
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+
+				By("Kubewarden controller should be removed from workload cluster")
+				deployment := &appsv1.Deployment{}
+				err := workloadClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-kubewarden-controller", kubewardenHelmReleaseName), Namespace: kubewardenNamespace}, deployment)
+				g.Expect(errors.IsNotFound(err)).To(BeTrue())
+
+				By("Cluster should not have installed annotation")
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+				g.Expect(cluster.GetAnnotations()).NotTo(HaveKey(KubewardenHashAnnotation))
+
+				By("Addon should be gone")
+				err = k8sClient.Get(ctx, typeNamespacedName, &addonv1alpha1.KubewardenAddon{})
+				g.Expect(errors.IsNotFound(err)).To(BeTrue())
+			}).Should(Succeed())
+		})
+
+		It("should not uninstall Kubewarden installed by another addon when the addon is deleted", func() {
+			By("Create CAPI Cluster & get remote client")
+			cluster := capiCluster.DeepCopy()
+			Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+			cluster.Status.ControlPlaneReady = true
+			Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+
+			Expect(k8sClient.Create(ctx, capiKubeconfigSecret)).To(Succeed())
+
+			workloadClient, err := remote.NewClusterClient(ctx, cluster.Name, k8sClient, client.ObjectKeyFromObject(cluster))
+			Expect(err).NotTo(HaveOccurred())
+
+			controllerReconciler := &KubewardenAddonReconciler{
+				Client:             k8sClient,
+				Scheme:             k8sClient.Scheme(),
+				RemoteClientGetter: remote.NewClusterClient,
+			}
+
+			By("Installing Kubewarden")
+			Eventually(func(g Gomega) {
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: typeNamespacedName,
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+				markKubewardenHealthy(g, workloadClient)
+
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+				g.Expect(cluster.GetAnnotations()).To(HaveKey(KubewardenHashAnnotation))
+				g.Expect(cluster.GetAnnotations()).To(HaveKeyWithValue(KubewardenAddonAnnotation, resourceName))
+			}).Should(Succeed())
+
+			By("Creating another addon selecting the same cluster")
+			otherAddon := &addonv1alpha1.KubewardenAddon{ObjectMeta: metav1.ObjectMeta{Name: "other-addon", Namespace: "default"}}
+			Expect(k8sClient.Create(ctx, otherAddon)).To(Succeed())
+			Eventually(func(g Gomega) {
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: client.ObjectKeyFromObject(otherAddon),
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+
+				g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(otherAddon), otherAddon)).To(Succeed())
+				g.Expect(otherAddon.GetFinalizers()).To(ContainElement(addonv1alpha1.KubewardenAddonFinalizer))
+				g.Expect(otherAddon.Status.MatchingClusters).To(ContainElement(HaveField("Name", cluster.Name)))
+			}).Should(Succeed())
+
+			By("Deleting the other addon")
+			Expect(k8sClient.Delete(ctx, otherAddon)).To(Succeed())
+			Eventually(func(g Gomega) {
+				_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+					NamespacedName: client.ObjectKeyFromObject(otherAddon),
+				})
+				g.Expect(err).NotTo(HaveOccurred())
+
+				err = k8sClient.Get(ctx, client.ObjectKeyFromObject(otherAddon), &addonv1alpha1.KubewardenAddon{})
+				g.Expect(errors.IsNotFound(err)).To(BeTrue())
+			}).Should(Succeed())
+
+			By("Kubewarden should still be installed by the first addon")
+			deployment := &appsv1.Deployment{}
+			Expect(workloadClient.Get(ctx, client.ObjectKey{Name: fmt.Sprintf("%s-kubewarden-controller", kubewardenHelmReleaseName), Namespace: kubewardenNamespace}, deployment)).To(Succeed())
+			Expect(deployment.DeletionTimestamp.IsZero()).To(BeTrue())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+			Expect(cluster.GetAnnotations()).To(HaveKey(KubewardenHashAnnotation))
+			Expect(cluster.GetAnnotations()).To(HaveKeyWithValue(KubewardenAddonAnnotation, resourceName))
+		})
+	})
+})
+
+var _ = Describe("KubewardenAddon deselected clusters", func() {
+	It("should only return the deselected clusters the addon installed Kubewarden to or labelled", func() {
+		addon := &addonv1alpha1.KubewardenAddon{ObjectMeta: metav1.ObjectMeta{Name: "addon"}}
+		newCluster := func(name, installedBy string) clusterv1.Cluster {
+			cluster := clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: name}}
+			if installedBy != "" {
+				cluster.Annotations = map[string]string{
+					KubewardenInstalledAnnotation: "true",
+					KubewardenAddonAnnotation:     installedBy,
+				}
+			}
+
+			return cluster
+		}
+
+		selected := newCluster("selected", "addon")
+		deselected := newCluster("deselected", "addon")
+		// selected for the ClusterResourceSet of the addon, not installed yet
+		labelled := newCluster("labelled", "")
+		labelled.Labels = map[string]string{KubewardenAddonLabel: "addon"}
+		allClusters := []clusterv1.Cluster{
+			selected,
+			deselected,
+			labelled,
+			newCluster("other-addon", "other"),
+			newCluster("not-installed", ""),
+		}
+
+		Expect(deselectedClusters(addon, allClusters, []clusterv1.Cluster{selected})).To(ConsistOf(
+			HaveField("Name", deselected.Name),
+			HaveField("Name", labelled.Name),
+		))
+	})
+})
+
+var _ = Describe("KubewardenAddon cluster workers", func() {
+	It("should bound the number of clusters reconciled in parallel", func() {
+		Expect((&KubewardenAddonReconciler{}).maxConcurrentClusterReconciles()).To(Equal(DefaultMaxConcurrentClusterReconciles))
+		Expect((&KubewardenAddonReconciler{MaxConcurrentClusterReconciles: 3}).maxConcurrentClusterReconciles()).To(Equal(3))
+	})
+
+	It("should not reconcile more clusters in parallel than the limit", func() {
+		const namespace = "cluster-workers"
+		Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})).To(Succeed())
+
+		clusters := []*clusterv1.Cluster{}
+		for n := range 5 {
+			cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("worker-cluster-%d", n), Namespace: namespace}}
+			Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+			cluster.Status.ControlPlaneReady = true
+			Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+			clusters = append(clusters, cluster)
+		}
+		addon := &addonv1alpha1.KubewardenAddon{ObjectMeta: metav1.ObjectMeta{Name: "workers", Namespace: namespace}}
+		Expect(k8sClient.Create(ctx, addon)).To(Succeed())
+		DeferCleanup(func() {
+			for _, cluster := range clusters {
+				Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, cluster))).To(Succeed())
+			}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, addon))).To(Succeed())
+		})
+
+		// the remote client getter blocks for a while, so the clusters being reconciled pile up
+		var calls, active, maxActive atomic.Int32
+		controllerReconciler := &KubewardenAddonReconciler{
+			Client:                         k8sClient,
+			Scheme:                         k8sClient.Scheme(),
+			MaxConcurrentClusterReconciles: 2,
+			RemoteClientGetter: func(context.Context, string, client.Client, client.ObjectKey) (client.Client, error) {
+				calls.Add(1)
+				current := active.Add(1)
+				defer active.Add(-1)
+				for {
+					previous := maxActive.Load()
+					if current <= previous || maxActive.CompareAndSwap(previous, current) {
+						break
+					}
+				}
+				time.Sleep(200 * time.Millisecond)
+
+				return nil, fmt.Errorf("cluster unreachable")
+			},
+		}
+
+		_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(addon)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls.Load()).To(BeEquivalentTo(len(clusters)))
+		Expect(maxActive.Load()).To(BeNumerically("<=", 2))
+	})
+
+	It("should publish the phase of the clusters while they are reconciled", func() {
+		const namespace = "cluster-phases"
+		Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})).To(Succeed())
+
+		cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "installing-cluster", Namespace: namespace}}
+		Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+		cluster.Status.ControlPlaneReady = true
+		Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+		addon := &addonv1alpha1.KubewardenAddon{ObjectMeta: metav1.ObjectMeta{Name: "phases", Namespace: namespace}}
+		Expect(k8sClient.Create(ctx, addon)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, cluster))).To(Succeed())
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, addon))).To(Succeed())
+		})
+
+		// the remote client getter is called while Kubewarden is being installed, it reads the phase of the cluster
+		// as published in the addon status at that time
+		var phase addonv1alpha1.ClusterInstallationPhase
+		controllerReconciler := &KubewardenAddonReconciler{
+			Client: k8sClient,
+			Scheme: k8sClient.Scheme(),
+			RemoteClientGetter: func(context.Context, string, client.Client, client.ObjectKey) (client.Client, error) {
+				published := &addonv1alpha1.KubewardenAddon{}
+				if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(addon), published); err != nil {
+					return nil, err
+				}
+				phase = clusterInstallationStatus(published, cluster).Phase
+
+				return nil, fmt.Errorf("cluster unreachable")
+			},
+		}
+
+		Eventually(func(g Gomega) {
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(addon)})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(phase).To(Equal(addonv1alpha1.ClusterInstallationInstalling))
+
+			By("Reporting the outcome of the reconcile once it ends")
+			g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(addon), addon)).To(Succeed())
+			g.Expect(addon.Status.Clusters).To(ConsistOf(And(
+				HaveField("ClusterName", cluster.Name),
+				HaveField("Phase", addonv1alpha1.ClusterInstallationFailed),
+			)))
+		}).Should(Succeed())
+	})
+
+	It("should requeue after the shortest interval", func() {
+		Expect(shortestRequeue(0, driftCheckInterval)).To(Equal(driftCheckInterval))
+		Expect(shortestRequeue(driftCheckInterval, failureRequeueDuration)).To(Equal(failureRequeueDuration))
+		Expect(shortestRequeue(failureRequeueDuration, 0)).To(Equal(failureRequeueDuration))
+	})
+})
+
+var _ = Describe("Kubewarden manifests hash", func() {
+	It("should only change with the manifests", func() {
+		newManifests := func(replicas int64) *kubewardenManifests {
+			deployment := &unstructured.Unstructured{Object: map[string]interface{}{}}
+			deployment.SetAPIVersion("apps/v1")
+			deployment.SetKind("Deployment")
+			deployment.SetName(kubewardenHelmReleaseName + "-kubewarden-controller")
+			deployment.SetNamespace(kubewardenNamespace)
+			Expect(unstructured.SetNestedField(deployment.Object, replicas, "spec", "replicas")).To(Succeed())
+
+			return &kubewardenManifests{Controller: []client.Object{deployment}}
+		}
+
+		hash, err := newManifests(1).hash()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).NotTo(BeEmpty())
+		Expect(newManifests(1).hash()).To(Equal(hash))
+		Expect(newManifests(2).hash()).NotTo(Equal(hash))
+	})
+})
+
+var _ = Describe("Kubewarden upgrade", func() {
+	It("should only upgrade the controller once the CRDs are established", func() {
+		crd := &unstructured.Unstructured{}
+		Expect(yaml.Unmarshal([]byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: upgrades.caapkw.test.io
+spec:
+  group: caapkw.test.io
+  names:
+    kind: Upgrade
+    listKind: UpgradeList
+    plural: upgrades
+    singular: upgrade
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        x-kubernetes-preserve-unknown-fields: true
+`), &crd.Object)).To(Succeed())
+		controller := &unstructured.Unstructured{}
+		controller.SetAPIVersion("v1")
+		controller.SetKind("ConfigMap")
+		controller.SetName("upgraded-controller")
+		controller.SetNamespace("default")
+		manifests := &kubewardenManifests{CRDs: []client.Object{crd}, Controller: []client.Object{controller}}
+		DeferCleanup(func() {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, crd))).To(Succeed())
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, controller))).To(Succeed())
+		})
+
+		// the API server establishes the CRDs right away, the client hides it to see the upgrade wait for it
+		workloadClient, err := client.NewWithWatch(cfg, client.Options{Scheme: k8sClient.Scheme()})
+		Expect(err).NotTo(HaveOccurred())
+		notEstablishedClient := interceptor.NewClient(workloadClient, interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				if err := c.Get(ctx, key, obj, opts...); err != nil {
+					return err
+				}
+				if crd, ok := obj.(*apiextensionsv1.CustomResourceDefinition); ok {
+					crd.Status.Conditions = nil
+				}
+
+				return nil
+			},
+		})
+
+		r := &KubewardenAddonReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		upgraded, err := r.upgradeKubewarden(ctx, notEstablishedClient, manifests)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upgraded).To(BeFalse())
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(controller), &corev1.ConfigMap{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+
+		Eventually(func(g Gomega) {
+			g.Expect(areCRDsEstablished(ctx, workloadClient, manifests.CRDs)).To(BeTrue())
+		}).Should(Succeed())
+		missing := crd.DeepCopy()
+		missing.SetName("missings.caapkw.test.io")
+		Expect(areCRDsEstablished(ctx, workloadClient, []client.Object{missing})).To(BeFalse())
+	})
+})
+
+var _ = Describe("Paused KubewardenAddon", func() {
+	// remoteClientGetter counts the calls, the workload clusters must not be reached while they are paused
+	remoteClientGetter := func(calls *atomic.Int32) remote.ClusterClientGetter {
+		return func(context.Context, string, client.Client, client.ObjectKey) (client.Client, error) {
+			calls.Add(1)
+
+			return nil, fmt.Errorf("cluster unreachable")
+		}
+	}
+
+	It("should leave the clusters untouched while the addon is paused", func() {
+		const namespace = "paused-addon"
+		Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})).To(Succeed())
+
+		cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "paused-addon-cluster", Namespace: namespace}}
+		Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+		cluster.Status.ControlPlaneReady = true
+		Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+		addon := &addonv1alpha1.KubewardenAddon{
+			ObjectMeta: metav1.ObjectMeta{Name: "paused", Namespace: namespace},
+			Spec:       addonv1alpha1.KubewardenAddonSpec{Paused: true},
+		}
+		Expect(k8sClient.Create(ctx, addon)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, cluster))).To(Succeed())
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, addon))).To(Succeed())
+		})
+
+		var calls atomic.Int32
+		controllerReconciler := &KubewardenAddonReconciler{
+			Client:             k8sClient,
+			Scheme:             k8sClient.Scheme(),
+			RemoteClientGetter: remoteClientGetter(&calls),
+		}
+		_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(addon)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls.Load()).To(BeZero())
+
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+		Expect(cluster.GetAnnotations()).NotTo(HaveKey(KubewardenHashAnnotation))
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(addon), addon)).To(Succeed())
+		Expect(addon.GetFinalizers()).To(BeEmpty())
+		Expect(addon.Status.Clusters).To(BeEmpty())
+		Expect(conditions.IsTrue(addon, addonv1alpha1.PausedCondition)).To(BeTrue())
+		Expect(conditions.GetReason(addon, addonv1alpha1.PausedCondition)).To(Equal(addonv1alpha1.PausedReason))
+	})
+
+	It("should skip paused clusters until they are resumed", func() {
+		const namespace = "paused-clusters"
+		Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})).To(Succeed())
+
+		cluster := &clusterv1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "paused-cluster", Namespace: namespace},
+			Spec:       clusterv1.ClusterSpec{Paused: true},
+		}
+		Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+		cluster.Status.ControlPlaneReady = true
+		Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+		addon := &addonv1alpha1.KubewardenAddon{ObjectMeta: metav1.ObjectMeta{Name: "paused-clusters", Namespace: namespace}}
+		Expect(k8sClient.Create(ctx, addon)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, cluster))).To(Succeed())
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, addon))).To(Succeed())
+		})
+
+		var calls atomic.Int32
+		controllerReconciler := &KubewardenAddonReconciler{
+			Client:             k8sClient,
+			Scheme:             k8sClient.Scheme(),
+			RemoteClientGetter: remoteClientGetter(&calls),
+		}
+		_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(addon)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls.Load()).To(BeZero())
+
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+		Expect(cluster.GetAnnotations()).NotTo(HaveKey(KubewardenHashAnnotation))
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(addon), addon)).To(Succeed())
+		Expect(addon.Status.Ready).To(BeFalse())
+		Expect(conditions.IsTrue(addon, addonv1alpha1.PausedCondition)).To(BeTrue())
+		Expect(conditions.GetReason(addon, addonv1alpha1.PausedCondition)).To(Equal(addonv1alpha1.ClustersPausedReason))
+		Expect(conditions.GetMessage(addon, addonv1alpha1.PausedCondition)).To(ContainSubstring(cluster.Name))
+
+		By("Resuming the cluster")
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+		cluster.Spec.Paused = false
+		Expect(k8sClient.Update(ctx, cluster)).To(Succeed())
+
+		_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(addon)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls.Load()).To(BeEquivalentTo(1))
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(addon), addon)).To(Succeed())
+		Expect(conditions.IsFalse(addon, addonv1alpha1.PausedCondition)).To(BeTrue())
 	})
 })
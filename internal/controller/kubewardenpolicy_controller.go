@@ -19,20 +19,24 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	policiesv1 "github.com/kubewarden/kubewarden-controller/api/policies/v1"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/controllers/remote"
 	"sigs.k8s.io/cluster-api/util/conditions"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/source"
@@ -92,11 +96,30 @@ func (r *KubewardenPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		return ctrl.Result{}, err
 	}
 
+	// A paused policy is left alone, deletion included, until it is resumed
+	if policy.Spec.Paused {
+		log.Info("Reconciliation is paused for this policy")
+		setPausedCondition(policy, true, nil)
+		if err := r.Client.Status().Update(ctx, policy); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
 	// Handle deletion
 	if !policy.DeletionTimestamp.IsZero() {
 		return r.reconcileDelete(ctx, policy)
 	}
 
+	// add the finalizer first so the policy can be removed from the clusters when it is deleted
+	if !controllerutil.ContainsFinalizer(policy, addonv1alpha1.KubewardenPolicyFinalizer) {
+		policyCopy := policy.DeepCopy()
+		controllerutil.AddFinalizer(policy, addonv1alpha1.KubewardenPolicyFinalizer)
+		if err := r.Client.Patch(ctx, policy, client.MergeFrom(policyCopy)); err != nil {
+			return ctrl.Result{}, fmt.Errorf("adding finalizer: %w", err)
+		}
+	}
+
 	return r.reconcileNormal(ctx, policy)
 }
 
@@ -112,6 +135,7 @@ func (r *KubewardenPolicyReconciler) reconcileNormal(ctx context.Context, policy
 
 	if len(clusters) == 0 {
 		log.Info("No matching clusters found for policy", "policy", policy.Name)
+		setPausedCondition(policy, false, nil)
 		policy.Status.Ready = false
 		policy.Status.DeployedPolicies = []addonv1alpha1.DeployedPolicyStatus{}
 		if err := r.Client.Status().Update(ctx, policy); err != nil {
@@ -124,11 +148,26 @@ func (r *KubewardenPolicyReconciler) reconcileNormal(ctx context.Context, policy
 	policy.SetMatchingClusters(clusters)
 
 	deployedPolicies := []addonv1alpha1.DeployedPolicyStatus{}
+	pausedClusters := []string{}
 	allReady := true
 
 	for _, cluster := range clusters {
 		log := log.WithValues("cluster", cluster.Name)
 
+		// Paused clusters are left untouched, they keep their last known status
+		if isClusterPaused(&cluster) {
+			log.Info("Cluster is paused, skipping")
+			pausedClusters = append(pausedClusters, cluster.Name)
+			previous := previousDeployedPolicyStatus(policy, &cluster)
+			if previous == nil || !previous.Active {
+				allReady = false
+			}
+			if previous != nil {
+				deployedPolicies = append(deployedPolicies, *previous)
+			}
+			continue
+		}
+
 		// Check if cluster is ready
 		if !cluster.Status.ControlPlaneReady || !conditions.IsTrue(&cluster, clusterv1.ControlPlaneReadyCondition) {
 			log.Info("Cluster control plane not ready, skipping")
@@ -137,7 +176,7 @@ func (r *KubewardenPolicyReconciler) reconcileNormal(ctx context.Context, policy
 		}
 
 		// Check if Kubewarden is installed on the cluster
-		if !HasAnnotation(&cluster, KubewardenInstalledAnnotation) {
+		if !isKubewardenInstalled(&cluster) {
 			log.Info("Kubewarden not installed on cluster, skipping policy deployment")
 			allReady = false
 			continue
@@ -166,6 +205,7 @@ func (r *KubewardenPolicyReconciler) reconcileNormal(ctx context.Context, policy
 	// Update status
 	policy.Status.Ready = allReady
 	policy.Status.DeployedPolicies = deployedPolicies
+	setPausedCondition(policy, false, pausedClusters)
 
 	if err := r.Client.Status().Update(ctx, policy); err != nil {
 		return ctrl.Result{}, err
@@ -178,6 +218,10 @@ func (r *KubewardenPolicyReconciler) reconcileDelete(ctx context.Context, policy
 	log := log.FromContext(ctx)
 	log.Info("Deleting KubewardenPolicy")
 
+	if !controllerutil.ContainsFinalizer(policy, addonv1alpha1.KubewardenPolicyFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
 	// Get matching clusters to clean up policies
 	clusters, err := r.getMatchingClusters(ctx, policy)
 	if err != nil {
@@ -185,24 +229,75 @@ func (r *KubewardenPolicyReconciler) reconcileDelete(ctx context.Context, policy
 		return ctrl.Result{}, err
 	}
 
+	pausedClusters := []string{}
+	errs := []error{}
 	for _, cluster := range clusters {
 		log := log.WithValues("cluster", cluster.Name)
 
+		// nothing to clean up on a cluster that is going away
+		if !cluster.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		// paused clusters hold the deletion of the policy until they are resumed
+		if isClusterPaused(&cluster) {
+			log.Info("Cluster is paused, waiting to delete the policy")
+			pausedClusters = append(pausedClusters, cluster.Name)
+			continue
+		}
+
 		remoteClient, err := r.RemoteClientGetter(ctx, cluster.Name, r.Client, client.ObjectKeyFromObject(&cluster))
 		if err != nil {
 			log.Error(err, "Failed to get remote cluster client during deletion")
+			errs = append(errs, fmt.Errorf("cluster %s: %w", cluster.Name, err))
 			continue
 		}
 
 		// Delete the policy from the workload cluster
 		if err := r.deletePolicy(ctx, remoteClient, policy); err != nil {
 			log.Error(err, "Failed to delete policy from workload cluster")
+			errs = append(errs, fmt.Errorf("cluster %s: %w", cluster.Name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return ctrl.Result{}, kerrors.NewAggregate(errs)
+	}
+
+	if len(pausedClusters) > 0 {
+		log.Info("Waiting for paused clusters to delete the policy", "clusters", pausedClusters)
+		setPausedCondition(policy, false, pausedClusters)
+		conditions.MarkFalse(policy, clusterv1.ReadyCondition, clusterv1.DeletingReason, clusterv1.ConditionSeverityInfo,
+			"Waiting for paused clusters to delete the policy: %s", strings.Join(pausedClusters, ", "))
+		if err := r.Client.Status().Update(ctx, policy); err != nil {
+			return ctrl.Result{}, err
 		}
+
+		return ctrl.Result{RequeueAfter: deletionRequeueDuration}, nil
+	}
+
+	// all clusters are clean, let the policy go
+	policyCopy := policy.DeepCopy()
+	controllerutil.RemoveFinalizer(policy, addonv1alpha1.KubewardenPolicyFinalizer)
+	if err := r.Client.Patch(ctx, policy, client.MergeFrom(policyCopy)); err != nil {
+		return ctrl.Result{}, fmt.Errorf("removing finalizer: %w", err)
 	}
 
 	return ctrl.Result{}, nil
 }
 
+// previousDeployedPolicyStatus returns the status of the policy on the cluster recorded by the last reconcile, if any.
+func previousDeployedPolicyStatus(policy *addonv1alpha1.KubewardenPolicy, cluster *clusterv1.Cluster) *addonv1alpha1.DeployedPolicyStatus {
+	for i := range policy.Status.DeployedPolicies {
+		status := &policy.Status.DeployedPolicies[i]
+		if status.ClusterName == cluster.Name && status.ClusterNamespace == cluster.Namespace {
+			return status
+		}
+	}
+
+	return nil
+}
+
 func (r *KubewardenPolicyReconciler) deployPolicy(
 	ctx context.Context,
 	remoteClient client.Client,
@@ -418,7 +513,8 @@ func (r *KubewardenPolicyReconciler) deletePolicy(
 		}
 		log.Info("Deleting ClusterAdmissionPolicy", "name", cap.Name)
 		err := remoteClient.Delete(ctx, cap)
-		if err != nil && !apierrors.IsNotFound(err) {
+		// the policy is gone along with the Kubewarden CRDs
+		if err != nil && !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
 			return err
 		}
 	} else {
@@ -430,7 +526,7 @@ func (r *KubewardenPolicyReconciler) deletePolicy(
 		}
 		log.Info("Deleting AdmissionPolicy", "name", ap.Name, "namespace", ap.Namespace)
 		err := remoteClient.Delete(ctx, ap)
-		if err != nil && !apierrors.IsNotFound(err) {
+		if err != nil && !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
 			return err
 		}
 	}
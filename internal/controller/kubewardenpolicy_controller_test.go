@@ -0,0 +1,182 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+var _ = Describe("Paused KubewardenPolicy", func() {
+	var calls atomic.Int32
+	var controllerReconciler *KubewardenPolicyReconciler
+
+	// newPolicy returns a policy selecting every cluster of the namespace.
+	newPolicy := func(namespace string) *addonv1alpha1.KubewardenPolicy {
+		return &addonv1alpha1.KubewardenPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-privileged", Namespace: namespace},
+			Spec: addonv1alpha1.KubewardenPolicySpec{
+				PolicyType: "ClusterAdmissionPolicy",
+				PolicyName: namespace + "-pod-privileged",
+				Module:     "registry://ghcr.io/kubewarden/policies/pod-privileged:v1.0.8",
+				Rules: []addonv1alpha1.PolicyRule{{
+					APIVersions: []string{"v1"},
+					Resources:   []string{"pods"},
+					Operations:  []string{"CREATE"},
+				}},
+			},
+		}
+	}
+
+	// newCluster creates a cluster with Kubewarden installed and its control plane ready.
+	newCluster := func(namespace string, paused bool) *clusterv1.Cluster {
+		cluster := &clusterv1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        namespace + "-cluster",
+				Namespace:   namespace,
+				Annotations: map[string]string{KubewardenInstalledAnnotation: "true"},
+			},
+			Spec: clusterv1.ClusterSpec{Paused: paused},
+		}
+		Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+		cluster.Status.ControlPlaneReady = true
+		conditions.MarkTrue(cluster, clusterv1.ControlPlaneReadyCondition)
+		Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, cluster))).To(Succeed())
+		})
+
+		return cluster
+	}
+
+	BeforeEach(func() {
+		calls.Store(0)
+		// the management cluster stands for the workload clusters, which must not be reached while they are paused
+		controllerReconciler = &KubewardenPolicyReconciler{
+			Client: k8sClient,
+			Scheme: k8sClient.Scheme(),
+			RemoteClientGetter: func(context.Context, string, client.Client, client.ObjectKey) (client.Client, error) {
+				calls.Add(1)
+
+				return k8sClient, nil
+			},
+		}
+	})
+
+	It("should leave the workload clusters untouched while the policy is paused", func() {
+		const namespace = "paused-policy"
+		Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})).To(Succeed())
+
+		newCluster(namespace, false)
+		policy := newPolicy(namespace)
+		policy.Spec.Paused = true
+		Expect(k8sClient.Create(ctx, policy)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, policy))).To(Succeed())
+		})
+
+		_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(policy)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls.Load()).To(BeZero())
+
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(policy), policy)).To(Succeed())
+		Expect(policy.GetFinalizers()).To(BeEmpty())
+		Expect(policy.Status.DeployedPolicies).To(BeEmpty())
+		Expect(conditions.IsTrue(policy, addonv1alpha1.PausedCondition)).To(BeTrue())
+		Expect(conditions.GetReason(policy, addonv1alpha1.PausedCondition)).To(Equal(addonv1alpha1.PausedReason))
+	})
+
+	It("should skip paused clusters and report them", func() {
+		const namespace = "paused-policy-clusters"
+		Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})).To(Succeed())
+
+		// clusters are also paused with the annotation, like during a clusterctl move
+		cluster := newCluster(namespace, false)
+		cluster.SetAnnotations(map[string]string{KubewardenInstalledAnnotation: "true", clusterv1.PausedAnnotation: ""})
+		Expect(k8sClient.Update(ctx, cluster)).To(Succeed())
+		policy := newPolicy(namespace)
+		Expect(k8sClient.Create(ctx, policy)).To(Succeed())
+		DeferCleanup(func() {
+			// the paused cluster would hold the deletion of the policy
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, cluster))).To(Succeed())
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, policy))).To(Succeed())
+			Eventually(func(g Gomega) {
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(policy)})
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(policy), policy))).To(BeTrue())
+			}).Should(Succeed())
+		})
+
+		_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(policy)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls.Load()).To(BeZero())
+
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(policy), policy)).To(Succeed())
+		Expect(policy.Status.Ready).To(BeFalse())
+		Expect(policy.Status.DeployedPolicies).To(BeEmpty())
+		Expect(conditions.IsTrue(policy, addonv1alpha1.PausedCondition)).To(BeTrue())
+		Expect(conditions.GetReason(policy, addonv1alpha1.PausedCondition)).To(Equal(addonv1alpha1.ClustersPausedReason))
+		Expect(conditions.GetMessage(policy, addonv1alpha1.PausedCondition)).To(ContainSubstring(cluster.Name))
+	})
+
+	It("should wait for paused clusters to delete the policy", func() {
+		const namespace = "paused-policy-deletion"
+		Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})).To(Succeed())
+
+		cluster := newCluster(namespace, true)
+		policy := newPolicy(namespace)
+		policy.SetFinalizers([]string{addonv1alpha1.KubewardenPolicyFinalizer})
+		Expect(k8sClient.Create(ctx, policy)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, policy)).To(Succeed())
+
+		result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(policy)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(deletionRequeueDuration))
+		Expect(calls.Load()).To(BeZero())
+
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(policy), policy)).To(Succeed())
+		Expect(policy.GetFinalizers()).To(ContainElement(addonv1alpha1.KubewardenPolicyFinalizer))
+		Expect(conditions.IsFalse(policy, clusterv1.ReadyCondition)).To(BeTrue())
+		Expect(conditions.GetReason(policy, clusterv1.ReadyCondition)).To(Equal(clusterv1.DeletingReason))
+		Expect(conditions.GetMessage(policy, clusterv1.ReadyCondition)).To(ContainSubstring(cluster.Name))
+		Expect(conditions.GetReason(policy, addonv1alpha1.PausedCondition)).To(Equal(addonv1alpha1.ClustersPausedReason))
+
+		By("Resuming the cluster")
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(cluster), cluster)).To(Succeed())
+		cluster.Spec.Paused = false
+		Expect(k8sClient.Update(ctx, cluster)).To(Succeed())
+
+		result, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(policy)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		Expect(calls.Load()).To(BeEquivalentTo(1))
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(policy), policy)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
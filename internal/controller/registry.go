@@ -0,0 +1,294 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+const (
+	// kubewardenRegistryCredentialsName is the name of the Secret holding the registry credentials in the workload
+	// clusters
+	kubewardenRegistryCredentialsName = "caapkw-registry-credentials"
+
+	// defaultSourcesKey is the default key of the Secret holding the sources configuration
+	defaultSourcesKey = "sources.yaml"
+
+	// registryCredentialsHashAnnotation is set on the PolicyServer pods with the hash of the registry credentials,
+	// so they are restarted and read the new credentials when they are rotated
+	registryCredentialsHashAnnotation = "caapkw.kubewarden.io/registry-credentials-hash"
+)
+
+// errRegistriesNotResolved is returned when the registry credentials or sources configuration referenced by an
+// addon are missing or invalid.
+var errRegistriesNotResolved = errors.New("registries not resolved")
+
+// kubewardenRegistries holds the registry configuration of the default PolicyServer, read from the Secrets
+// referenced by an addon.
+type kubewardenRegistries struct {
+	// DockerConfig holds the registry credentials, in the .dockerconfigjson format.
+	DockerConfig []byte
+
+	// InsecureSources lists the registries reached without TLS or without verifying their certificate.
+	InsecureSources []string
+
+	// SourceAuthorities maps registries to the PEM certificates of their certificate authorities.
+	SourceAuthorities map[string][]string
+}
+
+// sourcesConfig is the sources.yaml format of the policy server.
+type sourcesConfig struct {
+	InsecureSources   []string                     `json:"insecure_sources,omitempty"`
+	SourceAuthorities map[string][]sourceAuthority `json:"source_authorities,omitempty"`
+}
+
+type sourceAuthority struct {
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+// resolveRegistries returns the registry configuration referenced by the addon, or nil when the addon does not set
+// one.
+func (r *KubewardenAddonReconciler) resolveRegistries(ctx context.Context, addon *addonv1alpha1.KubewardenAddon) (*kubewardenRegistries, error) {
+	config := addon.Spec.Registries
+	if config == nil {
+		return nil, nil
+	}
+
+	registries := &kubewardenRegistries{}
+	if config.ImagePullSecret != "" {
+		secret, err := r.getRegistriesSecret(ctx, addon.Namespace, config.ImagePullSecret)
+		if err != nil {
+			return nil, err
+		}
+		if secret.Type != corev1.SecretTypeDockerConfigJson {
+			return nil, fmt.Errorf("%w: Secret %s has type %s, expected %s", errRegistriesNotResolved, secret.Name, secret.Type, corev1.SecretTypeDockerConfigJson)
+		}
+
+		dockerConfig := secret.Data[corev1.DockerConfigJsonKey]
+		if !json.Valid(dockerConfig) {
+			return nil, fmt.Errorf("%w: key %s of Secret %s is not valid JSON", errRegistriesNotResolved, corev1.DockerConfigJsonKey, secret.Name)
+		}
+		registries.DockerConfig = dockerConfig
+	}
+
+	if ref := config.SourcesFrom; ref != nil {
+		key := ref.Key
+		if key == "" {
+			key = defaultSourcesKey
+		}
+
+		secret, err := r.getRegistriesSecret(ctx, addon.Namespace, ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		data, found := secret.Data[key]
+		if !found {
+			return nil, fmt.Errorf("%w: key %s not found in Secret %s", errRegistriesNotResolved, key, ref.Name)
+		}
+
+		registries.InsecureSources, registries.SourceAuthorities, err = parseSourcesConfig(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %s of Secret %s: %w", errRegistriesNotResolved, key, ref.Name, err)
+		}
+	}
+
+	return registries, nil
+}
+
+func (r *KubewardenAddonReconciler) getRegistriesSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	if err := r.apiReader().Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: Secret %s not found", errRegistriesNotResolved, name)
+		}
+
+		return nil, fmt.Errorf("getting Secret %s: %w", name, err)
+	}
+
+	return secret, nil
+}
+
+// parseSourcesConfig returns the insecure sources and the source authorities of a sources configuration. The
+// certificates must be given inline, the files of the management cluster are not available to the policy servers.
+func parseSourcesConfig(data []byte) ([]string, map[string][]string, error) {
+	config := &sourcesConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, nil, fmt.Errorf("parsing sources config: %w", err)
+	}
+
+	var authorities map[string][]string
+	for source, sourceAuthorities := range config.SourceAuthorities {
+		for i, authority := range sourceAuthorities {
+			if authority.Type != "Data" {
+				return nil, nil, fmt.Errorf("source_authorities %s: authority %d has type '%s', only Data is supported", source, i, authority.Type)
+			}
+			if !isPEMCertificate(authority.Data) {
+				return nil, nil, fmt.Errorf("source_authorities %s: authority %d is not a PEM certificate", source, i)
+			}
+
+			if authorities == nil {
+				authorities = map[string][]string{}
+			}
+			authorities[source] = append(authorities[source], authority.Data)
+		}
+	}
+
+	return config.InsecureSources, authorities, nil
+}
+
+func isPEMCertificate(data string) bool {
+	block, _ := pem.Decode([]byte(data))
+
+	return block != nil && block.Type == "CERTIFICATE"
+}
+
+// applyRegistries sets the registry configuration on the default PolicyServer, and adds a Secret holding the
+// registry credentials to the kubewarden-defaults objects, ahead of the PolicyServer using it.
+func applyRegistries(manifests *kubewardenManifests, registries *kubewardenRegistries) error {
+	if registries == nil {
+		return nil
+	}
+
+	for _, obj := range manifests.Defaults {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok || u.GetKind() != "PolicyServer" {
+			continue
+		}
+
+		if err := setPolicyServerRegistries(u, registries); err != nil {
+			return fmt.Errorf("setting registries of PolicyServer %s: %w", u.GetName(), err)
+		}
+	}
+
+	if len(registries.DockerConfig) == 0 {
+		return nil
+	}
+
+	secret := &unstructured.Unstructured{}
+	secret.SetAPIVersion("v1")
+	secret.SetKind("Secret")
+	secret.SetName(kubewardenRegistryCredentialsName)
+	secret.SetNamespace(kubewardenNamespace)
+	secret.Object["type"] = string(corev1.SecretTypeDockerConfigJson)
+	if err := unstructured.SetNestedStringMap(secret.Object, map[string]string{
+		corev1.DockerConfigJsonKey: base64.StdEncoding.EncodeToString(registries.DockerConfig),
+	}, "data"); err != nil {
+		return fmt.Errorf("setting registry credentials data: %w", err)
+	}
+	manifests.Defaults = append([]client.Object{secret}, manifests.Defaults...)
+
+	return nil
+}
+
+func setPolicyServerRegistries(u *unstructured.Unstructured, registries *kubewardenRegistries) error {
+	if len(registries.DockerConfig) > 0 {
+		if err := unstructured.SetNestedField(u.Object, kubewardenRegistryCredentialsName, "spec", "imagePullSecret"); err != nil {
+			return err
+		}
+
+		// the policy server only reads the credentials on startup
+		annotations, _, err := unstructured.NestedStringMap(u.Object, "spec", "annotations")
+		if err != nil {
+			return err
+		}
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		hash := sha256.Sum256(registries.DockerConfig)
+		annotations[registryCredentialsHashAnnotation] = hex.EncodeToString(hash[:])
+		if err := unstructured.SetNestedStringMap(u.Object, annotations, "spec", "annotations"); err != nil {
+			return err
+		}
+	}
+
+	if len(registries.InsecureSources) > 0 {
+		if err := unstructured.SetNestedStringSlice(u.Object, registries.InsecureSources, "spec", "insecureSources"); err != nil {
+			return err
+		}
+	}
+
+	if len(registries.SourceAuthorities) > 0 {
+		sources := make([]string, 0, len(registries.SourceAuthorities))
+		for source := range registries.SourceAuthorities {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+
+		authorities := map[string]interface{}{}
+		for _, source := range sources {
+			certificates := []interface{}{}
+			for _, certificate := range registries.SourceAuthorities[source] {
+				certificates = append(certificates, certificate)
+			}
+			authorities[source] = certificates
+		}
+		if err := unstructured.SetNestedMap(u.Object, authorities, "spec", "sourceAuthorities"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeStaleRegistryCredentials deletes the registry credentials left on the cluster once the addon no longer sets
+// them. It returns the number of deleted objects.
+func removeStaleRegistryCredentials(ctx context.Context, remoteClient client.Client, manifests *kubewardenManifests) (int, error) {
+	if isObjectRendered(manifests.Defaults, "Secret", kubewardenRegistryCredentialsName) {
+		return 0, nil
+	}
+
+	deleted, err := deleteRegistryCredentials(ctx, remoteClient)
+	if err != nil || !deleted {
+		return 0, err
+	}
+
+	return 1, nil
+}
+
+// deleteRegistryCredentials deletes the Secret holding the registry credentials from the cluster. It returns
+// whether the Secret existed.
+func deleteRegistryCredentials(ctx context.Context, remoteClient client.Client) (bool, error) {
+	secret := &corev1.Secret{}
+	secret.SetName(kubewardenRegistryCredentialsName)
+	secret.SetNamespace(kubewardenNamespace)
+
+	deleted, err := deleteKubewardenObject(ctx, remoteClient, secret)
+	if err != nil {
+		return false, fmt.Errorf("deleting registry credentials: %w", err)
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+const (
+	testRegistryCertificate = "-----BEGIN CERTIFICATE-----\ndGVzdCBjZXJ0aWZpY2F0ZQ==\n-----END CERTIFICATE-----\n"
+
+	testDockerConfig = `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNzd29yZA=="}}}`
+
+	testSourcesConfig = `insecure_sources:
+  - localhost:5000
+source_authorities:
+  registry.example.com:
+    - type: Data
+      data: |
+        -----BEGIN CERTIFICATE-----
+        dGVzdCBjZXJ0aWZpY2F0ZQ==
+        -----END CERTIFICATE-----
+`
+)
+
+var _ = Describe("Kubewarden registries", func() {
+	It("should parse the sources config", func() {
+		insecureSources, authorities, err := parseSourcesConfig([]byte(testSourcesConfig))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(insecureSources).To(Equal([]string{"localhost:5000"}))
+		Expect(authorities).To(Equal(map[string][]string{"registry.example.com": {testRegistryCertificate}}))
+
+		_, _, err = parseSourcesConfig([]byte("source_authorities:\n  registry.example.com:\n  - type: Path\n    path: /ca.pem\n"))
+		Expect(err).To(MatchError(ContainSubstring("only Data is supported")))
+
+		_, _, err = parseSourcesConfig([]byte("source_authorities:\n  registry.example.com:\n  - type: Data\n    data: not a certificate\n"))
+		Expect(err).To(MatchError(ContainSubstring("not a PEM certificate")))
+	})
+
+	It("should distribute the registries with the default PolicyServer", func() {
+		policyServer := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		policyServer.SetKind("PolicyServer")
+		policyServer.SetName(kubewardenHelmDefaultPolicyServerName)
+		manifests := &kubewardenManifests{Defaults: []client.Object{policyServer}}
+
+		registries := &kubewardenRegistries{
+			DockerConfig:      []byte(testDockerConfig),
+			InsecureSources:   []string{"localhost:5000"},
+			SourceAuthorities: map[string][]string{"registry.example.com": {testRegistryCertificate}},
+		}
+		Expect(applyRegistries(manifests, registries)).To(Succeed())
+
+		Expect(manifests.Defaults).To(HaveLen(2))
+		secret := manifests.Defaults[0].(*unstructured.Unstructured)
+		Expect(secret.GetKind()).To(Equal("Secret"))
+		Expect(secret.GetNamespace()).To(Equal(kubewardenNamespace))
+		Expect(secret.Object).To(HaveKeyWithValue("type", string(corev1.SecretTypeDockerConfigJson)))
+
+		name, _, _ := unstructured.NestedString(policyServer.Object, "spec", "imagePullSecret")
+		Expect(name).To(Equal(secret.GetName()))
+		insecureSources, _, _ := unstructured.NestedStringSlice(policyServer.Object, "spec", "insecureSources")
+		Expect(insecureSources).To(Equal([]string{"localhost:5000"}))
+		authorities, _, _ := unstructured.NestedSlice(policyServer.Object, "spec", "sourceAuthorities", "registry.example.com")
+		Expect(authorities).To(Equal([]interface{}{testRegistryCertificate}))
+
+		// rotated credentials restart the policy server
+		annotations, _, _ := unstructured.NestedStringMap(policyServer.Object, "spec", "annotations")
+		hash := annotations[registryCredentialsHashAnnotation]
+		Expect(hash).NotTo(BeEmpty())
+
+		registries.DockerConfig = []byte(`{"auths":{}}`)
+		Expect(applyRegistries(manifests, registries)).To(Succeed())
+		annotations, _, _ = unstructured.NestedStringMap(policyServer.Object, "spec", "annotations")
+		Expect(annotations[registryCredentialsHashAnnotation]).NotTo(Equal(hash))
+	})
+
+	Context("When the addon references registry Secrets", func() {
+		var reconciler *KubewardenAddonReconciler
+		var addon *addonv1alpha1.KubewardenAddon
+
+		BeforeEach(func() {
+			reconciler = &KubewardenAddonReconciler{Client: k8sClient}
+			addon = &addonv1alpha1.KubewardenAddon{
+				ObjectMeta: metav1.ObjectMeta{Name: "registries-addon", Namespace: "default"},
+				Spec: addonv1alpha1.KubewardenAddonSpec{
+					Registries: &addonv1alpha1.RegistriesConfig{
+						ImagePullSecret: "registry-credentials",
+						SourcesFrom:     &addonv1alpha1.SourcesReference{Name: "registry-sources"},
+					},
+				},
+			}
+
+			secrets := []*corev1.Secret{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "registry-credentials", Namespace: "default"},
+					Type:       corev1.SecretTypeDockerConfigJson,
+					Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(testDockerConfig)},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "registry-sources", Namespace: "default"},
+					Data:       map[string][]byte{defaultSourcesKey: []byte(testSourcesConfig)},
+				},
+			}
+			for _, secret := range secrets {
+				Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+				DeferCleanup(func() {
+					Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
+				})
+			}
+		})
+
+		It("should read the registries from the Secrets", func() {
+			registries, err := reconciler.resolveRegistries(ctx, addon)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(registries.DockerConfig)).To(Equal(testDockerConfig))
+			Expect(registries.InsecureSources).To(Equal([]string{"localhost:5000"}))
+			Expect(registries.SourceAuthorities).To(HaveKey("registry.example.com"))
+		})
+
+		It("should fail on missing or invalid Secrets", func() {
+			addon.Spec.Registries.ImagePullSecret = "registry-sources"
+			_, err := reconciler.resolveRegistries(ctx, addon)
+			Expect(err).To(MatchError(ContainSubstring("expected kubernetes.io/dockerconfigjson")))
+			Expect(err).To(MatchError(errRegistriesNotResolved))
+
+			addon.Spec.Registries.ImagePullSecret = ""
+			addon.Spec.Registries.SourcesFrom.Key = "missing"
+			_, err = reconciler.resolveRegistries(ctx, addon)
+			Expect(err).To(MatchError(errRegistriesNotResolved))
+
+			addon.Spec.Registries.SourcesFrom = &addonv1alpha1.SourcesReference{Name: "missing"}
+			_, err = reconciler.resolveRegistries(ctx, addon)
+			Expect(err).To(MatchError(errRegistriesNotResolved))
+		})
+	})
+})
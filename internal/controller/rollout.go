@@ -0,0 +1,253 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+// planRollout returns the names of the selected clusters Kubewarden may be installed or upgraded on, following the
+// rollout strategy of the addon, and records the progress of the rollout in the addon status. Clusters already
+// running the desired version and manifests are always returned, so their drift keeps being corrected.
+func planRollout(addon *addonv1alpha1.KubewardenAddon, clusters []clusterv1.Cluster, desiredVersion, desiredHash string, now time.Time) map[string]bool {
+	admitted := map[string]bool{}
+	strategy := addon.Spec.RolloutStrategy
+	if strategy == nil {
+		addon.Status.Rollout = nil
+		for _, cluster := range clusters {
+			admitted[cluster.Name] = true
+		}
+
+		return admitted
+	}
+
+	// a new version, or new manifests, start a new rollout
+	rollout := addon.Status.Rollout
+	if rollout == nil || rollout.Version != desiredVersion || rollout.Hash != desiredHash {
+		rollout = &addonv1alpha1.RolloutStatus{Version: desiredVersion, Hash: desiredHash}
+		addon.Status.Rollout = rollout
+	}
+
+	rolling := map[string]bool{}
+	for _, name := range rollout.Clusters {
+		rolling[name] = true
+	}
+
+	var inProgress, failed []string
+	// paused clusters are not picked until they are resumed
+	candidates := []clusterv1.Cluster{}
+	for i := range clusters {
+		cluster := &clusters[i]
+		status := clusterInstallationStatus(addon, cluster)
+		upToDate := isKubewardenUpToDate(cluster, desiredVersion, desiredHash)
+		if upToDate {
+			admitted[cluster.Name] = true
+		}
+
+		switch {
+		case rolling[cluster.Name]:
+			if status.Phase == addonv1alpha1.ClusterInstallationFailed || isRolloutStuck(status, strategy, now) {
+				failed = append(failed, cluster.Name)
+			}
+			if rolloutRemaining(status, desiredVersion, desiredHash, rolloutSoakTime(strategy), now) != 0 {
+				inProgress = append(inProgress, cluster.Name)
+			}
+		case upToDate, isClusterPaused(cluster):
+		case isControlPlaneReady(cluster):
+			candidates = append(candidates, *cluster)
+		}
+	}
+
+	// clusters are kept in the rollout until they are ready and soaked
+	rollout.Clusters = inProgress
+	rollout.Halted = len(failed) > 0
+	if !rollout.Halted && len(candidates) > 0 {
+		size := rolloutBatchSize(strategy, len(clusters))
+
+		// batches only start once the previous one is done, otherwise free slots are filled right away
+		free := size - len(inProgress)
+		if strategy.MaxUnavailable == nil && len(inProgress) > 0 {
+			free = 0
+		}
+
+		if free > 0 {
+			sortClustersForRollout(candidates, strategy.OrderByLabel)
+			for _, cluster := range candidates[:min(free, len(candidates))] {
+				rollout.Clusters = append(rollout.Clusters, cluster.Name)
+			}
+			rollout.Batch++
+		}
+	}
+
+	for _, name := range rollout.Clusters {
+		admitted[name] = true
+	}
+
+	switch {
+	case rollout.Halted:
+		rollout.Message = fmt.Sprintf("Rollout of Kubewarden %s halted, it failed on clusters: %s", desiredVersion, strings.Join(failed, ", "))
+	case len(rollout.Clusters) > 0:
+		rollout.Message = fmt.Sprintf("Rolling out Kubewarden %s to clusters: %s", desiredVersion, strings.Join(rollout.Clusters, ", "))
+	default:
+		rollout.Message = fmt.Sprintf("Kubewarden %s rolled out", desiredVersion)
+	}
+
+	return admitted
+}
+
+// updateRolloutProgress counts the selected clusters where the rolled out version and manifests are ready, and
+// returns when the soak time of the clusters being rolled out ends.
+func updateRolloutProgress(addon *addonv1alpha1.KubewardenAddon, now time.Time) time.Duration {
+	rollout := addon.Status.Rollout
+	if rollout == nil {
+		return 0
+	}
+
+	rollout.UpdatedClusters = 0
+	for _, status := range addon.Status.Clusters {
+		if status.Phase == addonv1alpha1.ClusterInstallationReady && status.InstalledVersion == rollout.Version &&
+			status.AppliedHash == rollout.Hash {
+			rollout.UpdatedClusters++
+		}
+	}
+
+	requeueAfter := time.Duration(0)
+	soakTime := rolloutSoakTime(addon.Spec.RolloutStrategy)
+	for _, name := range rollout.Clusters {
+		for i := range addon.Status.Clusters {
+			status := &addon.Status.Clusters[i]
+			if status.ClusterName != name {
+				continue
+			}
+
+			// clusters done soaking are moved out of the rollout right away
+			remaining := rolloutRemaining(status, rollout.Version, rollout.Hash, soakTime, now)
+			if remaining >= 0 {
+				requeueAfter = shortestRequeue(requeueAfter, max(remaining, time.Second))
+			}
+		}
+	}
+
+	return requeueAfter
+}
+
+// rolloutRemaining returns how long the cluster still has to soak at the desired version and manifests, or a
+// negative duration when it is not ready with them yet. Zero means the cluster is rolled out.
+func rolloutRemaining(status *addonv1alpha1.ClusterInstallationStatus, desiredVersion, desiredHash string, soakTime time.Duration, now time.Time) time.Duration {
+	if status.Phase != addonv1alpha1.ClusterInstallationReady || status.InstalledVersion != desiredVersion ||
+		status.AppliedHash != desiredHash || status.LastTransitionTime == nil {
+		return -1
+	}
+
+	remaining := status.LastTransitionTime.Add(soakTime).Sub(now)
+	if remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
+
+// rolloutBatchSize returns the number of clusters rolled out at the same time out of the given total.
+func rolloutBatchSize(strategy *addonv1alpha1.RolloutStrategy, total int) int {
+	size := intstr.FromString("100%")
+	roundUp := true
+	switch {
+	case strategy.BatchSize != nil:
+		size = *strategy.BatchSize
+	case strategy.MaxUnavailable != nil:
+		size = *strategy.MaxUnavailable
+		roundUp = false
+	}
+
+	scaled, err := intstr.GetScaledValueFromIntOrPercent(&size, total, roundUp)
+	if err != nil || scaled < 1 {
+		return 1
+	}
+
+	return scaled
+}
+
+// isRolloutStuck returns whether the cluster being rolled out has not become healthy for longer than the soak time,
+// or than rolloutUnhealthyTimeout when the soak time is shorter. Such clusters count as failed, so the rollout does
+// not wait on them forever.
+func isRolloutStuck(status *addonv1alpha1.ClusterInstallationStatus, strategy *addonv1alpha1.RolloutStrategy, now time.Time) bool {
+	switch status.Phase {
+	case addonv1alpha1.ClusterInstallationDegraded, addonv1alpha1.ClusterInstallationInstalling, addonv1alpha1.ClusterInstallationUpgrading:
+	default:
+		return false
+	}
+
+	return status.LastTransitionTime != nil &&
+		now.Sub(status.LastTransitionTime.Time) > max(rolloutSoakTime(strategy), rolloutUnhealthyTimeout)
+}
+
+func rolloutSoakTime(strategy *addonv1alpha1.RolloutStrategy) time.Duration {
+	if strategy == nil || strategy.SoakTime == nil {
+		return 0
+	}
+
+	return strategy.SoakTime.Duration
+}
+
+// sortClustersForRollout sorts the clusters by the value of the given label, numbers first, then by name. Clusters
+// without the label go last.
+func sortClustersForRollout(clusters []clusterv1.Cluster, label string) {
+	sort.SliceStable(clusters, func(i, j int) bool {
+		a, aFound := clusters[i].GetLabels()[label]
+		b, bFound := clusters[j].GetLabels()[label]
+		if aFound != bFound {
+			return aFound
+		}
+
+		aNumber, aErr := strconv.ParseFloat(a, 64)
+		bNumber, bErr := strconv.ParseFloat(b, 64)
+		switch {
+		case aErr == nil && bErr == nil && aNumber != bNumber:
+			return aNumber < bNumber
+		case (aErr == nil) != (bErr == nil):
+			return aErr == nil
+		case aErr != nil && a != b:
+			return a < b
+		}
+
+		return clusters[i].Name < clusters[j].Name
+	})
+}
+
+// isKubewardenUpToDate returns whether the cluster is annotated with Kubewarden installed at the given version and
+// with the given manifests. Clusters installed before the hash annotation existed are brought to the desired
+// manifests by the drift correction, they are up to date at the given version.
+func isKubewardenUpToDate(cluster *clusterv1.Cluster, version, hash string) bool {
+	installedHash := cluster.GetAnnotations()[KubewardenHashAnnotation]
+
+	return isKubewardenInstalled(cluster) && cluster.GetAnnotations()[KubewardenVersionAnnotation] == version &&
+		(installedHash == hash || installedHash == "")
+}
+
+func isControlPlaneReady(cluster *clusterv1.Cluster) bool {
+	return cluster.Status.ControlPlaneReady || conditions.IsTrue(cluster, clusterv1.ControlPlaneReadyCondition)
+}
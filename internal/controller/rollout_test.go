@@ -0,0 +1,185 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+var _ = Describe("Kubewarden rollout", func() {
+	const (
+		version = "v1.18.0"
+		hash    = "b3f0c7f6bb763af1be91d9e74eabfeb1"
+	)
+
+	var (
+		addon    *addonv1alpha1.KubewardenAddon
+		clusters []clusterv1.Cluster
+		now      time.Time
+	)
+
+	newCluster := func(name, wave string) clusterv1.Cluster {
+		cluster := clusterv1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{}},
+			Status:     clusterv1.ClusterStatus{ControlPlaneReady: true},
+		}
+		if wave != "" {
+			cluster.Labels["wave"] = wave
+		}
+
+		return cluster
+	}
+
+	// markRolledOut records Kubewarden as installed and ready on the cluster at the given time
+	markRolledOut := func(cluster *clusterv1.Cluster, at time.Time) {
+		cluster.Annotations = map[string]string{
+			KubewardenInstalledAnnotation: "true",
+			KubewardenVersionAnnotation:   version,
+			KubewardenHashAnnotation:      hash,
+		}
+		status := clusterInstallationStatus(addon, cluster)
+		status.Phase = addonv1alpha1.ClusterInstallationReady
+		status.InstalledVersion = version
+		status.AppliedHash = hash
+		status.LastTransitionTime = &metav1.Time{Time: at}
+	}
+
+	BeforeEach(func() {
+		batchSize := intstr.FromInt32(1)
+		addon = &addonv1alpha1.KubewardenAddon{
+			Spec: addonv1alpha1.KubewardenAddonSpec{
+				RolloutStrategy: &addonv1alpha1.RolloutStrategy{
+					BatchSize:    &batchSize,
+					OrderByLabel: "wave",
+					SoakTime:     &metav1.Duration{Duration: 10 * time.Minute},
+				},
+			},
+		}
+		clusters = []clusterv1.Cluster{
+			newCluster("cluster-c", ""),
+			newCluster("cluster-b", "10"),
+			newCluster("cluster-a", "2"),
+		}
+		now = time.Now()
+	})
+
+	It("should admit every cluster without a rollout strategy", func() {
+		addon.Spec.RolloutStrategy = nil
+		admitted := planRollout(addon, clusters, version, hash, now)
+
+		Expect(admitted).To(HaveLen(3))
+		Expect(addon.Status.Rollout).To(BeNil())
+	})
+
+	It("should roll out batches in label order after the soak time", func() {
+		admitted := planRollout(addon, clusters, version, hash, now)
+		Expect(admitted).To(Equal(map[string]bool{"cluster-a": true}))
+		Expect(addon.Status.Rollout.Batch).To(BeEquivalentTo(1))
+
+		// the next batch waits for the first one to soak
+		markRolledOut(&clusters[2], now)
+		admitted = planRollout(addon, clusters, version, hash, now.Add(time.Minute))
+		Expect(admitted).To(Equal(map[string]bool{"cluster-a": true}))
+		Expect(updateRolloutProgress(addon, now.Add(time.Minute))).To(Equal(9 * time.Minute))
+		Expect(addon.Status.Rollout.UpdatedClusters).To(BeEquivalentTo(1))
+
+		admitted = planRollout(addon, clusters, version, hash, now.Add(10*time.Minute))
+		Expect(admitted).To(Equal(map[string]bool{"cluster-a": true, "cluster-b": true}))
+		Expect(addon.Status.Rollout.Clusters).To(Equal([]string{"cluster-b"}))
+		Expect(addon.Status.Rollout.Batch).To(BeEquivalentTo(2))
+	})
+
+	It("should fill free slots right away with max unavailable", func() {
+		maxUnavailable := intstr.FromString("66%")
+		addon.Spec.RolloutStrategy.BatchSize = nil
+		addon.Spec.RolloutStrategy.MaxUnavailable = &maxUnavailable
+		addon.Spec.RolloutStrategy.SoakTime = nil
+
+		admitted := planRollout(addon, clusters, version, hash, now)
+		Expect(admitted).To(Equal(map[string]bool{"cluster-a": true}))
+
+		maxUnavailable = intstr.FromInt32(2)
+		admitted = planRollout(addon, clusters, version, hash, now)
+		Expect(admitted).To(Equal(map[string]bool{"cluster-a": true, "cluster-b": true}))
+
+		markRolledOut(&clusters[2], now)
+		admitted = planRollout(addon, clusters, version, hash, now)
+		Expect(admitted).To(HaveLen(3))
+		Expect(addon.Status.Rollout.Clusters).To(Equal([]string{"cluster-b", "cluster-c"}))
+	})
+
+	It("should not pick paused clusters", func() {
+		clusters[2].Spec.Paused = true
+		admitted := planRollout(addon, clusters, version, hash, now)
+
+		Expect(admitted).To(Equal(map[string]bool{"cluster-b": true}))
+	})
+
+	It("should halt when a cluster being rolled out fails", func() {
+		planRollout(addon, clusters, version, hash, now)
+		clusterInstallationStatus(addon, &clusters[2]).Phase = addonv1alpha1.ClusterInstallationFailed
+
+		admitted := planRollout(addon, clusters, version, hash, now.Add(time.Hour))
+		Expect(admitted).To(Equal(map[string]bool{"cluster-a": true}))
+		Expect(addon.Status.Rollout.Halted).To(BeTrue())
+		Expect(addon.Status.Rollout.Message).To(ContainSubstring("cluster-a"))
+
+		// a new version starts over
+		admitted = planRollout(addon, clusters, "v1.19.0", hash, now.Add(time.Hour))
+		Expect(admitted).To(Equal(map[string]bool{"cluster-a": true}))
+		Expect(addon.Status.Rollout.Halted).To(BeFalse())
+		Expect(addon.Status.Rollout.Version).To(Equal("v1.19.0"))
+	})
+	It("should halt when a cluster being rolled out stays unhealthy past the soak time", func() {
+		planRollout(addon, clusters, version, hash, now)
+		status := clusterInstallationStatus(addon, &clusters[2])
+		status.Phase = addonv1alpha1.ClusterInstallationDegraded
+		status.LastTransitionTime = &metav1.Time{Time: now}
+
+		admitted := planRollout(addon, clusters, version, hash, now.Add(5*time.Minute))
+		Expect(admitted).To(Equal(map[string]bool{"cluster-a": true}))
+		Expect(addon.Status.Rollout.Halted).To(BeFalse())
+
+		admitted = planRollout(addon, clusters, version, hash, now.Add(11*time.Minute))
+		Expect(admitted).To(Equal(map[string]bool{"cluster-a": true}))
+		Expect(addon.Status.Rollout.Halted).To(BeTrue())
+		Expect(addon.Status.Rollout.Message).To(ContainSubstring("cluster-a"))
+	})
+
+	It("should start a new rollout when only the manifests change", func() {
+		for i := range clusters {
+			markRolledOut(&clusters[i], now)
+		}
+		admitted := planRollout(addon, clusters, version, hash, now)
+		Expect(admitted).To(HaveLen(3))
+		Expect(addon.Status.Rollout.Clusters).To(BeEmpty())
+
+		// new values keep the version, they are rolled out batch by batch too
+		admitted = planRollout(addon, clusters, version, "6e2f1b6c1fbb0f0fcb39bbf2a8c5ae4d", now.Add(time.Hour))
+		Expect(admitted).To(Equal(map[string]bool{"cluster-a": true}))
+		Expect(addon.Status.Rollout.Hash).To(Equal("6e2f1b6c1fbb0f0fcb39bbf2a8c5ae4d"))
+		Expect(addon.Status.Rollout.Batch).To(BeEquivalentTo(1))
+	})
+})
@@ -0,0 +1,222 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+// controlPlaneToleration lets Kubewarden run on the control-plane nodes of single-node clusters (CAPD, kind, etc.)
+var controlPlaneToleration = corev1.Toleration{
+	Key:      "node-role.kubernetes.io/control-plane",
+	Operator: corev1.TolerationOpExists,
+	Effect:   corev1.TaintEffectNoSchedule,
+}
+
+var (
+	deploymentPodSpecPath = []string{"spec", "template", "spec"}
+	cronJobPodSpecPath    = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+)
+
+// applyKubewardenScheduling sets the scheduling constraints of the addon on the rendered kubewarden-controller
+// Deployment, audit-scanner CronJob and default PolicyServer. Constraints that are not set in the addon keep their
+// rendered value, so they can still be set through the chart values. Tolerations are added to the rendered ones.
+func applyKubewardenScheduling(manifests *kubewardenManifests, config addonv1alpha1.SchedulingConfig) error {
+	for _, obj := range manifests.Controller {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+
+		var err error
+		switch u.GetKind() {
+		case "Deployment":
+			err = setPodScheduling(u, deploymentPodSpecPath, componentScheduling(config.Controller, config.TolerateControlPlane))
+		case "CronJob":
+			err = setPodScheduling(u, cronJobPodSpecPath, componentScheduling(config.AuditScanner, config.TolerateControlPlane))
+		}
+		if err != nil {
+			return fmt.Errorf("setting scheduling of %s %s: %w", u.GetKind(), u.GetName(), err)
+		}
+	}
+
+	for _, obj := range manifests.Defaults {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok || u.GetKind() != "PolicyServer" {
+			continue
+		}
+
+		if err := setPolicyServerScheduling(u, componentScheduling(config.PolicyServer, config.TolerateControlPlane)); err != nil {
+			return fmt.Errorf("setting scheduling of PolicyServer %s: %w", u.GetName(), err)
+		}
+	}
+
+	return nil
+}
+
+// componentScheduling returns the scheduling of a component, with the control-plane toleration when requested.
+func componentScheduling(scheduling addonv1alpha1.Scheduling, tolerateControlPlane bool) addonv1alpha1.Scheduling {
+	scheduling = *scheduling.DeepCopy()
+	if !tolerateControlPlane {
+		return scheduling
+	}
+
+	for _, toleration := range scheduling.Tolerations {
+		if toleration.MatchToleration(&controlPlaneToleration) {
+			return scheduling
+		}
+	}
+	scheduling.Tolerations = append(scheduling.Tolerations, controlPlaneToleration)
+
+	return scheduling
+}
+
+// setPodScheduling sets the scheduling constraints on the pod spec found at the given path of the object.
+func setPodScheduling(u *unstructured.Unstructured, podSpecPath []string, scheduling addonv1alpha1.Scheduling) error {
+	return setSchedulingFields(u, podSpecPath, &scheduling)
+}
+
+// setPolicyServerScheduling sets the scheduling constraints on a PolicyServer. The PolicyServer has no node
+// selector, it is added to the required node affinity instead.
+func setPolicyServerScheduling(u *unstructured.Unstructured, scheduling addonv1alpha1.Scheduling) error {
+	policyServerScheduling := &addonv1alpha1.Scheduling{
+		Tolerations: scheduling.Tolerations,
+		Affinity:    scheduling.Affinity,
+	}
+	if len(scheduling.NodeSelector) > 0 {
+		policyServerScheduling.Affinity = nodeSelectorAffinity(scheduling.Affinity, scheduling.NodeSelector)
+	}
+
+	return setSchedulingFields(u, []string{"spec"}, policyServerScheduling)
+}
+
+// nodeSelectorAffinity returns a copy of the affinity requiring the nodes to match the node selector as well.
+func nodeSelectorAffinity(affinity *corev1.Affinity, nodeSelector map[string]string) *corev1.Affinity {
+	if affinity == nil {
+		affinity = &corev1.Affinity{}
+	}
+	affinity = affinity.DeepCopy()
+
+	if affinity.NodeAffinity == nil {
+		affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil {
+		required = &corev1.NodeSelector{}
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = required
+	}
+	if len(required.NodeSelectorTerms) == 0 {
+		required.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+	}
+
+	keys := make([]string, 0, len(nodeSelector))
+	for key := range nodeSelector {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// node selector terms are ORed, the node selector must be added to each of them
+	for i := range required.NodeSelectorTerms {
+		term := &required.NodeSelectorTerms[i]
+		for _, key := range keys {
+			term.MatchExpressions = append(term.MatchExpressions, corev1.NodeSelectorRequirement{
+				Key:      key,
+				Operator: corev1.NodeSelectorOpIn,
+				Values:   []string{nodeSelector[key]},
+			})
+		}
+	}
+
+	return affinity
+}
+
+// setSchedulingFields sets the fields of the scheduling constraints that are set on the object at the given path.
+// The tolerations are merged with the rendered ones.
+func setSchedulingFields(u *unstructured.Unstructured, path []string, scheduling *addonv1alpha1.Scheduling) error {
+	if len(scheduling.Tolerations) > 0 {
+		rendered, err := renderedTolerations(u, path)
+		if err != nil {
+			return err
+		}
+		scheduling = scheduling.DeepCopy()
+		scheduling.Tolerations = mergeTolerations(rendered, scheduling.Tolerations)
+	}
+
+	fields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(scheduling)
+	if err != nil {
+		return fmt.Errorf("converting scheduling: %w", err)
+	}
+
+	for name, value := range fields {
+		fieldPath := append(append([]string{}, path...), name)
+		if err := unstructured.SetNestedField(u.Object, value, fieldPath...); err != nil {
+			return fmt.Errorf("setting %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// renderedTolerations returns the tolerations of the object at the given path.
+func renderedTolerations(u *unstructured.Unstructured, path []string) ([]corev1.Toleration, error) {
+	fieldPath := append(append([]string{}, path...), "tolerations")
+	values, _, err := unstructured.NestedSlice(u.Object, fieldPath...)
+	if err != nil {
+		return nil, fmt.Errorf("reading tolerations: %w", err)
+	}
+
+	tolerations := make([]corev1.Toleration, 0, len(values))
+	for _, value := range values {
+		content, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("reading tolerations: unexpected type %T", value)
+		}
+		toleration := corev1.Toleration{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, &toleration); err != nil {
+			return nil, fmt.Errorf("reading tolerations: %w", err)
+		}
+		tolerations = append(tolerations, toleration)
+	}
+
+	return tolerations, nil
+}
+
+// mergeTolerations returns the rendered tolerations followed by the given ones that are not rendered already.
+func mergeTolerations(rendered, tolerations []corev1.Toleration) []corev1.Toleration {
+	merged := append([]corev1.Toleration{}, rendered...)
+	for i := range tolerations {
+		found := false
+		for j := range rendered {
+			if rendered[j].MatchToleration(&tolerations[i]) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, tolerations[i])
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+var _ = Describe("Kubewarden scheduling", func() {
+	var manifests *kubewardenManifests
+
+	newObject := func(kind string, content map[string]interface{}) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: content}
+		u.SetKind(kind)
+		u.SetName("kubewarden")
+
+		return u
+	}
+
+	BeforeEach(func() {
+		manifests = &kubewardenManifests{
+			Controller: []client.Object{
+				newObject("Deployment", map[string]interface{}{
+					"spec": map[string]interface{}{
+						"template": map[string]interface{}{
+							"spec": map[string]interface{}{
+								"nodeSelector": map[string]interface{}{"kubernetes.io/os": "linux"},
+							},
+						},
+					},
+				}),
+				newObject("CronJob", map[string]interface{}{}),
+			},
+			Defaults: []client.Object{
+				newObject("PolicyServer", map[string]interface{}{}),
+			},
+		}
+	})
+
+	It("should keep the rendered scheduling by default", func() {
+		Expect(applyKubewardenScheduling(manifests, addonv1alpha1.SchedulingConfig{})).To(Succeed())
+
+		deployment := manifests.Controller[0].(*unstructured.Unstructured)
+		Expect(deployment.Object).To(HaveKeyWithValue("spec", HaveKeyWithValue("template", HaveKeyWithValue("spec", map[string]interface{}{
+			"nodeSelector": map[string]interface{}{"kubernetes.io/os": "linux"},
+		}))))
+		_, found, _ := unstructured.NestedFieldNoCopy(manifests.Defaults[0].(*unstructured.Unstructured).Object, "spec", "tolerations")
+		Expect(found).To(BeFalse())
+	})
+
+	It("should set the scheduling of each component", func() {
+		config := addonv1alpha1.SchedulingConfig{
+			TolerateControlPlane: true,
+			Controller: addonv1alpha1.Scheduling{
+				NodeSelector: map[string]string{"node-pool": "system"},
+			},
+			AuditScanner: addonv1alpha1.Scheduling{
+				Tolerations: []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "kubewarden"}},
+			},
+			PolicyServer: addonv1alpha1.Scheduling{
+				NodeSelector: map[string]string{"node-pool": "kubewarden"},
+			},
+		}
+		Expect(applyKubewardenScheduling(manifests, config)).To(Succeed())
+
+		deployment := manifests.Controller[0].(*unstructured.Unstructured)
+		nodeSelector, _, _ := unstructured.NestedStringMap(deployment.Object, "spec", "template", "spec", "nodeSelector")
+		Expect(nodeSelector).To(Equal(map[string]string{"node-pool": "system"}))
+		tolerations, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "tolerations")
+		Expect(tolerations).To(ConsistOf(HaveKeyWithValue("key", "node-role.kubernetes.io/control-plane")))
+
+		cronJob := manifests.Controller[1].(*unstructured.Unstructured)
+		tolerations, _, _ = unstructured.NestedSlice(cronJob.Object, "spec", "jobTemplate", "spec", "template", "spec", "tolerations")
+		Expect(tolerations).To(HaveLen(2))
+
+		policyServer := manifests.Defaults[0].(*unstructured.Unstructured)
+		terms, _, _ := unstructured.NestedSlice(policyServer.Object,
+			"spec", "affinity", "nodeAffinity", "requiredDuringSchedulingIgnoredDuringExecution", "nodeSelectorTerms")
+		Expect(terms).To(ConsistOf(HaveKeyWithValue("matchExpressions", ConsistOf(map[string]interface{}{
+			"key": "node-pool", "operator": "In", "values": []interface{}{"kubewarden"},
+		}))))
+	})
+	It("should add the tolerations to the rendered ones", func() {
+		Expect(unstructured.SetNestedSlice(manifests.Controller[0].(*unstructured.Unstructured).Object, []interface{}{
+			map[string]interface{}{"key": "node-role.kubernetes.io/control-plane", "operator": "Exists", "effect": "NoSchedule"},
+			map[string]interface{}{"key": "dedicated", "operator": "Equal", "value": "system"},
+		}, "spec", "template", "spec", "tolerations")).To(Succeed())
+
+		config := addonv1alpha1.SchedulingConfig{
+			TolerateControlPlane: true,
+			Controller: addonv1alpha1.Scheduling{
+				Tolerations: []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "kubewarden"}},
+			},
+		}
+		Expect(applyKubewardenScheduling(manifests, config)).To(Succeed())
+
+		deployment := manifests.Controller[0].(*unstructured.Unstructured)
+		tolerations, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "tolerations")
+		Expect(tolerations).To(HaveExactElements(
+			HaveKeyWithValue("key", "node-role.kubernetes.io/control-plane"),
+			HaveKeyWithValue("value", "system"),
+			HaveKeyWithValue("value", "kubewarden"),
+		))
+	})
+})
@@ -0,0 +1,251 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/yaml"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+const (
+	defaultValuesKey = "values.yaml"
+
+	// referencesIndexKey indexes KubewardenAddons by the ConfigMaps and Secrets they reference
+	referencesIndexKey = "spec.references"
+)
+
+// errValuesNotResolved is returned when the values referenced by an addon are missing or invalid.
+var errValuesNotResolved = errors.New("values not resolved")
+
+// kubewardenChartValues holds the values used to render the Kubewarden charts of an addon.
+type kubewardenChartValues struct {
+	// Controller holds the values of the kubewarden-controller chart.
+	Controller map[string]interface{}
+
+	// Defaults holds the values of the kubewarden-defaults chart.
+	Defaults map[string]interface{}
+}
+
+// providerChartValues returns the chart values computed by the provider from the typed fields of the addon.
+func providerChartValues(addon *addonv1alpha1.KubewardenAddon) *kubewardenChartValues {
+	return &kubewardenChartValues{
+		Controller: kubewardenControllerValues(addon),
+		Defaults:   kubewardenDefaultsValues(addon),
+	}
+}
+
+// resolveChartValues returns the chart values of the addon: the values computed by the provider, overridden by the
+// values referenced in spec.valuesFrom in order, and finally by the inline spec.controllerValues and
+// spec.defaultsValues.
+func (r *KubewardenAddonReconciler) resolveChartValues(ctx context.Context, addon *addonv1alpha1.KubewardenAddon) (*kubewardenChartValues, error) {
+	values := providerChartValues(addon)
+
+	for _, ref := range addon.Spec.ValuesFrom {
+		refValues, err := r.getReferencedValues(ctx, addon.Namespace, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		switch ref.Chart {
+		case kubewardenControllerChartName:
+			values.Controller = mergeValues(values.Controller, refValues)
+		case kubewardenDefaultsChartName:
+			values.Defaults = mergeValues(values.Defaults, refValues)
+		default:
+			return nil, fmt.Errorf("%w: %s %s: unknown chart %s", errValuesNotResolved, ref.Kind, ref.Name, ref.Chart)
+		}
+	}
+
+	controllerValues, err := rawValues(addon.Spec.ControllerValues)
+	if err != nil {
+		return nil, fmt.Errorf("%w: spec.controllerValues: %w", errValuesNotResolved, err)
+	}
+	values.Controller = mergeValues(values.Controller, controllerValues)
+
+	defaultsValues, err := rawValues(addon.Spec.DefaultsValues)
+	if err != nil {
+		return nil, fmt.Errorf("%w: spec.defaultsValues: %w", errValuesNotResolved, err)
+	}
+	values.Defaults = mergeValues(values.Defaults, defaultsValues)
+
+	return values, nil
+}
+
+// getReferencedValues reads the values held by the ConfigMap or Secret key referenced by ref. Missing optional
+// objects or keys resolve to no values.
+func (r *KubewardenAddonReconciler) getReferencedValues(ctx context.Context, namespace string, ref addonv1alpha1.ValuesReference) (map[string]interface{}, error) {
+	key := ref.Key
+	if key == "" {
+		key = defaultValuesKey
+	}
+
+	var data []byte
+	var found bool
+	objectKey := types.NamespacedName{Name: ref.Name, Namespace: namespace}
+
+	switch ref.Kind {
+	case "ConfigMap":
+		configMap := &corev1.ConfigMap{}
+		if err := r.apiReader().Get(ctx, objectKey, configMap); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("getting ConfigMap %s: %w", ref.Name, err)
+			}
+			break
+		}
+
+		var value string
+		if value, found = configMap.Data[key]; found {
+			data = []byte(value)
+		} else {
+			data, found = configMap.BinaryData[key]
+		}
+	case "Secret":
+		secret := &corev1.Secret{}
+		if err := r.apiReader().Get(ctx, objectKey, secret); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("getting Secret %s: %w", ref.Name, err)
+			}
+			break
+		}
+
+		data, found = secret.Data[key]
+	default:
+		return nil, fmt.Errorf("%w: unsupported kind %s", errValuesNotResolved, ref.Kind)
+	}
+
+	if !found {
+		if ref.Optional {
+			log.FromContext(ctx).Info("Optional values not found, skipping", "kind", ref.Kind, "name", ref.Name, "key", key)
+
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("%w: key %s not found in %s %s", errValuesNotResolved, key, ref.Kind, ref.Name)
+	}
+
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("%w: parsing key %s of %s %s: %w", errValuesNotResolved, key, ref.Kind, ref.Name, err)
+	}
+
+	return values, nil
+}
+
+// rawValues returns the values held by a free-form spec field.
+func rawValues(raw runtime.RawExtension) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if len(raw.Raw) == 0 {
+		return values, nil
+	}
+	if err := yaml.Unmarshal(raw.Raw, &values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// mergeValues returns a deep merge of override over base. Nested maps are merged, any other value in override,
+// lists included, replaces the one in base. Neither argument is modified.
+func mergeValues(base, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base))
+	for key, value := range base {
+		merged[key] = value
+	}
+
+	for key, value := range override {
+		overrideMap, overrideIsMap := value.(map[string]interface{})
+		baseMap, baseIsMap := merged[key].(map[string]interface{})
+		if overrideIsMap && baseIsMap {
+			merged[key] = mergeValues(baseMap, overrideMap)
+			continue
+		}
+		merged[key] = value
+	}
+
+	return merged
+}
+
+// referencesIndexValues returns the index values of the ConfigMaps and Secrets referenced by an addon, in
+// spec.valuesFrom, spec.verificationConfig and spec.registries.
+func referencesIndexValues(o client.Object) []string {
+	addon, ok := o.(*addonv1alpha1.KubewardenAddon)
+	if !ok {
+		return nil
+	}
+
+	values := []string{}
+	for _, ref := range addon.Spec.ValuesFrom {
+		values = append(values, referencesIndexValue(ref.Kind, ref.Name))
+	}
+	if ref := addon.Spec.VerificationConfig; ref != nil {
+		values = append(values, referencesIndexValue("ConfigMap", ref.Name))
+	}
+	if registries := addon.Spec.Registries; registries != nil {
+		if registries.ImagePullSecret != "" {
+			values = append(values, referencesIndexValue("Secret", registries.ImagePullSecret))
+		}
+		if registries.SourcesFrom != nil {
+			values = append(values, referencesIndexValue("Secret", registries.SourcesFrom.Name))
+		}
+	}
+	if artifacts := addon.Spec.Artifacts; artifacts != nil && artifacts.CRDs != nil && artifacts.CRDs.ConfigMapName != "" {
+		values = append(values, referencesIndexValue("ConfigMap", artifacts.CRDs.ConfigMapName))
+	}
+
+	return values
+}
+
+func referencesIndexValue(kind, name string) string {
+	return kind + "/" + name
+}
+
+// referencedObjectToKubewardenAddons returns a handler.MapFunc enqueuing the addons referencing a ConfigMap or
+// Secret of the given kind.
+func (r *KubewardenAddonReconciler) referencedObjectToKubewardenAddons(kind string) func(context.Context, client.Object) []reconcile.Request {
+	return func(ctx context.Context, o client.Object) []reconcile.Request {
+		addons := addonv1alpha1.KubewardenAddonList{}
+		if err := r.Client.List(ctx, &addons,
+			client.InNamespace(o.GetNamespace()),
+			client.MatchingFields{referencesIndexKey: referencesIndexValue(kind, o.GetName())},
+		); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list addons referencing object", "kind", kind, "name", o.GetName())
+
+			return nil
+		}
+
+		requests := []reconcile.Request{}
+		for _, addon := range addons.Items {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: client.ObjectKeyFromObject(&addon),
+			})
+		}
+
+		return requests
+	}
+}
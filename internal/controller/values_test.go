@@ -0,0 +1,111 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+var _ = Describe("Kubewarden chart values resolution", func() {
+	It("should deep merge values", func() {
+		base := map[string]interface{}{
+			"image": map[string]interface{}{"repository": "kubewarden/policy-server", "tag": "v1.18.0"},
+			"tolerations": []interface{}{
+				map[string]interface{}{"key": "node-role.kubernetes.io/control-plane"},
+			},
+		}
+		override := map[string]interface{}{
+			"image":       map[string]interface{}{"tag": "v1.18.1"},
+			"tolerations": []interface{}{},
+		}
+
+		Expect(mergeValues(base, override)).To(Equal(map[string]interface{}{
+			"image":       map[string]interface{}{"repository": "kubewarden/policy-server", "tag": "v1.18.1"},
+			"tolerations": []interface{}{},
+		}))
+		// the inputs are left untouched
+		Expect(base["image"]).To(HaveKeyWithValue("tag", "v1.18.0"))
+	})
+
+	Context("When the addon references values", func() {
+		var reconciler *KubewardenAddonReconciler
+		var addon *addonv1alpha1.KubewardenAddon
+
+		BeforeEach(func() {
+			reconciler = &KubewardenAddonReconciler{Client: k8sClient}
+			addon = &addonv1alpha1.KubewardenAddon{
+				ObjectMeta: metav1.ObjectMeta{Name: "values-addon", Namespace: "default"},
+				Spec: addonv1alpha1.KubewardenAddonSpec{
+					ValuesFrom: []addonv1alpha1.ValuesReference{
+						{Kind: "ConfigMap", Name: "kubewarden-values", Chart: kubewardenDefaultsChartName},
+						{Kind: "Secret", Name: "kubewarden-values", Key: "controller.yaml", Chart: kubewardenControllerChartName},
+					},
+					DefaultsValues: runtime.RawExtension{Raw: []byte(`{"policyServer":{"replicaCount":3}}`)},
+				},
+			}
+
+			configMap := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "kubewarden-values", Namespace: "default"},
+				Data: map[string]string{
+					defaultValuesKey: "policyServer:\n  replicaCount: 2\n  priorityClassName: critical\n",
+				},
+			}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "kubewarden-values", Namespace: "default"},
+				Data: map[string][]byte{
+					"controller.yaml": []byte("telemetry:\n  metrics: true\n"),
+				},
+			}
+			Expect(k8sClient.Create(ctx, configMap)).To(Succeed())
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, configMap)).To(Succeed())
+				Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
+			})
+		})
+
+		It("should merge the referenced and inline values over the provider values", func() {
+			values, err := reconciler.resolveChartValues(ctx, addon)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(values.Controller).To(HaveKeyWithValue("telemetry", map[string]interface{}{"metrics": true}))
+
+			policyServer := values.Defaults["policyServer"].(map[string]interface{})
+			Expect(policyServer).To(HaveKeyWithValue("priorityClassName", "critical"))
+			// inline values win over the referenced ones
+			Expect(policyServer).To(HaveKeyWithValue("replicaCount", BeNumerically("==", 3)))
+		})
+
+		It("should fail on missing references unless they are optional", func() {
+			addon.Spec.ValuesFrom = append(addon.Spec.ValuesFrom, addonv1alpha1.ValuesReference{
+				Kind: "ConfigMap", Name: "missing-values", Chart: kubewardenDefaultsChartName,
+			})
+			_, err := reconciler.resolveChartValues(ctx, addon)
+			Expect(err).To(MatchError(errValuesNotResolved))
+
+			addon.Spec.ValuesFrom[len(addon.Spec.ValuesFrom)-1].Optional = true
+			_, err = reconciler.resolveChartValues(ctx, addon)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
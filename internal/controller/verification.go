@@ -0,0 +1,221 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+const (
+	// kubewardenVerificationConfigKey is the key the PolicyServer reads the verification configuration from, it is
+	// also the default key of the referenced ConfigMap
+	kubewardenVerificationConfigKey = "verification-config"
+
+	// kubewardenVerificationConfigName is the name of the ConfigMap holding the verification configuration in the
+	// workload clusters
+	kubewardenVerificationConfigName = "caapkw-verification-config"
+)
+
+// errVerificationConfigNotResolved is returned when the verification configuration referenced by an addon is
+// missing or invalid.
+var errVerificationConfigNotResolved = errors.New("verification config not resolved")
+
+// verificationConfig holds the fields of a Kubewarden verification configuration that are checked before it is
+// distributed to the workload clusters.
+type verificationConfig struct {
+	APIVersion string                    `json:"apiVersion"`
+	AllOf      []verificationSignature   `json:"allOf,omitempty"`
+	AnyOf      *verificationSignatureAny `json:"anyOf,omitempty"`
+}
+
+type verificationSignatureAny struct {
+	MinimumMatches int                     `json:"minimumMatches,omitempty"`
+	Signatures     []verificationSignature `json:"signatures"`
+}
+
+type verificationSignature struct {
+	Kind        string                 `json:"kind"`
+	Key         string                 `json:"key,omitempty"`
+	Issuer      string                 `json:"issuer,omitempty"`
+	Subject     map[string]interface{} `json:"subject,omitempty"`
+	Owner       string                 `json:"owner,omitempty"`
+	Certificate string                 `json:"certificate,omitempty"`
+}
+
+// resolveVerificationConfig returns the verification configuration referenced by the addon, or an empty string
+// when the addon does not set one.
+func (r *KubewardenAddonReconciler) resolveVerificationConfig(ctx context.Context, addon *addonv1alpha1.KubewardenAddon) (string, error) {
+	ref := addon.Spec.VerificationConfig
+	if ref == nil {
+		return "", nil
+	}
+
+	key := ref.Key
+	if key == "" {
+		key = kubewardenVerificationConfigKey
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := r.apiReader().Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: addon.Namespace}, configMap); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", fmt.Errorf("%w: ConfigMap %s not found", errVerificationConfigNotResolved, ref.Name)
+		}
+
+		return "", fmt.Errorf("getting ConfigMap %s: %w", ref.Name, err)
+	}
+
+	config, found := configMap.Data[key]
+	if !found {
+		return "", fmt.Errorf("%w: key %s not found in ConfigMap %s", errVerificationConfigNotResolved, key, ref.Name)
+	}
+	if err := validateVerificationConfig(config); err != nil {
+		return "", fmt.Errorf("%w: key %s of ConfigMap %s: %w", errVerificationConfigNotResolved, key, ref.Name, err)
+	}
+
+	return config, nil
+}
+
+// validateVerificationConfig checks that the verification configuration requires at least one signature, and
+// that each signature has the fields of its kind.
+func validateVerificationConfig(data string) error {
+	config := &verificationConfig{}
+	if err := yaml.Unmarshal([]byte(data), config); err != nil {
+		return fmt.Errorf("parsing verification config: %w", err)
+	}
+	if config.APIVersion != "v1" {
+		return fmt.Errorf("unsupported apiVersion '%s', expected v1", config.APIVersion)
+	}
+
+	signatures := config.AllOf
+	if config.AnyOf != nil {
+		if len(config.AnyOf.Signatures) == 0 {
+			return fmt.Errorf("anyOf requires signatures")
+		}
+		if config.AnyOf.MinimumMatches > len(config.AnyOf.Signatures) {
+			return fmt.Errorf("anyOf.minimumMatches %d exceeds the number of signatures", config.AnyOf.MinimumMatches)
+		}
+		signatures = append(signatures, config.AnyOf.Signatures...)
+	}
+	if len(signatures) == 0 {
+		return fmt.Errorf("no signature required, allOf or anyOf must list signatures")
+	}
+
+	for i, signature := range signatures {
+		var missing string
+		switch signature.Kind {
+		case "pubKey":
+			if signature.Key == "" {
+				missing = "key"
+			}
+		case "genericIssuer":
+			if signature.Issuer == "" {
+				missing = "issuer"
+			} else if len(signature.Subject) == 0 {
+				missing = "subject"
+			}
+		case "githubAction":
+			if signature.Owner == "" {
+				missing = "owner"
+			}
+		case "certificate":
+			if signature.Certificate == "" {
+				missing = "certificate"
+			}
+		default:
+			return fmt.Errorf("signature %d: unknown kind '%s'", i, signature.Kind)
+		}
+		if missing != "" {
+			return fmt.Errorf("signature %d: %s signature requires %s", i, signature.Kind, missing)
+		}
+	}
+
+	return nil
+}
+
+// applyVerificationConfig adds a ConfigMap holding the verification configuration to the kubewarden-defaults
+// objects, ahead of the PolicyServer it is set on.
+func applyVerificationConfig(manifests *kubewardenManifests, config string) error {
+	if config == "" {
+		return nil
+	}
+
+	for _, obj := range manifests.Defaults {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok || u.GetKind() != "PolicyServer" {
+			continue
+		}
+
+		if err := unstructured.SetNestedField(u.Object, kubewardenVerificationConfigName, "spec", "verificationConfig"); err != nil {
+			return fmt.Errorf("setting verification config of PolicyServer %s: %w", u.GetName(), err)
+		}
+	}
+
+	configMap := &unstructured.Unstructured{}
+	configMap.SetAPIVersion("v1")
+	configMap.SetKind("ConfigMap")
+	configMap.SetName(kubewardenVerificationConfigName)
+	configMap.SetNamespace(kubewardenNamespace)
+	if err := unstructured.SetNestedStringMap(configMap.Object, map[string]string{
+		kubewardenVerificationConfigKey: config,
+	}, "data"); err != nil {
+		return fmt.Errorf("setting verification config data: %w", err)
+	}
+	manifests.Defaults = append([]client.Object{configMap}, manifests.Defaults...)
+
+	return nil
+}
+
+// removeStaleVerificationConfig deletes the verification configuration left on the cluster once the addon no longer
+// sets one. It returns the number of deleted objects.
+func removeStaleVerificationConfig(ctx context.Context, remoteClient client.Client, manifests *kubewardenManifests) (int, error) {
+	if isObjectRendered(manifests.Defaults, "ConfigMap", kubewardenVerificationConfigName) {
+		return 0, nil
+	}
+
+	deleted, err := deleteVerificationConfig(ctx, remoteClient)
+	if err != nil || !deleted {
+		return 0, err
+	}
+
+	return 1, nil
+}
+
+// deleteVerificationConfig deletes the ConfigMap holding the verification configuration from the cluster. It
+// returns whether the ConfigMap existed.
+func deleteVerificationConfig(ctx context.Context, remoteClient client.Client) (bool, error) {
+	configMap := &corev1.ConfigMap{}
+	configMap.SetName(kubewardenVerificationConfigName)
+	configMap.SetNamespace(kubewardenNamespace)
+
+	deleted, err := deleteKubewardenObject(ctx, remoteClient, configMap)
+	if err != nil {
+		return false, fmt.Errorf("deleting verification config: %w", err)
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	addonv1alpha1 "github.com/caapkw/cluster-api-provider-addon-kubewarden/api/v1alpha1"
+)
+
+const testVerificationConfig = `apiVersion: v1
+allOf:
+  - kind: githubAction
+    owner: kubewarden
+anyOf:
+  minimumMatches: 1
+  signatures:
+    - kind: genericIssuer
+      issuer: https://token.actions.githubusercontent.com
+      subject:
+        urlPrefix: https://github.com/kubewarden/
+    - kind: pubKey
+      key: |
+        -----BEGIN PUBLIC KEY-----
+        MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEQiTy5S+2JFvVlhUwWPLziM7iTM2j
+        -----END PUBLIC KEY-----
+`
+
+var _ = Describe("Kubewarden verification config", func() {
+	It("should validate the required signatures", func() {
+		Expect(validateVerificationConfig(testVerificationConfig)).To(Succeed())
+
+		Expect(validateVerificationConfig("apiVersion: v1\n")).To(MatchError(ContainSubstring("no signature required")))
+		Expect(validateVerificationConfig("apiVersion: v2\nallOf:\n- kind: githubAction\n  owner: kubewarden\n")).
+			To(MatchError(ContainSubstring("apiVersion")))
+		Expect(validateVerificationConfig("apiVersion: v1\nallOf:\n- kind: pubKey\n")).To(MatchError(ContainSubstring("requires key")))
+		Expect(validateVerificationConfig("apiVersion: v1\nallOf:\n- kind: genericIssuer\n  issuer: https://accounts.google.com\n")).
+			To(MatchError(ContainSubstring("requires subject")))
+		Expect(validateVerificationConfig("apiVersion: v1\nallOf:\n- kind: unsigned\n")).To(MatchError(ContainSubstring("unknown kind")))
+	})
+
+	It("should distribute the verification config with the default PolicyServer", func() {
+		policyServer := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		policyServer.SetKind("PolicyServer")
+		policyServer.SetName(kubewardenHelmDefaultPolicyServerName)
+		manifests := &kubewardenManifests{Defaults: []client.Object{policyServer}}
+
+		Expect(applyVerificationConfig(manifests, testVerificationConfig)).To(Succeed())
+
+		Expect(manifests.Defaults).To(HaveLen(2))
+		configMap := manifests.Defaults[0].(*unstructured.Unstructured)
+		Expect(configMap.GetKind()).To(Equal("ConfigMap"))
+		Expect(configMap.GetNamespace()).To(Equal(kubewardenNamespace))
+		data, _, _ := unstructured.NestedStringMap(configMap.Object, "data")
+		Expect(data).To(HaveKeyWithValue(kubewardenVerificationConfigKey, testVerificationConfig))
+
+		name, _, _ := unstructured.NestedString(policyServer.Object, "spec", "verificationConfig")
+		Expect(name).To(Equal(configMap.GetName()))
+	})
+
+	Context("When the addon references a verification config", func() {
+		var reconciler *KubewardenAddonReconciler
+		var addon *addonv1alpha1.KubewardenAddon
+
+		BeforeEach(func() {
+			reconciler = &KubewardenAddonReconciler{Client: k8sClient}
+			addon = &addonv1alpha1.KubewardenAddon{
+				ObjectMeta: metav1.ObjectMeta{Name: "verification-addon", Namespace: "default"},
+				Spec: addonv1alpha1.KubewardenAddonSpec{
+					VerificationConfig: &addonv1alpha1.VerificationConfigReference{Name: "kubewarden-verification"},
+				},
+			}
+
+			configMap := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "kubewarden-verification", Namespace: "default"},
+				Data: map[string]string{
+					kubewardenVerificationConfigKey: testVerificationConfig,
+					"invalid":                       "apiVersion: v1\n",
+				},
+			}
+			Expect(k8sClient.Create(ctx, configMap)).To(Succeed())
+			DeferCleanup(func() {
+				Expect(k8sClient.Delete(ctx, configMap)).To(Succeed())
+			})
+		})
+
+		It("should read the verification config from the ConfigMap", func() {
+			config, err := reconciler.resolveVerificationConfig(ctx, addon)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config).To(Equal(testVerificationConfig))
+		})
+
+		It("should fail on missing or invalid verification configs", func() {
+			addon.Spec.VerificationConfig.Key = "invalid"
+			_, err := reconciler.resolveVerificationConfig(ctx, addon)
+			Expect(err).To(MatchError(errVerificationConfigNotResolved))
+
+			addon.Spec.VerificationConfig = &addonv1alpha1.VerificationConfigReference{Name: "missing"}
+			_, err = reconciler.resolveVerificationConfig(ctx, addon)
+			Expect(err).To(MatchError(errVerificationConfigNotResolved))
+		})
+	})
+})
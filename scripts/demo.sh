@@ -262,6 +262,9 @@ spec:
     resources:
       cpu: "500m"
       memory: "512Mi"
+  # CAPD clusters have a single control-plane node
+  scheduling:
+    tolerateControlPlane: true
 EOF
     
     echo ""